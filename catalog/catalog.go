@@ -0,0 +1,384 @@
+// Package catalog describes the operating systems fastpve can download: their releases,
+// mirror URL templates, GHCR fallback references, checksums and recommended VM hardware.
+package catalog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	KindISO       = "iso"
+	KindDiskImage = "disk-image"
+	KindDriver    = "driver"
+	// KindCloudImage images boot straight into a configured system through cloud-init.
+	KindCloudImage = "cloud-image"
+)
+
+var (
+	ErrUnknownOS      = errors.New("unknown os")
+	ErrUnknownRelease = errors.New("unknown release")
+)
+
+//go:embed default.json
+var defaultData []byte
+
+// Catalog is the root of the catalog document.
+type Catalog struct {
+	Version int   `json:"version"`
+	OS      []*OS `json:"os"`
+}
+
+// OS groups the releases of one operating system. Mirrors and Hardware are
+// defaults that a release may override.
+type OS struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Kind     string    `json:"kind"`
+	Mirrors  []string  `json:"mirrors,omitempty"`
+	Hardware *Hardware `json:"hardware,omitempty"`
+	// ChecksumFile names the sums file (e.g. "SHA256SUMS") published next to the images.
+	ChecksumFile string     `json:"checksum_file,omitempty"`
+	Releases     []*Release `json:"releases"`
+}
+
+// Release is a downloadable version of an OS.
+//
+// File and Mirrors are templates: {version}, {file} and every key of Vars are
+// substituted. Besides http(s) URLs, mirrors may be local or NFS paths, file://,
+// oci:// and s3:// locations, tried in the listed order. When VersionIndex is set it is fetched to learn the latest
+// version, Version being the fallback. With VersionMatch, a regexp whose first
+// group is the version, VersionIndex (or the mirror directory holding {version})
+// is read as a directory listing instead; with VersionKey, a dotted path such as
+// "hassos.ova", VersionIndex is a JSON document holding the version. FileMatch is matched against the
+// listing of the image directory; its named groups become Vars, for file names
+// that carry a build number.
+type Release struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Aliases      []string          `json:"aliases,omitempty"`
+	Version      string            `json:"version,omitempty"`
+	VersionIndex string            `json:"version_index,omitempty"`
+	VersionMatch string            `json:"version_match,omitempty"`
+	VersionKey   string            `json:"version_key,omitempty"`
+	FileMatch    string            `json:"file_match,omitempty"`
+	File         string            `json:"file,omitempty"`
+	Vars         map[string]string `json:"vars,omitempty"`
+	Mirrors      []string          `json:"mirrors,omitempty"`
+	// Checksum is "<algo>:<hex>", e.g. "sha256:…"; empty when unknown.
+	Checksum     string    `json:"checksum,omitempty"`
+	ChecksumFile string    `json:"checksum_file,omitempty"`
+	Editions     []string  `json:"editions,omitempty"`
+	GHCR         []GHCRRef `json:"ghcr,omitempty"`
+	Hardware     *Hardware `json:"hardware,omitempty"`
+	// LTS and EOL mark long term support and end-of-life releases in menus.
+	LTS bool `json:"lts,omitempty"`
+	EOL bool `json:"eol,omitempty"`
+	// VirtIO is the newest VirtIO driver version that still supports a Windows
+	// release, e.g. "0.1.173" for Windows 7; empty when the current drivers do.
+	VirtIO string `json:"virtio,omitempty"`
+
+	os *OS
+}
+
+// GHCRRef maps editions (matched case-insensitively) to a GHCR package reference.
+type GHCRRef struct {
+	Editions []string `json:"editions"`
+	Ref      string   `json:"ref"`
+}
+
+// Hardware is the recommended VM configuration; zero values mean "no recommendation".
+type Hardware struct {
+	Cores   int    `json:"cores,omitempty"`
+	Memory  int    `json:"memory,omitempty"`
+	Disk    int    `json:"disk,omitempty"`
+	BIOS    string `json:"bios,omitempty"`
+	Machine string `json:"machine,omitempty"`
+	OSType  string `json:"ostype,omitempty"`
+	// TPM adds a v2.0 TPM state disk, required by Windows 11 and Windows Server 2022+.
+	TPM bool `json:"tpm,omitempty"`
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultCatalog *Catalog
+
+	currentMu sync.RWMutex
+	current   *Catalog
+)
+
+// Default returns the catalog embedded in the binary.
+func Default() *Catalog {
+	defaultOnce.Do(func() {
+		c, err := Parse(defaultData)
+		if err != nil {
+			panic(fmt.Sprintf("embedded catalog: %v", err))
+		}
+		defaultCatalog = c
+	})
+	return defaultCatalog
+}
+
+// Current returns the active catalog: a loaded remote or local copy, or the embedded default.
+func Current() *Catalog {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	if current != nil {
+		return current
+	}
+	return Default()
+}
+
+// SetCurrent replaces the active catalog; nil restores the embedded default.
+func SetCurrent(c *Catalog) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = c
+}
+
+// Parse decodes and validates a catalog document.
+func Parse(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	seenOS := make(map[string]struct{})
+	for _, o := range c.OS {
+		if o.ID == "" {
+			return nil, errors.New("os with empty id")
+		}
+		if _, ok := seenOS[o.ID]; ok {
+			return nil, fmt.Errorf("duplicate os %q", o.ID)
+		}
+		seenOS[o.ID] = struct{}{}
+		seenRel := make(map[string]struct{})
+		for _, r := range o.Releases {
+			if r.ID == "" {
+				return nil, fmt.Errorf("os %q has a release with empty id", o.ID)
+			}
+			if _, ok := seenRel[r.ID]; ok {
+				return nil, fmt.Errorf("os %q has duplicate release %q", o.ID, r.ID)
+			}
+			seenRel[r.ID] = struct{}{}
+			r.os = o
+		}
+	}
+	return &c, nil
+}
+
+// FindOS returns the OS entry with the given id.
+func (c *Catalog) FindOS(id string) (*OS, error) {
+	for _, o := range c.OS {
+		if strings.EqualFold(o.ID, id) {
+			return o, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownOS, id)
+}
+
+// FindRelease looks a release up by id or alias; an empty name selects the first release.
+func (c *Catalog) FindRelease(osID, name string) (*Release, error) {
+	o, err := c.FindOS(osID)
+	if err != nil {
+		return nil, err
+	}
+	return o.FindRelease(name)
+}
+
+// FindRelease looks a release up by id or alias; an empty name selects the first release.
+// "<version>-<release>", e.g. "23.05.5-squashfs-efi", pins an older version of a release.
+func (o *OS) FindRelease(name string) (*Release, error) {
+	name = strings.TrimSpace(name)
+	if name == "" && len(o.Releases) > 0 {
+		return o.Releases[0], nil
+	}
+	if r := o.lookup(name); r != nil {
+		return r, nil
+	}
+	if version, rest, ok := strings.Cut(name, "-"); ok && version != "" && version[0] >= '0' && version[0] <= '9' {
+		if r := o.lookup(rest); r != nil {
+			pinned := r.Clone()
+			pinned.Version = version
+			pinned.VersionIndex, pinned.VersionMatch, pinned.VersionKey = "", "", ""
+			return pinned, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrUnknownRelease, o.ID, name)
+}
+
+func (o *OS) lookup(name string) *Release {
+	for _, r := range o.Releases {
+		if strings.EqualFold(r.ID, name) {
+			return r
+		}
+		for _, alias := range r.Aliases {
+			if strings.EqualFold(alias, name) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// ImportsImage reports whether the OS ships a disk image that becomes the VM system
+// disk, rather than an installer ISO.
+func (o *OS) ImportsImage() bool {
+	return o.Kind == KindDiskImage || o.Kind == KindCloudImage
+}
+
+// ReleaseIDs lists the release ids, e.g. for flag usage strings.
+func (o *OS) ReleaseIDs() []string {
+	ids := make([]string, len(o.Releases))
+	for i, r := range o.Releases {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+// Bind attaches a release discovered at runtime to o, so it inherits the OS mirrors
+// and hardware like a catalog entry without being listed in o.Releases.
+func (o *OS) Bind(r *Release) *Release {
+	r.os = o
+	return r
+}
+
+// OS returns the OS entry the release belongs to.
+func (r *Release) OS() *OS {
+	return r.os
+}
+
+// Clone copies the release, keeping its OS, so discovered values can be set
+// without changing the shared catalog.
+func (r *Release) Clone() *Release {
+	c := *r
+	if r.Vars != nil {
+		c.Vars = make(map[string]string, len(r.Vars))
+		for k, v := range r.Vars {
+			c.Vars[k] = v
+		}
+	}
+	return &c
+}
+
+// Expand returns the file name and mirror URLs for version; an empty version uses r.Version.
+func (r *Release) Expand(version string) (string, []string) {
+	file := r.replacer(version, "").Replace(r.File)
+	repl := r.replacer(version, file)
+
+	mirrors := r.Mirrors
+	if len(mirrors) == 0 && r.os != nil {
+		mirrors = r.os.Mirrors
+	}
+	urls := make([]string, 0, len(mirrors))
+	for _, m := range mirrors {
+		urls = append(urls, repl.Replace(m))
+	}
+	return file, urls
+}
+
+// Template substitutes {version}, {file} and Vars in s, e.g. a checksum file name.
+func (r *Release) Template(s string) string {
+	file, _ := r.Expand("")
+	return r.replacer("", file).Replace(s)
+}
+
+func (r *Release) replacer(version, file string) *strings.Replacer {
+	if version == "" {
+		version = r.Version
+	}
+	pairs := []string{"{version}", version}
+	for k, v := range r.Vars {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	if file != "" {
+		pairs = append(pairs, "{file}", file)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// ChecksumFileName returns the sums file of the release, falling back to the OS default.
+func (r *Release) ChecksumFileName() string {
+	if r.ChecksumFile == "" && r.os != nil {
+		return r.os.ChecksumFile
+	}
+	return r.ChecksumFile
+}
+
+// GHCRReference returns the GHCR package for edition, if the release has one.
+// An entry without editions serves releases that have no editions at all.
+func (r *Release) GHCRReference(edition string) (string, bool) {
+	edition = strings.TrimSpace(edition)
+	for _, g := range r.GHCR {
+		if len(g.Editions) == 0 && edition == "" {
+			return g.Ref, true
+		}
+		for _, e := range g.Editions {
+			if strings.EqualFold(e, edition) {
+				return g.Ref, true
+			}
+		}
+	}
+	return "", false
+}
+
+// GHCREditions lists the named editions that have a GHCR fallback.
+func (r *Release) GHCREditions() []string {
+	var editions []string
+	for _, g := range r.GHCR {
+		for _, e := range g.Editions {
+			if e != "" {
+				editions = append(editions, e)
+			}
+		}
+	}
+	return editions
+}
+
+// HardwareProfile merges the release recommendation over the OS default.
+func (r *Release) HardwareProfile() Hardware {
+	var hw Hardware
+	if r.os != nil && r.os.Hardware != nil {
+		hw = *r.os.Hardware
+	}
+	if r.Hardware != nil {
+		hw = hw.merge(*r.Hardware)
+	}
+	return hw
+}
+
+// HardwareProfile returns the OS wide recommendation.
+func (o *OS) HardwareProfile() Hardware {
+	if o.Hardware == nil {
+		return Hardware{}
+	}
+	return *o.Hardware
+}
+
+func (h Hardware) merge(o Hardware) Hardware {
+	if o.Cores > 0 {
+		h.Cores = o.Cores
+	}
+	if o.Memory > 0 {
+		h.Memory = o.Memory
+	}
+	if o.Disk > 0 {
+		h.Disk = o.Disk
+	}
+	if o.BIOS != "" {
+		h.BIOS = o.BIOS
+	}
+	if o.Machine != "" {
+		h.Machine = o.Machine
+	}
+	if o.OSType != "" {
+		h.OSType = o.OSType
+	}
+	if o.TPM {
+		h.TPM = true
+	}
+	return h
+}
@@ -0,0 +1,184 @@
+package catalog
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestDefaultCatalog(t *testing.T) {
+	c := Default()
+	for _, id := range []string{"windows", "ubuntu", "istoreos", "virtio"} {
+		o, err := c.FindOS(id)
+		if err != nil {
+			t.Fatalf("FindOS(%s): %v", id, err)
+		}
+		if len(o.Releases) == 0 {
+			t.Fatalf("%s has no releases", id)
+		}
+	}
+}
+
+func TestFindRelease(t *testing.T) {
+	c := Default()
+	tests := []struct {
+		os, name, want string
+	}{
+		{"windows", "win11", "11"},
+		{"windows", "Windows10", "10"},
+		{"ubuntu", "", "22.04-desktop"},
+		{"ubuntu", "24.10-live-server", "24.10-server"},
+		{"istoreos", "2203", "22.03"},
+		{"openwrt", "release", "squashfs-efi"},
+		{"immortalwrt", "snapshot", "snapshot-squashfs-efi"},
+		{"truenas", "scale", "25.04"},
+		{"openmediavault", "", "7"},
+		{"haos", "", "stable"},
+	}
+	for _, tt := range tests {
+		rel, err := c.FindRelease(tt.os, tt.name)
+		if err != nil {
+			t.Fatalf("FindRelease(%s, %q): %v", tt.os, tt.name, err)
+		}
+		if rel.ID != tt.want {
+			t.Fatalf("FindRelease(%s, %q) = %s, want %s", tt.os, tt.name, rel.ID, tt.want)
+		}
+	}
+	if _, err := c.FindRelease("ubuntu", "18.04"); !errors.Is(err, ErrUnknownRelease) {
+		t.Fatalf("expected ErrUnknownRelease, got %v", err)
+	}
+	if _, err := c.FindRelease("beos", ""); !errors.Is(err, ErrUnknownOS) {
+		t.Fatalf("expected ErrUnknownOS, got %v", err)
+	}
+}
+
+func TestFindPinnedRelease(t *testing.T) {
+	rel, err := Default().FindRelease("openwrt", "23.05.5-squashfs-efi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.ID != "squashfs-efi" || rel.Version != "23.05.5" || rel.VersionMatch != "" {
+		t.Fatalf("pinned release = %+v", rel)
+	}
+	orig, _ := Default().FindRelease("openwrt", "squashfs-efi")
+	if orig.Version == "23.05.5" {
+		t.Fatal("pinning modified the catalog release")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	rel, err := Default().FindRelease("ubuntu", "22.04-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, urls := rel.Expand("")
+	if file != "ubuntu-22.04.5-live-server-amd64.iso" {
+		t.Fatalf("unexpected file %s", file)
+	}
+	want := "https://releases.ubuntu.com/22.04/ubuntu-22.04.5-live-server-amd64.iso"
+	if !slices.Contains(urls, want) {
+		t.Fatalf("urls %v do not contain %s", urls, want)
+	}
+
+	rel, err = Default().FindRelease("istoreos", "24.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, urls = rel.Expand("24.10.2-2025080112")
+	if file != "istoreos-24.10.2-2025080112-x86-64-squashfs-combined-efi.img.gz" {
+		t.Fatalf("unexpected file %s", file)
+	}
+	if urls[0] != "https://fw.d4ctech.com/iStoreOS/x86_64_efi/"+file {
+		t.Fatalf("unexpected url %s", urls[0])
+	}
+}
+
+func TestGHCRAndHardware(t *testing.T) {
+	rel, err := Default().FindRelease("windows", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref, ok := rel.GHCRReference(""); !ok || ref != "ghcr.io/kspeeder/win7x64:en_enterprise" {
+		t.Fatalf("unexpected default win7 ref %q", ref)
+	}
+	if ref, ok := rel.GHCRReference("chinese (simplified) x64"); !ok || ref != "ghcr.io/kspeeder/win7x64:cn_simplified" {
+		t.Fatalf("unexpected win7 cn ref %q", ref)
+	}
+	if _, ok := rel.GHCRReference("Chinese (Traditional)"); ok {
+		t.Fatal("unexpected ref for edition without GHCR package")
+	}
+	hw := rel.HardwareProfile()
+	if hw.Cores != 4 || hw.Memory != 4096 || hw.BIOS != "seabios" || hw.OSType != "win7" {
+		t.Fatalf("unexpected hardware %+v", hw)
+	}
+
+	rel, err = Default().FindRelease("haos", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref, ok := rel.GHCRReference(""); !ok || rel.Template(ref) != "ghcr.io/kspeeder/haos:"+rel.Version {
+		t.Fatalf("unexpected haos ref %q", ref)
+	}
+}
+
+func TestParseRejectsDuplicates(t *testing.T) {
+	if _, err := Parse([]byte(`{"os":[{"id":"a","releases":[]},{"id":"a","releases":[]}]}`)); err == nil {
+		t.Fatal("expected duplicate os error")
+	}
+	if _, err := Parse([]byte(`{"os":[{"id":"a","releases":[{"id":"1"},{"id":"1"}]}]}`)); err == nil {
+		t.Fatal("expected duplicate release error")
+	}
+}
+
+func TestLoadSigned(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"version": 100, "os": [{"id": "ubuntu", "releases": [{"id": "26.04-server"}]}]}`)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+	tampered := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/catalog.json":
+			if tampered {
+				w.Write(append([]byte(" "), data...))
+				return
+			}
+			w.Write(data)
+		case "/catalog.json.sig":
+			w.Write([]byte(sig))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	oldKey := PublicKey
+	defer func() { PublicKey = oldKey }()
+
+	PublicKey = ""
+	if _, err := Load(context.Background(), srv.Client(), srv.URL+"/catalog.json"); !errors.Is(err, ErrNoPublicKey) {
+		t.Fatalf("expected ErrNoPublicKey, got %v", err)
+	}
+
+	PublicKey = base64.StdEncoding.EncodeToString(pub)
+	c, err := Load(context.Background(), srv.Client(), srv.URL+"/catalog.json")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, err := c.FindRelease("ubuntu", "26.04-server"); err != nil {
+		t.Fatalf("loaded catalog misses release: %v", err)
+	}
+
+	tampered = true
+	if _, err := Load(context.Background(), srv.Client(), srv.URL+"/catalog.json"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
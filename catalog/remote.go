@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const maxCatalogSize = 4 << 20
+
+// PublicKey is the base64 encoded ed25519 key remote catalogs must be signed with.
+// It is set at build time (-ldflags "-X github.com/linkease/fastpve/catalog.PublicKey=…");
+// without it only the embedded catalog and local files can be used.
+var PublicKey = ""
+
+var (
+	ErrNoPublicKey      = errors.New("no catalog public key configured")
+	ErrInvalidSignature = errors.New("catalog signature verification failed")
+)
+
+// Load reads a catalog from a local file or an http(s) URL. Remote copies must come
+// with a detached base64 ed25519 signature at "<url>.sig"; local files are trusted.
+// A catalog older than the embedded one is rejected.
+func Load(ctx context.Context, client *http.Client, src string) (*Catalog, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		data, err = fetchSigned(ctx, client, src)
+	} else {
+		data, err = os.ReadFile(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if c.Version < Default().Version {
+		return nil, fmt.Errorf("catalog %s version %d is older than built-in version %d", src, c.Version, Default().Version)
+	}
+	return c, nil
+}
+
+func fetchSigned(ctx context.Context, client *http.Client, src string) ([]byte, error) {
+	if PublicKey == "" {
+		return nil, ErrNoPublicKey
+	}
+	key, err := base64.StdEncoding.DecodeString(PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid catalog public key")
+	}
+	data, err := fetch(ctx, client, src)
+	if err != nil {
+		return nil, err
+	}
+	sigData, err := fetch(ctx, client, src+".sig")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+		return nil, ErrInvalidSignature
+	}
+	return data, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, urlStr string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", urlStr, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxCatalogSize))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/urfave/cli/v3"
+)
+
+func catalogCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "catalog",
+		Usage: "List the operating systems and releases of the active image catalog",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Print the whole catalog document",
+			},
+		},
+		Action: listCatalog,
+	}
+}
+
+func listCatalog(ctx context.Context, cmd *cli.Command) error {
+	c := catalog.Current()
+	if cmd.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	for _, o := range c.OS {
+		fmt.Printf("%s (%s)\n", o.ID, o.Name)
+		for _, r := range o.Releases {
+			line := "  " + r.ID
+			if len(r.Aliases) > 0 {
+				line += " [" + strings.Join(r.Aliases, ", ") + "]"
+			}
+			if r.Version != "" {
+				line += " " + r.Version
+			}
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
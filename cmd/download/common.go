@@ -5,6 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/quickget"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/urfave/cli/v3"
 )
 
 const (
@@ -16,6 +21,9 @@ const (
 	Win11 = iota
 	Win10
 	Win7
+	WinServer2025
+	WinServer2022
+	WinServer2019
 )
 
 func ensureDirs(paths ...string) error {
@@ -27,49 +35,61 @@ func ensureDirs(paths ...string) error {
 	return nil
 }
 
+// isoPathFor resolves the image directory, preferring the PVE storage given by --storage.
+func isoPathFor(cmd *cli.Command) (string, error) {
+	if name := strings.TrimSpace(cmd.String("storage")); name != "" {
+		storage, err := quickget.FindISOStorage(name)
+		if err != nil {
+			return "", fmt.Errorf("iso storage %s: %w", name, err)
+		}
+		return storage.ISOPath(), nil
+	}
+	return cmd.String("iso-path"), nil
+}
+
+// cachePathFor resolves the partial download directory: --cache-path when given, else
+// the template/cache directory next to an ".../template/iso" image directory, so that
+// finished downloads are renamed on the same filesystem.
+func cachePathFor(cmd *cli.Command, isoPath string) string {
+	if p := strings.TrimSpace(cmd.String("cache-path")); p != "" {
+		return p
+	}
+	if dir := filepath.Clean(isoPath); filepath.Base(dir) == "iso" {
+		return filepath.Join(filepath.Dir(dir), "cache")
+	}
+	return defaultCachePath
+}
+
 func defaultStatusPath(cachePath, name string) string {
 	return filepath.Join(cachePath, name)
 }
 
 func parseWindowsVersion(v string) (int, error) {
-	switch strings.TrimSpace(strings.ToLower(v)) {
-	case "11", "win11", "windows11":
-		return Win11, nil
-	case "10", "win10", "windows10":
-		return Win10, nil
-	case "7", "win7", "windows7":
-		return Win7, nil
-	default:
+	rel, err := catalog.Current().FindRelease("windows", v)
+	if err != nil {
+		return -1, fmt.Errorf("unknown windows version: %s", v)
+	}
+	version, ok := vmdownloader.WindowsVersion(rel.ID)
+	if !ok {
 		return -1, fmt.Errorf("unknown windows version: %s", v)
 	}
+	return version, nil
 }
 
-func parseUbuntuVersion(v string) (int, error) {
-	switch strings.TrimSpace(strings.ToLower(v)) {
-	case "22.04-desktop", "22.04d", "2204d":
-		return 0, nil
-	case "22.04-server", "22.04s", "2204s":
-		return 1, nil
-	case "24.10-desktop", "24.10d", "2410d":
-		return 2, nil
-	case "24.10-server", "24.10s", "2410s":
-		return 3, nil
-	case "25.04-desktop", "25.04d", "2504d":
-		return 4, nil
-	case "25.04-server", "25.04s", "2504s":
-		return 5, nil
-	default:
-		return -1, fmt.Errorf("unknown ubuntu version: %s", v)
+// findRelease resolves a --version value against the active catalog.
+func findRelease(osID, v string) (*catalog.Release, error) {
+	rel, err := catalog.Current().FindRelease(osID, v)
+	if err != nil {
+		return nil, fmt.Errorf("unknown %s version: %s", osID, v)
 	}
+	return rel, nil
 }
 
-func parseIstoreVersion(v string) (int, error) {
-	switch strings.TrimSpace(strings.ToLower(v)) {
-	case "24.10", "2410", "24":
-		return 0, nil
-	case "22.03", "2203", "22":
-		return 1, nil
-	default:
-		return -1, fmt.Errorf("unknown istore version: %s", v)
+// releaseUsage lists the release ids of an OS for flag help texts.
+func releaseUsage(osID string) string {
+	o, err := catalog.Current().FindOS(osID)
+	if err != nil {
+		return ""
 	}
+	return strings.Join(o.ReleaseIDs(), ", ")
 }
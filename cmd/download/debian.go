@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/urfave/cli/v3"
+)
+
+func debianCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "debian",
+		Usage: "Download Debian installer ISO",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "version",
+				Usage:   "Debian version: stable, oldstable, a major (12) or point release (12.10.0), optionally suffixed with -netinst or -dvd",
+				Value:   "stable-netinst",
+				Aliases: []string{"v"},
+			},
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Resume from existing status if present",
+				Value: true,
+			},
+			&cli.StringFlag{
+				Name:  "iso-path",
+				Usage: "Directory for final ISO",
+				Value: defaultISOPath,
+			},
+			&cli.StringFlag{
+				Name:  "cache-path",
+				Usage: "Directory for partial downloads/status files (default: template/cache next to the ISO directory)",
+			},
+			&cli.StringFlag{
+				Name:  "status-path",
+				Usage: "Override status file path for Debian ISO",
+			},
+		},
+		Action: downloadDebian,
+	}
+}
+
+func downloadDebian(ctx context.Context, cmd *cli.Command) error {
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	cachePath := cachePathFor(cmd, isoPath)
+	if err := ensureDirs(isoPath, cachePath); err != nil {
+		return err
+	}
+	statusPath := cmd.String("status-path")
+	if statusPath == "" {
+		statusPath = defaultStatusPath(cachePath, "debian_install.ops")
+	}
+
+	downer := downloader.NewDownloader()
+	rel, err := vmdownloader.FindDebianRelease(ctx, downer, cmd.String("version"))
+	if err != nil {
+		return err
+	}
+
+	var status *downloader.DownloadStatus
+	if cmd.Bool("resume") {
+		status, _ = vmdownloader.IsStatusValid(downer, statusPath)
+	}
+	target, err := vmdownloader.DownloadDebianISO(ctx, downer, isoPath, cachePath, statusPath, status, rel)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Debian ISO ready:", target)
+	return nil
+}
@@ -17,7 +17,7 @@ func istoreCommand() *cli.Command {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "version",
-				Usage:   "iStoreOS version: 24.10 or 22.03",
+				Usage:   "iStoreOS version: " + releaseUsage("istoreos"),
 				Value:   "24.10",
 				Aliases: []string{"v"},
 			},
@@ -33,8 +33,7 @@ func istoreCommand() *cli.Command {
 			},
 			&cli.StringFlag{
 				Name:  "cache-path",
-				Usage: "Directory for partial downloads/status files",
-				Value: defaultCachePath,
+				Usage: "Directory for partial downloads/status files (default: template/cache next to the ISO directory)",
 			},
 			&cli.StringFlag{
 				Name:  "status-path",
@@ -46,8 +45,11 @@ func istoreCommand() *cli.Command {
 }
 
 func downloadIstore(ctx context.Context, cmd *cli.Command) error {
-	isoPath := cmd.String("iso-path")
-	cachePath := cmd.String("cache-path")
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	cachePath := cachePathFor(cmd, isoPath)
 	if err := ensureDirs(isoPath, cachePath); err != nil {
 		return err
 	}
@@ -57,7 +59,7 @@ func downloadIstore(ctx context.Context, cmd *cli.Command) error {
 	}
 	resume := cmd.Bool("resume")
 
-	ver, err := parseIstoreVersion(cmd.String("version"))
+	rel, err := findRelease("istoreos", cmd.String("version"))
 	if err != nil {
 		return err
 	}
@@ -67,7 +69,7 @@ func downloadIstore(ctx context.Context, cmd *cli.Command) error {
 	if resume {
 		status, _ = vmdownloader.IsStatusValid(downer, statusPath)
 	}
-	target, err := vmdownloader.DownloadIstoreIMG(ctx, downer, isoPath, cachePath, statusPath, status, ver)
+	target, err := vmdownloader.DownloadIstoreIMG(ctx, downer, isoPath, cachePath, statusPath, status, rel)
 	if err != nil {
 		return err
 	}
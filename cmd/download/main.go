@@ -5,6 +5,9 @@ import (
 	"log"
 	"os"
 
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/vmdownloader"
 	"github.com/urfave/cli/v3"
 )
 
@@ -18,11 +21,65 @@ func newApp() *cli.Command {
 	return &cli.Command{
 		Name:  "fastpve-download",
 		Usage: "Download VM images (Windows/Ubuntu/iStoreOS/VirtIO)",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:    "peers",
+				Usage:   "LAN peers running \"serve\" to try first (host[:port], or \"auto\" to discover)",
+				Sources: cli.EnvVars("FASTPVE_PEERS"),
+			},
+			&cli.StringFlag{
+				Name:    "catalog",
+				Usage:   "Image catalog to use instead of the built-in one (local file, or signed http(s) URL)",
+				Sources: cli.EnvVars("FASTPVE_CATALOG"),
+			},
+			&cli.StringFlag{
+				Name:    "ghcr-namespace",
+				Usage:   "Registry namespace serving the catalog GHCR packages instead of ghcr.io/kspeeder (e.g. harbor.example.com/isos)",
+				Sources: cli.EnvVars("FASTPVE_GHCR_NAMESPACE"),
+			},
+			&cli.StringFlag{
+				Name:  "storage",
+				Usage: "PVE storage with iso content (e.g. a shared NFS/CephFS storage); overrides --iso-path",
+			},
+		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			vmdownloader.SetLANPeers(cmd.StringSlice("peers"))
+			vmdownloader.SetGHCRNamespace(cmd.String("ghcr-namespace"))
+			if src := cmd.String("catalog"); src != "" {
+				c, err := catalog.Load(ctx, downloader.NewDownloader().DefaultClient(), src)
+				if err != nil {
+					log.Println("load catalog failed, using built-in catalog:", err)
+				} else {
+					catalog.SetCurrent(c)
+				}
+			}
+			return ctx, nil
+		},
 		Commands: []*cli.Command{
 			windowsCommand(),
 			ubuntuCommand(),
+			debianCommand(),
+			releaseCommand("rocky", "rocky", "Rocky Linux"),
+			releaseCommand("alma", "almalinux", "AlmaLinux", "almalinux"),
+			releaseCommand("centos-stream", "centos-stream", "CentOS Stream", "centos"),
+			releaseCommand("fedora", "fedora", "Fedora Server"),
 			istoreCommand(),
+			releaseCommand("openwrt", "openwrt", "OpenWrt"),
+			releaseCommand("immortalwrt", "immortalwrt", "ImmortalWrt"),
+			releaseCommand("truenas", "truenas", "TrueNAS SCALE"),
+			releaseCommand("omv", "openmediavault", "OpenMediaVault", "openmediavault"),
+			releaseCommand("fnos", "fnos", "fnOS"),
+			releaseCommand("haos", "haos", "Home Assistant OS", "homeassistant"),
+			releaseCommand("ubuntu-cloud", "ubuntu-cloud", "Ubuntu cloud"),
+			releaseCommand("debian-cloud", "debian-cloud", "Debian cloud"),
+			releaseCommand("rocky-cloud", "rocky-cloud", "Rocky Linux cloud"),
+			ociCommand(),
+			s3Command(),
+			quickgetCommand(),
+			urlCommand(),
 			virtioCommand(),
+			serveCommand(),
+			catalogCommand(),
 		},
 	}
 }
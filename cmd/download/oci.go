@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/urfave/cli/v3"
+)
+
+func ociCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "oci",
+		Usage:     "Download a file from an OCI package (e.g. a GHCR image package)",
+		ArgsUsage: "<registry/repo:tag>",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "file",
+				Usage: "Files of the package to download, by name or glob such as \"*.iso\" (default: the first one)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "mirror",
+				Usage: "Registry mirror hosts to try before the registry itself",
+			},
+			&cli.StringFlag{
+				Name:  "iso-path",
+				Usage: "Directory for the downloaded file",
+				Value: defaultISOPath,
+			},
+			&cli.BoolFlag{
+				Name:  "plain-http",
+				Usage: "Talk to the registry over plain HTTP (local test registries)",
+			},
+		},
+		Action:   downloadOCI,
+		Commands: []*cli.Command{ociPushCommand(), ociListCommand()},
+	}
+}
+
+func ociPushCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "push",
+		Usage:     "Upload a local file (e.g. an ISO) as an OCI package that \"oci\" and the GHCR fallback can download",
+		ArgsUsage: "<file> <registry/repo:tag>",
+		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:  "chunk-size",
+				Usage: "Blob size in MiB; an interrupted push resumes at the first missing blob",
+				Value: vmdownloader.DefaultOCIChunkSize >> 20,
+			},
+			&cli.StringFlag{
+				Name:  "source-url",
+				Usage: "Original download URL recorded in the package annotations",
+			},
+			&cli.StringFlag{
+				Name:    "username",
+				Usage:   "Registry user (default: docker login credentials for the registry host)",
+				Sources: cli.EnvVars("OCI_USERNAME"),
+			},
+			&cli.StringFlag{
+				Name:    "password",
+				Usage:   "Registry password or token",
+				Sources: cli.EnvVars("OCI_PASSWORD"),
+			},
+			&cli.BoolFlag{
+				Name:  "plain-http",
+				Usage: "Talk to the registry over plain HTTP (local test registries)",
+			},
+		},
+		Action: pushOCI,
+	}
+}
+
+func downloadOCI(ctx context.Context, cmd *cli.Command) error {
+	reference := strings.TrimSpace(cmd.Args().First())
+	if reference == "" {
+		return errors.New("missing OCI reference, e.g. ghcr.io/kspeeder/win7x64:en_enterprise")
+	}
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	if err := ensureDirs(isoPath); err != nil {
+		return err
+	}
+	if mirrors := cmd.StringSlice("mirror"); len(mirrors) > 0 {
+		vmdownloader.GHCRMirrorSelector = func(context.Context, string) ([]string, error) {
+			return mirrors, nil
+		}
+	}
+	vmdownloader.RegistryPlainHTTP = cmd.Bool("plain-http")
+	targets, err := vmdownloader.DownloadOCIFiles(ctx, reference, isoPath, cmd.StringSlice("file"))
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		fmt.Println("OCI file ready:", target)
+	}
+	return nil
+}
+
+func pushOCI(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 2 {
+		return errors.New("usage: oci push <file> <registry/repo:tag>")
+	}
+	file, reference := cmd.Args().Get(0), cmd.Args().Get(1)
+	dgst, err := vmdownloader.PushOCIFile(ctx, file, reference, vmdownloader.OCIPushOptions{
+		ChunkSize: cmd.Int64("chunk-size") << 20,
+		SourceURL: cmd.String("source-url"),
+		PlainHTTP: cmd.Bool("plain-http"),
+		Username:  cmd.String("username"),
+		Password:  cmd.String("password"),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("OCI package pushed:", reference, dgst)
+	return nil
+}
+
+func ociListCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "list",
+		Usage:     "List the tags of a repository, or of every GHCR repository the catalog uses",
+		ArgsUsage: "[registry/repo]",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "mirror",
+				Usage: "Registry mirror hosts to try before the registry itself",
+			},
+			&cli.BoolFlag{
+				Name:  "plain-http",
+				Usage: "Talk to the registry over plain HTTP (local test registries)",
+			},
+		},
+		Action: listOCITags,
+	}
+}
+
+func listOCITags(ctx context.Context, cmd *cli.Command) error {
+	vmdownloader.RegistryPlainHTTP = cmd.Bool("plain-http")
+	if mirrors := cmd.StringSlice("mirror"); len(mirrors) > 0 {
+		vmdownloader.GHCRMirrorSelector = func(context.Context, string) ([]string, error) {
+			return mirrors, nil
+		}
+	}
+	if repository := strings.TrimSpace(cmd.Args().First()); repository != "" {
+		tags, err := vmdownloader.ListRegistryTags(ctx, repository)
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			fmt.Println(tag)
+		}
+		return nil
+	}
+
+	// Group the catalog packages by repository, keeping catalog order.
+	var repos []string
+	byRepo := make(map[string][]vmdownloader.GHCRPackage)
+	for _, pkg := range vmdownloader.CatalogGHCRPackages() {
+		if _, ok := byRepo[pkg.Repository]; !ok {
+			repos = append(repos, pkg.Repository)
+		}
+		byRepo[pkg.Repository] = append(byRepo[pkg.Repository], pkg)
+	}
+	for _, repo := range repos {
+		fmt.Println(repo)
+		tags, err := vmdownloader.ListRegistryTags(ctx, repo)
+		if err != nil {
+			fmt.Println("  error:", err)
+			continue
+		}
+		published := make(map[string]bool, len(tags))
+		for _, tag := range tags {
+			published[tag] = true
+			line := "  " + tag
+			for _, pkg := range byRepo[repo] {
+				if pkg.Tag == tag {
+					line += "  " + ghcrPackageLabel(pkg)
+				}
+			}
+			fmt.Println(line)
+		}
+		for _, pkg := range byRepo[repo] {
+			if !published[pkg.Tag] {
+				fmt.Printf("  %s  %s (missing)\n", pkg.Tag, ghcrPackageLabel(pkg))
+			}
+		}
+	}
+	return nil
+}
+
+func ghcrPackageLabel(pkg vmdownloader.GHCRPackage) string {
+	label := pkg.Release.OS().ID + " " + pkg.Release.ID
+	var editions []string
+	for _, e := range pkg.Editions {
+		if e != "" {
+			editions = append(editions, e)
+		}
+	}
+	if len(editions) > 0 {
+		label += ": " + strings.Join(editions, ", ")
+	}
+	return label
+}
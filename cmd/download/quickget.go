@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/quickget"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/urfave/cli/v3"
+)
+
+// quickgetCommand downloads any OS the embedded quickget script supports. Without a
+// release it lists what quickget offers instead.
+func quickgetCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "quickget",
+		Usage:     "Download an OS image through the quickget script, or list the supported OSes and releases",
+		ArgsUsage: "[os] [release] [edition]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Resume from existing status if present and for the same file",
+				Value: true,
+			},
+			&cli.StringFlag{
+				Name:  "iso-path",
+				Usage: "Directory for final ISO",
+				Value: defaultISOPath,
+			},
+			&cli.StringFlag{
+				Name:  "cache-path",
+				Usage: "Directory for partial downloads/status files (default: template/cache next to the ISO directory)",
+			},
+			&cli.StringFlag{
+				Name:  "status-path",
+				Usage: "Override status file path for quickget downloads",
+			},
+		},
+		Action: downloadQuickget,
+	}
+}
+
+func downloadQuickget(ctx context.Context, cmd *cli.Command) error {
+	osName := strings.ToLower(strings.TrimSpace(cmd.Args().Get(0)))
+	release := strings.TrimSpace(cmd.Args().Get(1))
+	edition := strings.TrimSpace(cmd.Args().Get(2))
+	if osName == "" {
+		distros, err := quickget.Distros(ctx)
+		if err != nil {
+			return err
+		}
+		for _, d := range distros {
+			fmt.Printf("%-24s %s\n", d.ID, d.Name)
+		}
+		return nil
+	}
+	if release == "" {
+		entries, err := quickget.List(ctx, osName)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return fmt.Errorf("quickget lists no releases of %s", osName)
+		}
+		for _, e := range entries {
+			fmt.Println(strings.TrimSpace(e.Release + " " + quoteOption(e.Option)))
+		}
+		return nil
+	}
+
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	cachePath := cachePathFor(cmd, isoPath)
+	if err := ensureDirs(isoPath, cachePath); err != nil {
+		return err
+	}
+	statusPath := cmd.String("status-path")
+	if statusPath == "" {
+		statusPath = defaultStatusPath(cachePath, "quickget_install.ops")
+	}
+	downer := downloader.NewDownloader()
+	var status *downloader.DownloadStatus
+	if cmd.Bool("resume") {
+		status, _ = vmdownloader.IsStatusValid(downer, statusPath)
+	}
+	target, err := vmdownloader.DownloadQuickgetImage(ctx, downer, isoPath, cachePath, statusPath, status, osName, release, edition, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Image ready:", target)
+	return nil
+}
+
+// quoteOption quotes editions with spaces, such as Windows languages, so the listed
+// line can be pasted back as arguments.
+func quoteOption(option string) string {
+	if strings.ContainsAny(option, " ()") {
+		return fmt.Sprintf("%q", option)
+	}
+	return option
+}
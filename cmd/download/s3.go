@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/urfave/cli/v3"
+)
+
+func s3Command() *cli.Command {
+	return &cli.Command{
+		Name:  "s3",
+		Usage: "Copy images to and from S3-compatible storage (AWS, MinIO...)",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "Profile of ~/.aws/credentials and ~/.aws/config to use instead of the AWS_* environment variables",
+			},
+		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			vmdownloader.SetS3Profile(cmd.String("profile"))
+			return ctx, nil
+		},
+		Commands: []*cli.Command{s3PushCommand(), s3PullCommand(), s3ListCommand()},
+	}
+}
+
+func s3PushCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "push",
+		Usage:     "Upload a local file; a destination ending in \"/\" keeps the file name",
+		ArgsUsage: "<file> <s3://bucket/key>",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if cmd.Args().Len() != 2 {
+				return errors.New("usage: s3 push <file> <s3://bucket/key>")
+			}
+			location, err := vmdownloader.PushS3File(ctx, downloader.NewDownloader(), cmd.Args().Get(0), cmd.Args().Get(1))
+			if err != nil {
+				return err
+			}
+			fmt.Println("S3 object uploaded:", location)
+			return nil
+		},
+	}
+}
+
+func s3PullCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "pull",
+		Usage:     "Download an object into the ISO directory",
+		ArgsUsage: "<s3://bucket/key>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Resume from existing status if present",
+				Value: true,
+			},
+			&cli.StringFlag{
+				Name:  "iso-path",
+				Usage: "Directory for the downloaded file",
+				Value: defaultISOPath,
+			},
+			&cli.StringFlag{
+				Name:  "cache-path",
+				Usage: "Directory for partial downloads/status files (default: template/cache next to the ISO directory)",
+			},
+		},
+		Action: pullS3,
+	}
+}
+
+func pullS3(ctx context.Context, cmd *cli.Command) error {
+	location := strings.TrimSpace(cmd.Args().First())
+	if location == "" {
+		return errors.New("missing S3 location, e.g. s3://isos/win11.iso")
+	}
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	cachePath := cachePathFor(cmd, isoPath)
+	if err := ensureDirs(isoPath, cachePath); err != nil {
+		return err
+	}
+	statusPath := defaultStatusPath(cachePath, "s3_install.ops")
+	downer := downloader.NewDownloader()
+	var status *downloader.DownloadStatus
+	if cmd.Bool("resume") {
+		status, _ = vmdownloader.IsStatusValid(downer, statusPath)
+	}
+	target, err := vmdownloader.DownloadS3Object(ctx, downer, isoPath, cachePath, statusPath, status, location)
+	if err != nil {
+		return err
+	}
+	fmt.Println("S3 object ready:", target)
+	return nil
+}
+
+func s3ListCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "list",
+		Aliases:   []string{"ls"},
+		Usage:     "List the objects and prefixes under a prefix",
+		ArgsUsage: "<s3://bucket/prefix/>",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			location := strings.TrimSpace(cmd.Args().First())
+			if location == "" {
+				return errors.New("missing S3 location, e.g. s3://isos/")
+			}
+			entries, err := vmdownloader.ListIndex(ctx, downloader.NewDownloader(), location)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				fmt.Println(entry)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/urfave/cli/v3"
+)
+
+func serveCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Serve downloaded images to other hosts on the LAN",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "iso-path",
+				Usage: "Directory with images to serve",
+				Value: defaultISOPath,
+			},
+			&cli.IntFlag{
+				Name:    "port",
+				Usage:   "HTTP listen port",
+				Value:   vmdownloader.DefaultServePort,
+				Aliases: []string{"p"},
+			},
+			&cli.BoolFlag{
+				Name:  "announce",
+				Usage: "Answer LAN discovery broadcasts from other fastpve hosts",
+				Value: true,
+			},
+		},
+		Action: serveImages,
+	}
+}
+
+func serveImages(ctx context.Context, cmd *cli.Command) error {
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	port := int(cmd.Int("port"))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if cmd.Bool("announce") {
+		go func() {
+			if err := vmdownloader.AnnouncePeer(ctx, port); err != nil {
+				log.Println("LAN discovery disabled:", err)
+			}
+		}()
+	}
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort("", strconv.Itoa(port)),
+		Handler: vmdownloader.NewImageServer(isoPath),
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Printf("Serving %s on :%d (manifest: /manifest.json)\n", isoPath, port)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
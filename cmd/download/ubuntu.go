@@ -16,10 +16,13 @@ func ubuntuCommand() *cli.Command {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "version",
-				Usage:   "Ubuntu version: 22.04-desktop, 22.04-server, 24.10-desktop, 24.10-server, 25.04-desktop, 25.04-server",
-				Value:   "22.04-desktop",
+				Usage:   "Ubuntu version, e.g. 24.04, 24.04.2-live-server or noble-server (default: latest LTS desktop)",
 				Aliases: []string{"v"},
 			},
+			&cli.BoolFlag{
+				Name:  "list",
+				Usage: "List the available Ubuntu releases and exit",
+			},
 			&cli.BoolFlag{
 				Name:  "resume",
 				Usage: "Resume from existing status if present",
@@ -32,8 +35,7 @@ func ubuntuCommand() *cli.Command {
 			},
 			&cli.StringFlag{
 				Name:  "cache-path",
-				Usage: "Directory for partial downloads/status files",
-				Value: defaultCachePath,
+				Usage: "Directory for partial downloads/status files (default: template/cache next to the ISO directory)",
 			},
 			&cli.StringFlag{
 				Name:  "status-path",
@@ -45,8 +47,15 @@ func ubuntuCommand() *cli.Command {
 }
 
 func downloadUbuntu(ctx context.Context, cmd *cli.Command) error {
-	isoPath := cmd.String("iso-path")
-	cachePath := cmd.String("cache-path")
+	downer := downloader.NewDownloader()
+	if cmd.Bool("list") {
+		return listUbuntuReleases(ctx, downer)
+	}
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	cachePath := cachePathFor(cmd, isoPath)
 	if err := ensureDirs(isoPath, cachePath); err != nil {
 		return err
 	}
@@ -56,20 +65,34 @@ func downloadUbuntu(ctx context.Context, cmd *cli.Command) error {
 	}
 	resume := cmd.Bool("resume")
 
-	ubuntuVer, err := parseUbuntuVersion(cmd.String("version"))
+	rel, err := vmdownloader.FindUbuntuRelease(ctx, downer, cmd.String("version"))
 	if err != nil {
 		return err
 	}
 
-	downer := downloader.NewDownloader()
 	var status *downloader.DownloadStatus
 	if resume {
 		status, _ = vmdownloader.IsStatusValid(downer, statusPath)
 	}
-	target, err := vmdownloader.DownloadUbuntuISO(ctx, downer, isoPath, cachePath, statusPath, status, ubuntuVer)
+	target, err := vmdownloader.DownloadUbuntuISO(ctx, downer, isoPath, cachePath, statusPath, status, rel)
 	if err != nil {
 		return err
 	}
 	fmt.Println("Ubuntu ISO ready:", target)
 	return nil
 }
+
+func listUbuntuReleases(ctx context.Context, downer *downloader.Downloader) error {
+	releases, err := vmdownloader.DiscoverUbuntuReleases(ctx, downer)
+	if err != nil {
+		return err
+	}
+	for _, u := range releases {
+		line := u.Title()
+		if u.EOL {
+			line += " [EOL]"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
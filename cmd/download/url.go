@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/urfave/cli/v3"
+)
+
+func urlCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "url",
+		Usage:     "Download an ISO from a URL, or copy one from a local path such as a USB stick",
+		ArgsUsage: "<url|path>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "checksum",
+				Usage: "Expected digest, as algo:hex or a bare md5/sha1/sha256/sha512 hex digest",
+			},
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "File name in the ISO directory (default: last element of the URL or path)",
+			},
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Resume from existing status if present and for the same location",
+				Value: true,
+			},
+			&cli.StringFlag{
+				Name:  "iso-path",
+				Usage: "Directory for final ISO",
+				Value: defaultISOPath,
+			},
+			&cli.StringFlag{
+				Name:  "cache-path",
+				Usage: "Directory for partial downloads/status files (default: template/cache next to the ISO directory)",
+			},
+			&cli.StringFlag{
+				Name:  "status-path",
+				Usage: "Override status file path for custom downloads",
+			},
+		},
+		Action: downloadURL,
+	}
+}
+
+func downloadURL(ctx context.Context, cmd *cli.Command) error {
+	if strings.TrimSpace(cmd.Args().First()) == "" {
+		return errors.New("missing URL or path, e.g. https://example.com/os.iso or /mnt/usb/os.iso")
+	}
+	location, err := vmdownloader.CustomLocation(cmd.Args().First())
+	if err != nil {
+		return err
+	}
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	cachePath := cachePathFor(cmd, isoPath)
+	if err := ensureDirs(isoPath, cachePath); err != nil {
+		return err
+	}
+	statusPath := cmd.String("status-path")
+	if statusPath == "" {
+		statusPath = defaultStatusPath(cachePath, "custom_install.ops")
+	}
+	downer := downloader.NewDownloader()
+	var status *downloader.DownloadStatus
+	if cmd.Bool("resume") {
+		status, _ = vmdownloader.IsStatusValid(downer, statusPath)
+	}
+	target, err := vmdownloader.DownloadURL(ctx, downer, isoPath, cachePath, statusPath, status, location, cmd.String("name"), cmd.String("checksum"))
+	if err != nil {
+		return err
+	}
+	fmt.Println("ISO ready:", target)
+	return nil
+}
@@ -14,6 +14,15 @@ func virtioCommand() *cli.Command {
 		Name:  "virtio",
 		Usage: "Download VirtIO driver ISO",
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "channel",
+				Usage: "Driver release: stable or latest",
+				Value: vmdownloader.VirtIOStable,
+			},
+			&cli.StringFlag{
+				Name:  "windows",
+				Usage: "Windows version the drivers are for; older versions get the newest driver that still supports them (" + releaseUsage("windows") + ")",
+			},
 			&cli.BoolFlag{
 				Name:  "resume",
 				Usage: "Resume from existing status if present",
@@ -26,8 +35,7 @@ func virtioCommand() *cli.Command {
 			},
 			&cli.StringFlag{
 				Name:  "cache-path",
-				Usage: "Directory for partial downloads/status files",
-				Value: defaultCachePath,
+				Usage: "Directory for partial downloads/status files (default: template/cache next to the ISO directory)",
 			},
 			&cli.StringFlag{
 				Name:  "status-path",
@@ -39,8 +47,11 @@ func virtioCommand() *cli.Command {
 }
 
 func downloadVirtio(ctx context.Context, cmd *cli.Command) error {
-	isoPath := cmd.String("iso-path")
-	cachePath := cmd.String("cache-path")
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	cachePath := cachePathFor(cmd, isoPath)
 	if err := ensureDirs(isoPath, cachePath); err != nil {
 		return err
 	}
@@ -55,7 +66,19 @@ func downloadVirtio(ctx context.Context, cmd *cli.Command) error {
 	if resume {
 		status, _ = vmdownloader.IsStatusValid(downer, statusPath)
 	}
-	target, err := vmdownloader.DownloadVirtIO(ctx, downer, isoPath, statusPath, status)
+	var maxVersion string
+	if v := cmd.String("windows"); v != "" {
+		version, err := parseWindowsVersion(v)
+		if err != nil {
+			return err
+		}
+		maxVersion = vmdownloader.WindowsVirtIOVersion(version)
+	}
+	rel, err := vmdownloader.VirtIORelease(ctx, downer, cmd.String("channel"), maxVersion)
+	if err != nil {
+		return err
+	}
+	target, err := vmdownloader.DownloadVirtIO(ctx, downer, isoPath, statusPath, status, rel)
 	if err != nil {
 		return err
 	}
@@ -8,7 +8,6 @@ import (
 	"strings"
 
 	"github.com/linkease/fastpve/downloader"
-	"github.com/linkease/fastpve/quickget"
 	"github.com/linkease/fastpve/vmdownloader"
 	"github.com/urfave/cli/v3"
 )
@@ -16,17 +15,17 @@ import (
 func windowsCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "windows",
-		Usage: "Download Windows 7/10/11 ISO",
+		Usage: "Download Windows 7/10/11 or Windows Server ISO",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "version",
-				Usage:   "Windows version: 7, 10 or 11",
+				Usage:   "Windows version: 7, 10, 11, server2025, server2022 or server2019",
 				Value:   "11",
 				Aliases: []string{"v"},
 			},
 			&cli.StringFlag{
 				Name:  "edition",
-				Usage: "Edition language, e.g. \"Chinese (Simplified)\"",
+				Usage: "Edition language, e.g. \"Chinese (Simplified)\"; prefix with \"LTSC \" or \"IoT LTSC \" for the Windows 10/11 LTSC evaluation images (Windows 10 IoT LTSC from GHCR only)",
 				Value: "Chinese (Simplified)",
 			},
 			&cli.BoolFlag{
@@ -46,8 +45,7 @@ func windowsCommand() *cli.Command {
 			},
 			&cli.StringFlag{
 				Name:  "cache-path",
-				Usage: "Directory for partial downloads/status files",
-				Value: defaultCachePath,
+				Usage: "Directory for partial downloads/status files (default: template/cache next to the ISO directory)",
 			},
 			&cli.StringFlag{
 				Name:  "status-path",
@@ -58,13 +56,89 @@ func windowsCommand() *cli.Command {
 				Usage: "Override status file path for VirtIO",
 			},
 		},
-		Action: downloadWindows,
+		Action:   downloadWindows,
+		Commands: []*cli.Command{windowsLanguagesCommand(), windowsEditionsCommand()},
+	}
+}
+
+func windowsLanguagesCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "languages",
+		Usage: "List the languages Microsoft offers a Windows version in",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "version",
+				Usage:   "Windows version: 10, 11, server2025, server2022 or server2019",
+				Value:   "11",
+				Aliases: []string{"v"},
+			},
+			&cli.StringFlag{
+				Name:  "kind",
+				Usage: "Image kind: \"\" for the retail image, \"ltsc\" or \"iot-ltsc\" for the evaluation images",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			version, err := parseWindowsVersion(cmd.String("version"))
+			if err != nil {
+				return err
+			}
+			var prefix string
+			switch kind := strings.ToLower(strings.TrimSpace(cmd.String("kind"))); kind {
+			case "":
+			case "ltsc":
+				prefix = "LTSC "
+			case "iot-ltsc":
+				prefix = "IoT LTSC "
+			default:
+				return fmt.Errorf("unknown image kind: %s", kind)
+			}
+			languages, err := vmdownloader.WindowsLanguages(ctx, downloader.NewDownloader(), version, prefix)
+			if err != nil {
+				return err
+			}
+			for _, language := range languages {
+				fmt.Printf("%q\n", prefix+language)
+			}
+			return nil
+		},
+	}
+}
+
+func windowsEditionsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "editions",
+		Usage: "List the editions offered for a Windows version (catalog editions, then the languages quickget knows)",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "version",
+				Usage:   "Windows version: 7, 10, 11, server2025, server2022 or server2019",
+				Value:   "11",
+				Aliases: []string{"v"},
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			version, err := parseWindowsVersion(cmd.String("version"))
+			if err != nil {
+				return err
+			}
+			editions, err := vmdownloader.WindowsEditions(ctx, version)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "quickget list failed, showing catalog editions:", err)
+			}
+			for _, edition := range editions {
+				fmt.Printf("%q\n", edition)
+			}
+			return nil
+		},
 	}
 }
 
 func downloadWindows(ctx context.Context, cmd *cli.Command) error {
-	isoPath := cmd.String("iso-path")
-	cachePath := cmd.String("cache-path")
+	isoPath, err := isoPathFor(cmd)
+	if err != nil {
+		return err
+	}
+	cachePath := cachePathFor(cmd, isoPath)
 	if err := ensureDirs(isoPath, cachePath); err != nil {
 		return err
 	}
@@ -97,13 +171,7 @@ func downloadWindows(ctx context.Context, cmd *cli.Command) error {
 		status, _ = vmdownloader.IsStatusValid(downer, statusPath)
 	}
 
-	quickGet, err := quickget.CreateQuickGet()
-	if err != nil {
-		return err
-	}
-	defer os.Remove(quickGet)
-
-	target, err := vmdownloader.DownloadWindowsISO(ctx, downer, quickGet, isoPath, statusPath, status, version, edition)
+	target, err := vmdownloader.DownloadWindowsISO(ctx, downer, isoPath, statusPath, status, version, edition)
 	if err != nil {
 		return err
 	}
@@ -114,7 +182,11 @@ func downloadWindows(ctx context.Context, cmd *cli.Command) error {
 		if resume {
 			virtStatus, _ = vmdownloader.IsStatusValid(downer, virtStatusPath)
 		}
-		virtTarget, err := vmdownloader.DownloadVirtIO(ctx, downer, isoPath, virtStatusPath, virtStatus)
+		rel, err := vmdownloader.VirtIORelease(ctx, downer, vmdownloader.VirtIOStable, vmdownloader.WindowsVirtIOVersion(version))
+		if err != nil {
+			return err
+		}
+		virtTarget, err := vmdownloader.DownloadVirtIO(ctx, downer, isoPath, virtStatusPath, virtStatus, rel)
 		if err != nil {
 			return fmt.Errorf("virtio download failed: %w", err)
 		}
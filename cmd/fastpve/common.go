@@ -1,9 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/linkease/fastpve/catalog"
 	"github.com/linkease/fastpve/utils"
 	"github.com/manifoldco/promptui"
 )
@@ -56,6 +58,34 @@ func promptPVEMemory() (int, error) {
 		10)
 }
 
+// promptPVEHardware offers the catalog recommendation first and falls back to the individual prompts.
+func promptPVEHardware(hw catalog.Hardware) (cores, memory, disk int, err error) {
+	if hw.Cores > 0 && hw.Memory > 0 && hw.Disk > 0 {
+		prompt := promptui.Select{
+			Label: "虚拟机配置：",
+			Items: []string{
+				fmt.Sprintf("推荐配置（CPU：%d核,内存：%dMB,硬盘：%dGB）", hw.Cores, hw.Memory, hw.Disk),
+				"自定义配置",
+			},
+		}
+		idx, _, err := prompt.Run()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if idx == 0 {
+			return hw.Cores, hw.Memory, hw.Disk, nil
+		}
+	}
+	if cores, err = promptPVECore(); err != nil {
+		return
+	}
+	if memory, err = promptPVEMemory(); err != nil {
+		return
+	}
+	disk, err = promptPVEDisk()
+	return
+}
+
 func promptPVEDisk() (int, error) {
 	disks := []string{"64GB", "128GB", "256GB", "512GB", "1TB", "自定义（GB）"}
 	return selectNumber("选择硬盘",
@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/vmdownloader"
 	"github.com/urfave/cli/v2"
 )
 
@@ -13,6 +15,16 @@ func main() {
 		Name:  "fastpve",
 		Usage: "Fast install systems on pve!",
 		Action: func(c *cli.Context) error {
+			vmdownloader.SetLANPeers([]string{os.Getenv("FASTPVE_PEERS")})
+			vmdownloader.SetGHCRNamespace(os.Getenv("FASTPVE_GHCR_NAMESPACE"))
+			if src := os.Getenv("FASTPVE_CATALOG"); src != "" {
+				cat, err := catalog.Load(c.Context, newDownloader().DefaultClient(), src)
+				if err != nil {
+					log.Println("加载镜像目录失败，使用内置目录:", err)
+				} else {
+					catalog.SetCurrent(cat)
+				}
+			}
 			return mainPrompt()
 		},
 		Commands: []*cli.Command{
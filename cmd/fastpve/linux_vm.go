@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/linkease/fastpve/quickget"
+	"github.com/linkease/fastpve/utils"
+)
+
+// linuxISOVM describes a UEFI VM that boots a Linux installer ISO from a PVE storage.
+type linuxISOVM struct {
+	Name       string
+	ISOStorage *quickget.ISOStorage
+	ISO        string // file name inside the ISO storage
+	Cores      int
+	Memory     int
+	Disk       int
+	// DataDisks are extra disks after the system disk: a size in GB on the VM
+	// storage, or a host disk path for passthrough.
+	DataDisks []dataDisk
+}
+
+type dataDisk struct {
+	SizeGB int
+	Device string // /dev/disk/by-id path of a passed through host disk
+}
+
+func (d dataDisk) volume(useDisk string) string {
+	if d.Device != "" {
+		return d.Device
+	}
+	return fmt.Sprintf("%s:%d", useDisk, d.SizeGB)
+}
+
+// diskImageVM describes a VM whose system disk is imported from an image, such as
+// iStoreOS, OpenWrt or Home Assistant OS, with an optional extra data disk.
+type diskImageVM struct {
+	Name      string
+	ImagePath string
+	Cores     int
+	Memory    int
+	Disk      int // data disk in GB, 0 for none
+	// SystemDisk grows the imported disk to this size in GB; 0 keeps the image size.
+	SystemDisk int
+	// Legacy boots with SeaBIOS instead of OVMF, for non-EFI images.
+	Legacy bool
+	// USBDevices are host vendor:product ids passed through to the VM.
+	USBDevices []string
+}
+
+// vmDiskAndID picks the storage for VM disks (local-lvm when present) and the next free VMID.
+func vmDiskAndID() (string, int, error) {
+	disks, err := quickget.DiskStatus()
+	if err != nil {
+		return "", 0, err
+	}
+	useDisk := "local"
+	if len(disks) > 0 {
+		useDisk = disks[0]
+	}
+	for _, disk := range disks {
+		if disk == "local-lvm" {
+			useDisk = "local-lvm"
+			break
+		}
+	}
+
+	items, err := quickget.QMList()
+	if err != nil {
+		return "", 0, err
+	}
+	vmid := 100
+	if len(items) > 0 {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].VMID < items[j].VMID
+		})
+		vmid = items[len(items)-1].VMID + 1
+	}
+	return useDisk, vmid, nil
+}
+
+func createLinuxISOVM(ctx context.Context, vm *linuxISOVM) error {
+	useDisk, vmid, err := vmDiskAndID()
+	if err != nil {
+		return err
+	}
+	scripts := []string{
+		"set -e",
+		`export LC_ALL="en_US.UTF-8"`,
+		fmt.Sprintf("export VMID=%d", vmid),
+		fmt.Sprintf(`qm create $VMID --name "%s" --memory %d --scsihw virtio-scsi-single --cores %d --sockets 1 --machine q35 --bios ovmf --cpu host --net0 virtio,bridge=vmbr0`,
+			vm.Name,
+			vm.Memory,
+			vm.Cores),
+		fmt.Sprintf("qm set $VMID -efidisk0 %s:1,format=raw,efitype=4m", useDisk),
+		fmt.Sprintf("qm set $VMID --scsi0 %s:%d", useDisk, vm.Disk),
+		fmt.Sprintf(`qm set $VMID --ide0 %s`, utils.ShellQuote(vm.ISOStorage.VolumeID(vm.ISO)+",media=cdrom")),
+	}
+	for i, d := range vm.DataDisks {
+		scripts = append(scripts, fmt.Sprintf("qm set $VMID --scsi%d %s", i+1, d.volume(useDisk)))
+	}
+	scripts = append(scripts,
+		`qm set $VMID --boot order='scsi0;ide0'`,
+		`qm set $VMID --agent enabled=1,fstrim_cloned_disks=1`,
+		`qm set $VMID --ostype l26`,
+		`echo "VMOK"`,
+	)
+	//fmt.Println(strings.Join(scripts, "\n"))
+	out, err := utils.BatchOutput(ctx, scripts, 0)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(out), "VMOK") {
+		fmt.Println("创建虚拟机：", vmid, "成功，请到网页端启动虚拟机并继续安装系统")
+		return nil
+	}
+	return errors.New("VM creation failed")
+}
+
+func createDiskImageVM(ctx context.Context, vm *diskImageVM) error {
+	useDisk, vmid, err := vmDiskAndID()
+	if err != nil {
+		return err
+	}
+	bios := "ovmf"
+	if vm.Legacy {
+		bios = "seabios"
+	}
+	scripts := []string{
+		"set -e",
+		`export LC_ALL="en_US.UTF-8"`,
+		fmt.Sprintf("export VMID=%d", vmid),
+		fmt.Sprintf(`qm create $VMID --name "%s" --memory %d --scsihw virtio-scsi-single --cores %d --sockets 1 --machine q35 --bios %s --cpu host --net0 virtio,bridge=vmbr0`,
+			vm.Name,
+			vm.Memory,
+			vm.Cores,
+			bios),
+	}
+	if !vm.Legacy {
+		scripts = append(scripts, fmt.Sprintf("qm set $VMID -efidisk0 %s:1,format=raw,efitype=4m", useDisk))
+	}
+	scripts = append(scripts,
+		fmt.Sprintf("qm set $VMID --scsi0 %s", utils.ShellQuote(fmt.Sprintf("%s:0,import-from=%s", useDisk, vm.ImagePath))),
+	)
+	if vm.SystemDisk > 0 {
+		// qm refuses to shrink, so an image already larger than requested is kept as is.
+		scripts = append(scripts, fmt.Sprintf("qm resize $VMID scsi0 %dG || true", vm.SystemDisk))
+	}
+	if vm.Disk > 0 {
+		scripts = append(scripts, fmt.Sprintf(`qm set $VMID  --scsi1 %s:%d`, useDisk, vm.Disk))
+	}
+	for i, id := range vm.USBDevices {
+		scripts = append(scripts, fmt.Sprintf("qm set $VMID --usb%d host=%s", i, id))
+	}
+	scripts = append(scripts,
+		`qm set $VMID --boot order='scsi0'`,
+		`qm set $VMID  --ostype l26`,
+		`echo "VMOK"`,
+	)
+	//fmt.Println(strings.Join(scripts, "\n"))
+	out, err := utils.BatchOutput(ctx, scripts, 0)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(out), "VMOK") {
+		return errors.New("VM creation failed")
+	}
+	fmt.Println("创建虚拟机：", vmid, "成功")
+	return nil
+}
+
+// cloudImageVM describes a VM imported from a cloud image and configured by cloud-init.
+type cloudImageVM struct {
+	Name      string
+	ImagePath string
+	Cores     int
+	Memory    int
+	Disk      int // the imported disk is grown to this size in GB
+	CloudInit *cloudInitConfig
+}
+
+func createCloudImageVM(ctx context.Context, vm *cloudImageVM) error {
+	useDisk, vmid, err := vmDiskAndID()
+	if err != nil {
+		return err
+	}
+	ci := vm.CloudInit
+	scripts := []string{
+		"set -e",
+		`export LC_ALL="en_US.UTF-8"`,
+		fmt.Sprintf("export VMID=%d", vmid),
+		fmt.Sprintf(`qm create $VMID --name "%s" --memory %d --scsihw virtio-scsi-single --cores %d --sockets 1 --machine q35 --cpu host --net0 virtio,bridge=vmbr0`,
+			vm.Name,
+			vm.Memory,
+			vm.Cores),
+		fmt.Sprintf("qm set $VMID --scsi0 %s", utils.ShellQuote(fmt.Sprintf("%s:0,import-from=%s,discard=on", useDisk, vm.ImagePath))),
+		// qm refuses to shrink, so an image already larger than requested is kept as is.
+		fmt.Sprintf("qm resize $VMID scsi0 %dG || true", vm.Disk),
+		fmt.Sprintf("qm set $VMID --ide2 %s:cloudinit", useDisk),
+		`qm set $VMID --boot order='scsi0'`,
+		`qm set $VMID --serial0 socket --vga serial0`,
+		`qm set $VMID --agent enabled=1,fstrim_cloned_disks=1`,
+		`qm set $VMID --ostype l26`,
+		fmt.Sprintf("qm set $VMID --ciuser %s", utils.ShellQuote(ci.User)),
+		fmt.Sprintf("qm set $VMID --ipconfig0 %s", utils.ShellQuote(ci.IPConfig)),
+	}
+	if ci.Password != "" {
+		scripts = append(scripts, fmt.Sprintf("qm set $VMID --cipassword %s", utils.ShellQuote(ci.Password)))
+	}
+	if ci.SSHKeys != "" {
+		f, err := os.CreateTemp("", "fastpve-sshkeys-*.pub")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.WriteString(ci.SSHKeys); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		scripts = append(scripts, fmt.Sprintf("qm set $VMID --sshkeys %s", f.Name()))
+	}
+	if ci.Template {
+		scripts = append(scripts, `qm template $VMID`)
+	}
+	scripts = append(scripts, `echo "VMOK"`)
+	//fmt.Println(strings.Join(scripts, "\n"))
+	out, err := utils.BatchOutput(ctx, scripts, 0)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(out), "VMOK") {
+		return errors.New("VM creation failed")
+	}
+	if ci.Template {
+		fmt.Println("创建模板：", vmid, "成功，可在网页端克隆出新的虚拟机")
+	} else {
+		fmt.Println("创建虚拟机：", vmid, "成功，启动后即可使用", ci.User, "登录")
+	}
+	return nil
+}
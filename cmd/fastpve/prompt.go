@@ -17,6 +17,14 @@ const (
 	selectInstallWindows
 	selectInstallUbuntu
 	selectOneClickGPUPassThrough // 新增
+	selectInstallDebian
+	selectInstallRHEL
+	selectInstallOpenWrt
+	selectInstallNAS
+	selectInstallHAOS
+	selectInstallCloudImage
+	selectInstallQuickget
+	selectInstallCustomISO
 )
 
 const (
@@ -33,8 +41,16 @@ var (
 		"3、安装Windows":  selectInstallWindows,
 		"4、安装Ubuntu":   selectInstallUbuntu,
 		// 目前只做Intel核显直通
-		"5、一键核显直通": selectOneClickGPUPassThrough,
-		"q、退出":     selectQuit,
+		"5、一键核显直通":                            selectOneClickGPUPassThrough,
+		"6、安装Debian":                          selectInstallDebian,
+		"7、安装Rocky/Alma/CentOS Stream/Fedora": selectInstallRHEL,
+		"8、安装OpenWrt/ImmortalWrt":             selectInstallOpenWrt,
+		"9、安装NAS系统（TrueNAS/OMV/飞牛）":           selectInstallNAS,
+		"a、安装Home Assistant OS":               selectInstallHAOS,
+		"b、更多系统（quickget）":                    selectInstallQuickget,
+		"c、自定义镜像（URL/本地路径）":                   selectInstallCustomISO,
+		"d、云镜像模板（cloud-init）":                 selectInstallCloudImage,
+		"q、退出":                                selectQuit,
 	}
 )
 
@@ -104,6 +120,54 @@ MAINLOOP:
 				continue MAINLOOP
 			}
 			return err
+		case selectInstallDebian:
+			err = promptForDebian()
+			if err == errContinue {
+				continue MAINLOOP
+			}
+			return err
+		case selectInstallRHEL:
+			err = promptForRHEL()
+			if err == errContinue {
+				continue MAINLOOP
+			}
+			return err
+		case selectInstallOpenWrt:
+			err = promptForOpenWrt()
+			if err == errContinue {
+				continue MAINLOOP
+			}
+			return err
+		case selectInstallNAS:
+			err = promptForNAS()
+			if err == errContinue {
+				continue MAINLOOP
+			}
+			return err
+		case selectInstallHAOS:
+			err = promptForHAOS()
+			if err == errContinue {
+				continue MAINLOOP
+			}
+			return err
+		case selectInstallCloudImage:
+			err = promptForCloudImage()
+			if err == errContinue {
+				continue MAINLOOP
+			}
+			return err
+		case selectInstallQuickget:
+			err = promptForQuickget()
+			if err == errContinue {
+				continue MAINLOOP
+			}
+			return err
+		case selectInstallCustomISO:
+			err = promptForCustomISO()
+			if err == errContinue {
+				continue MAINLOOP
+			}
+			return err
 		case selectOneClickGPUPassThrough:
 			err = promptForGPUPassThrough()
 			if err == errContinue {
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+)
+
+var cloudOSIDs = []string{"ubuntu-cloud", "debian-cloud", "rocky-cloud"}
+
+// cloudInitConfig is applied to the cloudinit drive of a cloud image VM.
+type cloudInitConfig struct {
+	User     string `json:"user"`
+	Password string `json:"-"`
+	SSHKeys  string `json:"-"`
+	// IPConfig is the ipconfig0 value, e.g. "ip=dhcp" or "ip=192.168.1.20/24,gw=192.168.1.1".
+	IPConfig string `json:"ipConfig"`
+	Template bool   `json:"template"`
+}
+
+func promptForCloudImage() error {
+	return promptForOSChoice(cloudOSIDs)
+}
+
+// defaultCloudUser is the account the distribution images create by default.
+func defaultCloudUser(osID string) string {
+	switch osID {
+	case "ubuntu-cloud":
+		return "ubuntu"
+	case "debian-cloud":
+		return "debian"
+	case "rocky-cloud":
+		return "rocky"
+	}
+	return "root"
+}
+
+func promptCloudInit(osID string) (*cloudInitConfig, error) {
+	cfg := &cloudInitConfig{}
+	prompt := promptui.Prompt{
+		Label:   "登录用户名",
+		Default: defaultCloudUser(osID),
+		Validate: func(input string) error {
+			if strings.TrimSpace(input) == "" {
+				return errors.New("用户名不能为空")
+			}
+			return nil
+		},
+	}
+	user, err := prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+	cfg.User = strings.TrimSpace(user)
+
+	auth := promptui.Select{
+		Label: "登录方式：",
+		Items: []string{"密码", "SSH公钥", "密码和SSH公钥"},
+	}
+	idx, _, err := auth.Run()
+	if err != nil {
+		return nil, err
+	}
+	if idx == 0 || idx == 2 {
+		if cfg.Password, err = promptCloudPassword(); err != nil {
+			return nil, err
+		}
+	}
+	if idx == 1 || idx == 2 {
+		if cfg.SSHKeys, err = promptSSHKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.IPConfig, err = promptIPConfig(); err != nil {
+		return nil, err
+	}
+
+	tmpl := promptui.Select{
+		Label: "创建完成后转换为模板？",
+		Items: []string{"否，直接创建虚拟机", "是，转换为模板（之后可克隆）"},
+	}
+	idx, _, err = tmpl.Run()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Template = idx == 1
+	return cfg, nil
+}
+
+func promptCloudPassword() (string, error) {
+	prompt := promptui.Prompt{
+		Label: "登录密码",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if len(input) < 6 {
+				return errors.New("密码至少6位")
+			}
+			return nil
+		},
+	}
+	return prompt.Run()
+}
+
+// promptSSHKeys accepts a public key or a file of keys, defaulting to the host's authorized_keys.
+func promptSSHKeys() (string, error) {
+	def := ""
+	if _, err := os.Stat("/root/.ssh/authorized_keys"); err == nil {
+		def = "/root/.ssh/authorized_keys"
+	}
+	prompt := promptui.Prompt{
+		Label:   "SSH公钥或公钥文件路径",
+		Default: def,
+		Validate: func(input string) error {
+			_, err := readSSHKeys(input)
+			return err
+		},
+	}
+	input, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	return readSSHKeys(input)
+}
+
+func readSSHKeys(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "ssh-") || strings.HasPrefix(input, "ecdsa-") {
+		return input + "\n", nil
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return "", errors.New("不是公钥，也无法读取公钥文件")
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", errors.New("公钥文件为空")
+	}
+	return string(data), nil
+}
+
+func promptIPConfig() (string, error) {
+	sel := promptui.Select{
+		Label: "网络配置：",
+		Items: []string{"DHCP自动获取", "静态IP"},
+	}
+	idx, _, err := sel.Run()
+	if err != nil {
+		return "", err
+	}
+	if idx == 0 {
+		return "ip=dhcp", nil
+	}
+	ipPrompt := promptui.Prompt{
+		Label: "IP地址（CIDR格式，如 192.168.1.20/24）",
+		Validate: func(input string) error {
+			_, _, err := net.ParseCIDR(strings.TrimSpace(input))
+			return err
+		},
+	}
+	ip, err := ipPrompt.Run()
+	if err != nil {
+		return "", err
+	}
+	gwPrompt := promptui.Prompt{
+		Label: "网关",
+		Validate: func(input string) error {
+			if net.ParseIP(strings.TrimSpace(input)) == nil {
+				return fmt.Errorf("无效的网关地址: %s", input)
+			}
+			return nil
+		},
+	}
+	gw, err := gwPrompt.Run()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ip=%s,gw=%s", strings.TrimSpace(ip), strings.TrimSpace(gw)), nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSSHKeys(t *testing.T) {
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample user@host"
+	if got, err := readSSHKeys("  " + key + " "); err != nil || got != key+"\n" {
+		t.Fatalf("readSSHKeys(key) = %q, %v", got, err)
+	}
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := os.WriteFile(path, []byte(key+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readSSHKeys(path); err != nil || got != key+"\n" {
+		t.Fatalf("readSSHKeys(file) = %q, %v", got, err)
+	}
+	if _, err := readSSHKeys(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("expected error for missing key file")
+	}
+}
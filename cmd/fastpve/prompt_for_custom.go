@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/linkease/fastpve/utils"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/manifoldco/promptui"
+)
+
+// promptForCustomISO downloads an ISO from a URL the user enters, or copies it from a
+// local path such as a USB stick, then creates a VM from it.
+func promptForCustomISO() error {
+	isoStorage, err := promptISOStorage()
+	if err != nil {
+		return err
+	}
+	isoPath := isoStorage.ISOPath()
+	cachePath, err := storageCachePath(isoStorage)
+	if err != nil {
+		return err
+	}
+	downer := newDownloader()
+	statusPath := filepath.Join(cachePath, "custom_install.ops")
+	status, _ := vmdownloader.IsStatusValid(downer, statusPath)
+
+	var location, checksum string
+	if status != nil {
+		name := strings.TrimSuffix(filepath.Base(status.TargetFile), ".syn")
+		progress := status.Curr * 100 / (status.TotalSize + 1)
+		prompt := promptui.Select{
+			Label: "选择镜像",
+			Items: []string{fmt.Sprintf("继续下载 %s(%02d%%)", name, progress), "输入新的镜像地址"},
+		}
+		idx, _, err := prompt.Run()
+		if err != nil {
+			return err
+		}
+		if idx == 0 {
+			location = status.Url
+		}
+	}
+	if location == "" {
+		location, checksum, err = promptCustomLocation()
+		if err != nil {
+			return err
+		}
+	}
+
+	info := &releaseInstallInfo{
+		ISOStorage: isoStorage.Name,
+		ISO:        vmdownloader.CustomFileName(location),
+	}
+	info.Cores, info.Memory, info.Disk, err = promptPVEHardware(genericHardware)
+	if err != nil {
+		return err
+	}
+	fmt.Println("install=", utils.ToString(info))
+	next, err := promptReleaseDownloadInstall(info, true)
+	if err != nil {
+		return err
+	}
+	if !next {
+		return nil
+	}
+
+	ctx := context.TODO()
+	info.ISO, err = vmdownloader.DownloadURL(ctx, downer, isoPath, cachePath, statusPath, status, location, "", checksum)
+	if err != nil {
+		return err
+	}
+	if info.DownloadOnly {
+		return nil
+	}
+	imgName := filepath.Base(info.ISO)
+	if !strings.EqualFold(filepath.Ext(imgName), ".iso") {
+		fmt.Println("下载的文件不是 ISO，请手动创建虚拟机:", info.ISO)
+		return nil
+	}
+	return createLinuxISOVM(ctx, &linuxISOVM{
+		Name:       toBetterUbuntuName(imgName),
+		ISOStorage: isoStorage,
+		ISO:        imgName,
+		Cores:      info.Cores,
+		Memory:     info.Memory,
+		Disk:       info.Disk,
+	})
+}
+
+// promptCustomLocation asks for the URL or local path of an ISO and its optional checksum.
+func promptCustomLocation() (location, checksum string, err error) {
+	prompt := promptui.Prompt{
+		Label: "镜像地址（http(s) URL，或本地路径如 /mnt/usb/xxx.iso）",
+		Validate: func(input string) error {
+			location, err := vmdownloader.CustomLocation(input)
+			if err != nil {
+				return err
+			}
+			if vmdownloader.CustomFileName(location) == "" {
+				return errors.New("无法从地址中得到文件名，文件名只能包含字母、数字和 ._+-")
+			}
+			return nil
+		},
+	}
+	input, err := prompt.Run()
+	if err != nil {
+		return "", "", err
+	}
+	location, err = vmdownloader.CustomLocation(input)
+	if err != nil {
+		return "", "", err
+	}
+	prompt = promptui.Prompt{
+		Label: "校验值（可选，如 sha256:xxx 或直接粘贴摘要，回车跳过）",
+		Validate: func(input string) error {
+			_, err := vmdownloader.ParseExpectedChecksum(input)
+			return err
+		},
+	}
+	checksum, err = prompt.Run()
+	if err != nil {
+		return "", "", err
+	}
+	return location, strings.TrimSpace(checksum), nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/utils"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/manifoldco/promptui"
+)
+
+type debianInstallInfo struct {
+	ISOStorage   string `json:"isoStorage"`
+	DebianISO    string `json:"debianISO"`
+	DebianVer    string `json:"debianVer"`
+	Memory       int    `json:"memory"`
+	Cores        int    `json:"cores"`
+	Disk         int    `json:"disk"`
+	DownloadOnly bool   `json:"downloadOnly"`
+}
+
+var debianChoices = []struct {
+	Spec  string
+	Label string
+}{
+	{"stable-netinst", "稳定版 网络安装"},
+	{"stable-dvd", "稳定版 DVD"},
+	{"oldstable-netinst", "旧稳定版 网络安装"},
+	{"oldstable-dvd", "旧稳定版 DVD"},
+}
+
+func promptForDebian() error {
+	isoStorage, err := promptISOStorage()
+	if err != nil {
+		return err
+	}
+	isoPath := isoStorage.ISOPath()
+	cachePath, err := storageCachePath(isoStorage)
+	if err != nil {
+		return err
+	}
+	downer := newDownloader()
+	statusPath := filepath.Join(cachePath, "debian_install.ops")
+	status, _ := vmdownloader.IsStatusValid(downer, statusPath)
+
+	var debianISOs []string
+	dirs, err := os.ReadDir(isoPath)
+	if err == nil {
+		debianISOs = getDebianISO(dirs)
+	}
+
+	debianOS, err := catalog.Current().FindOS("debian")
+	if err != nil {
+		return err
+	}
+	info := &debianInstallInfo{
+		ISOStorage: isoStorage.Name,
+	}
+
+	ctx := context.TODO()
+	var releases []*catalog.Release
+	for _, c := range debianChoices {
+		rel, err := vmdownloader.FindDebianRelease(ctx, downer, c.Spec)
+		if err != nil {
+			return err
+		}
+		releases = append(releases, rel)
+	}
+	err = promptDebianFiles(info, status, debianISOs, releases)
+	if err != nil {
+		return err
+	}
+	hw := debianOS.HardwareProfile()
+	var rel *catalog.Release
+	for i, c := range debianChoices {
+		if c.Spec == info.DebianVer {
+			rel = releases[i]
+			hw = rel.HardwareProfile()
+		}
+	}
+	info.Cores, info.Memory, info.Disk, err = promptPVEHardware(hw)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("install=", utils.ToString(info))
+	var needDownload bool
+	if (status != nil && info.DebianISO == status.TargetFile) ||
+		rel != nil {
+		needDownload = true
+	}
+	next, err := promptDebianDownloadInstall(info, needDownload)
+	if err != nil {
+		return err
+	}
+	if !next {
+		return nil
+	}
+
+	if status != nil && info.DebianISO == status.TargetFile {
+		// Continue download target file
+		info.DebianISO, err = vmdownloader.DownloadDebianISO(ctx, downer, isoPath, cachePath, statusPath, status, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if rel != nil {
+		info.DebianISO, err = vmdownloader.DownloadDebianISO(ctx, downer, isoPath, cachePath, statusPath, nil, rel)
+		if err != nil {
+			return err
+		}
+	}
+	if info.DownloadOnly {
+		return nil
+	}
+
+	imgName := filepath.Base(info.DebianISO)
+	return createLinuxISOVM(ctx, &linuxISOVM{
+		Name:       toBetterUbuntuName(imgName),
+		ISOStorage: isoStorage,
+		ISO:        imgName,
+		Cores:      info.Cores,
+		Memory:     info.Memory,
+		Disk:       info.Disk,
+	})
+}
+
+func promptDebianFiles(info *debianInstallInfo, status *downloader.DownloadStatus, debianISOs []string, releases []*catalog.Release) error {
+	origLen := len(debianISOs)
+	if status != nil {
+		name := filepath.Base(status.TargetFile)
+		name = strings.TrimSuffix(name, ".syn")
+		progress := status.Curr * 100 / (status.TotalSize + 1)
+		name = fmt.Sprintf("继续下载 %s(%02d%%)", name, progress)
+		debianISOs = append(debianISOs, name)
+	}
+	startNew := len(debianISOs)
+	for i, c := range debianChoices {
+		debianISOs = append(debianISOs, fmt.Sprintf("全新下载 %s（%s）", releases[i].Name, c.Label))
+	}
+	prompt := promptui.Select{
+		Label: "选择Debian安装文件",
+		Items: debianISOs,
+	}
+	idx, file, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+	if idx < origLen {
+		info.DebianISO = file
+	} else if status != nil && idx == origLen {
+		info.DebianISO = status.TargetFile
+	} else if idx >= startNew {
+		info.DebianVer = debianChoices[idx-startNew].Spec
+	}
+	return nil
+}
+
+func getDebianISO(dirs []os.DirEntry) []string {
+	var isoFiles []string
+	for _, dir := range dirs {
+		if !dir.IsDir() &&
+			strings.HasPrefix(dir.Name(), "debian-") &&
+			filepath.Ext(dir.Name()) == ".iso" {
+			isoFiles = append(isoFiles, dir.Name())
+		}
+	}
+	return isoFiles
+}
+
+func promptDebianDownloadInstall(info *debianInstallInfo, needDownload bool) (bool, error) {
+	var items []string
+	if needDownload {
+		items = []string{"下载并安装", "仅下载", "退出"}
+	} else {
+		items = []string{"安装", "退出"}
+	}
+	prompt := promptui.Select{
+		Label: fmt.Sprintf("选择完成，继续安装%s：（CPU：%d,内存：%dMB,硬盘：%dGB）",
+			filepath.Base(info.DebianISO),
+			info.Cores,
+			info.Memory,
+			info.Disk),
+		Items: items,
+	}
+	idx, _, err := prompt.Run()
+	if err != nil {
+		return false, err
+	}
+	if idx == 0 {
+		return true, nil
+	}
+	if needDownload && idx == 1 {
+		info.DownloadOnly = true
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/linkease/fastpve/quickget"
+	"github.com/manifoldco/promptui"
+)
+
+const haosOSID = "haos"
+
+func promptForHAOS() error {
+	return promptForReleaseISO(haosOSID)
+}
+
+// promptUSBDevices offers the host USB devices, Zigbee/Z-Wave dongles first, for passthrough.
+func promptUSBDevices() ([]string, error) {
+	devices, err := quickget.USBDevices()
+	if err != nil {
+		fmt.Println("获取USB设备列表失败，跳过USB直通:", err)
+		return nil, nil
+	}
+	var sorted []*quickget.USBDevice
+	for _, zigbee := range []bool{true, false} {
+		for _, dev := range devices {
+			if dev.Zigbee == zigbee {
+				sorted = append(sorted, dev)
+			}
+		}
+	}
+	var ids []string
+	used := make(map[string]bool)
+	for {
+		items := []string{"完成"}
+		var choices []*quickget.USBDevice
+		for _, dev := range sorted {
+			if used[dev.ID] {
+				continue
+			}
+			label := fmt.Sprintf("直通USB设备 %s %s", dev.ID, dev.Name)
+			if dev.Zigbee {
+				label += "（Zigbee/Z-Wave）"
+			}
+			items = append(items, label)
+			choices = append(choices, dev)
+		}
+		if len(choices) == 0 {
+			return ids, nil
+		}
+		prompt := promptui.Select{
+			Label: fmt.Sprintf("选择要直通的USB设备（已选%d个）：", len(ids)),
+			Items: items,
+		}
+		idx, _, err := prompt.Run()
+		if err != nil {
+			return nil, err
+		}
+		if idx == 0 {
+			return ids, nil
+		}
+		dev := choices[idx-1]
+		used[dev.ID] = true
+		ids = append(ids, dev.ID)
+	}
+}
@@ -2,28 +2,21 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 
+	"github.com/linkease/fastpve/catalog"
 	"github.com/linkease/fastpve/downloader"
-	"github.com/linkease/fastpve/quickget"
 	"github.com/linkease/fastpve/utils"
 	"github.com/linkease/fastpve/vmdownloader"
 	"github.com/manifoldco/promptui"
 )
 
-const (
-	Istore2410 = iota
-	Istore2203
-)
-
 type istoreInstallInfo struct {
 	IstoreIMG    string `json:"istoreIMG"`
-	IstoreVer    int    `json:"istoreVer"`
+	IstoreVer    string `json:"istoreVer"`
 	Memory       int    `json:"memory"`
 	Cores        int    `json:"cores"`
 	Disk         int    `json:"disk"`
@@ -31,8 +24,15 @@ type istoreInstallInfo struct {
 }
 
 func promptForIstore() error {
-	isoPath := "/var/lib/vz/template/iso/"
-	cachePath := "/var/lib/vz/template/cache"
+	isoStorage, err := promptISOStorage()
+	if err != nil {
+		return err
+	}
+	isoPath := isoStorage.ISOPath()
+	cachePath, err := storageCachePath(isoStorage)
+	if err != nil {
+		return err
+	}
 	downer := newDownloader()
 	statusPath := filepath.Join(cachePath, "istore_install.ops")
 	status, _ := vmdownloader.IsStatusValid(downer, statusPath)
@@ -43,23 +43,26 @@ func promptForIstore() error {
 		istoreIMGs = getIstoreIMG(dirs)
 	}
 
-	info := &istoreInstallInfo{
-		IstoreVer: -1,
-	}
-
-	err = promptIstoreFiles(info, status, istoreIMGs)
+	istoreOS, err := catalog.Current().FindOS("istoreos")
 	if err != nil {
 		return err
 	}
-	info.Cores, err = promptPVECore()
+	info := &istoreInstallInfo{}
+
+	err = promptIstoreFiles(info, status, istoreIMGs, istoreOS.Releases)
 	if err != nil {
 		return err
 	}
-	info.Memory, err = promptPVEMemory()
-	if err != nil {
-		return err
+	hw := istoreOS.HardwareProfile()
+	var rel *catalog.Release
+	if info.IstoreVer != "" {
+		rel, err = istoreOS.FindRelease(info.IstoreVer)
+		if err != nil {
+			return err
+		}
+		hw = rel.HardwareProfile()
 	}
-	info.Disk, err = promptPVEDisk()
+	info.Cores, info.Memory, info.Disk, err = promptPVEHardware(hw)
 	if err != nil {
 		return err
 	}
@@ -68,7 +71,7 @@ func promptForIstore() error {
 	var needDownload bool
 	// 如果当前有状态文件且选择了断点续传  或  选择了全新下载，则标志着需要下载
 	if (status != nil && info.IstoreIMG == status.TargetFile) ||
-		info.IstoreVer >= 0 {
+		rel != nil {
 		needDownload = true
 	}
 	next, err := promptIstoreDownloadInstall(info, needDownload)
@@ -82,15 +85,15 @@ func promptForIstore() error {
 	ctx := context.TODO()
 	if status != nil && info.IstoreIMG == status.TargetFile {
 		// Continue download target file
-		info.IstoreIMG, err = vmdownloader.DownloadIstoreIMG(ctx, downer, isoPath, cachePath, statusPath, status, -1)
+		info.IstoreIMG, err = vmdownloader.DownloadIstoreIMG(ctx, downer, isoPath, cachePath, statusPath, status, nil)
 		if err != nil {
 			return err
 		}
 	}
 	// 全新下载走这个逻辑
-	if info.IstoreVer >= 0 {
+	if rel != nil {
 		status = nil
-		info.IstoreIMG, err = vmdownloader.DownloadIstoreIMG(ctx, downer, isoPath, cachePath, statusPath, status, info.IstoreVer)
+		info.IstoreIMG, err = vmdownloader.DownloadIstoreIMG(ctx, downer, isoPath, cachePath, statusPath, status, rel)
 		if err != nil {
 			return err
 		}
@@ -107,7 +110,7 @@ func promptForIstore() error {
 提供断点续传，根据已有iso，全新下载等方式
 根据选项填充info的相应字段
 */
-func promptIstoreFiles(info *istoreInstallInfo, status *downloader.DownloadStatus, istoreIMGs []string) error {
+func promptIstoreFiles(info *istoreInstallInfo, status *downloader.DownloadStatus, istoreIMGs []string, releases []*catalog.Release) error {
 	origWinLen := len(istoreIMGs)
 	if status != nil {
 		name := filepath.Base(status.TargetFile)
@@ -116,8 +119,10 @@ func promptIstoreFiles(info *istoreInstallInfo, status *downloader.DownloadStatu
 		name = fmt.Sprintf("继续下载 %s(%02d%%)", name, progress)
 		istoreIMGs = append(istoreIMGs, name)
 	}
-	istoreIMGs = append(istoreIMGs, "全新下载 iStore24.10")
-	istoreIMGs = append(istoreIMGs, "全新下载 iStore22.03")
+	startNew := len(istoreIMGs)
+	for _, rel := range releases {
+		istoreIMGs = append(istoreIMGs, "全新下载 "+rel.Name)
+	}
 	prompt := promptui.Select{
 		Label: "选择iStoreOS安装文件",
 		Items: istoreIMGs,
@@ -131,10 +136,10 @@ func promptIstoreFiles(info *istoreInstallInfo, status *downloader.DownloadStatu
 	if idx < origWinLen {
 		info.IstoreIMG = file
 	} else {
-		if status != nil && idx == (len(istoreIMGs)-3) {
+		if status != nil && idx == origWinLen {
 			info.IstoreIMG = status.TargetFile
-		} else if idx >= (len(istoreIMGs) - 2) {
-			info.IstoreVer = idx - (len(istoreIMGs) - 2)
+		} else if idx >= startNew {
+			info.IstoreVer = releases[idx-startNew].ID
 		}
 	}
 
@@ -185,63 +190,12 @@ func promptIstoreDownloadInstall(info *istoreInstallInfo, needDownload bool) (bo
 }
 
 func createIstoreVM(ctx context.Context, isoPath string, info *istoreInstallInfo) error {
-	disks, err := quickget.DiskStatus()
-	if err != nil {
-		return err
-	}
-	useDisk := "local"
-	if len(disks) > 0 {
-		useDisk = disks[0]
-	}
-	for _, disk := range disks {
-		if disk == "local-lvm" {
-			useDisk = "local-lvm"
-			break
-		}
-	}
-
-	items, err := quickget.QMList()
-	if err != nil {
-		return err
-	}
-	vmid := 100
-	if len(items) > 0 {
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].VMID < items[j].VMID
-		})
-		vmid = items[len(items)-1].VMID + 1
-	}
 	imgName := filepath.Base(info.IstoreIMG)
-	vmName := toBetterIstoreName(imgName)
-	scripts := []string{
-		"set -e",
-		`export LC_ALL="en_US.UTF-8"`,
-		fmt.Sprintf("export VMID=%d", vmid),
-		fmt.Sprintf(`qm create $VMID --name "%s" --memory %d --scsihw virtio-scsi-single --cores %d --sockets 1 --machine q35 --bios ovmf --cpu host --net0 virtio,bridge=vmbr0`,
-			vmName,
-			info.Memory,
-			info.Cores),
-		fmt.Sprintf("qm set $VMID -efidisk0 %s:1,format=raw,efitype=4m", useDisk),
-		fmt.Sprintf("qm set $VMID --scsi0 %s:0,import-from=%s", useDisk, filepath.Join(isoPath, imgName)),
-		fmt.Sprintf(`qm set $VMID  --scsi1 %s:%d`, useDisk, info.Disk),
-		`qm set $VMID --boot order='scsi0'`,
-		`qm set $VMID  --ostype l26`,
-		`echo "VMOK"`,
-	}
-	//fmt.Println(strings.Join(scripts, "\n"))
-	out, err := utils.BatchOutput(ctx, scripts, 0)
-	if err != nil {
-		return err
-	}
-	if !strings.Contains(string(out), "VMOK") {
-		return errors.New("VM creation failed")
-	}
-	fmt.Println("创建虚拟机：", vmid, "成功")
-
-	// 不启动虚拟机
-	//err = utils.BatchRun(ctx, []string{fmt.Sprintf("qm start %d", vmid)}, 0)
-	//if err == nil {
-	//	fmt.Println("启动虚拟机成功：", vmid)
-	//}
-	return err
+	return createDiskImageVM(ctx, &diskImageVM{
+		Name:      toBetterIstoreName(imgName),
+		ImagePath: filepath.Join(isoPath, imgName),
+		Cores:     info.Cores,
+		Memory:    info.Memory,
+		Disk:      info.Disk,
+	})
 }
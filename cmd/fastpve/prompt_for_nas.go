@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/linkease/fastpve/quickget"
+	"github.com/manifoldco/promptui"
+)
+
+var nasOSIDs = []string{"truenas", "openmediavault", "fnos"}
+
+func promptForNAS() error {
+	return promptForOSChoice(nasOSIDs)
+}
+
+// promptNASDataDisks lets the user add virtual data disks or pass through whole host
+// disks; the NAS system itself only lives on the small system disk.
+func promptNASDataDisks() ([]dataDisk, error) {
+	hostDisks, err := quickget.PhysicalDisks()
+	if err != nil {
+		fmt.Println("获取物理硬盘列表失败:", err)
+	}
+	var disks []dataDisk
+	used := make(map[string]bool)
+	for {
+		items := []string{"完成", "添加虚拟数据盘"}
+		var choices []*quickget.PhysicalDisk
+		for _, hd := range hostDisks {
+			if hd.InUse || hd.ByID == "" || used[hd.ByID] {
+				continue
+			}
+			items = append(items, fmt.Sprintf("直通硬盘 %s（%s %s）", hd.Name, hd.Size, hd.Model))
+			choices = append(choices, hd)
+		}
+		prompt := promptui.Select{
+			Label: fmt.Sprintf("添加数据盘（已添加%d块）：", len(disks)),
+			Items: items,
+		}
+		idx, _, err := prompt.Run()
+		if err != nil {
+			return nil, err
+		}
+		switch idx {
+		case 0:
+			return disks, nil
+		case 1:
+			size, err := promptInputNumber("数据盘大小（GB）：")
+			if err != nil {
+				return nil, err
+			}
+			disks = append(disks, dataDisk{SizeGB: size})
+		default:
+			hd := choices[idx-2]
+			fmt.Println("注意：直通的硬盘", hd.ByID, "会被 NAS 系统格式化")
+			used[hd.ByID] = true
+			disks = append(disks, dataDisk{Device: hd.ByID})
+		}
+	}
+}
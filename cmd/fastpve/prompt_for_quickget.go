@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/quickget"
+	"github.com/linkease/fastpve/utils"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/manifoldco/promptui"
+)
+
+// quickgetExcludedOSes have their own menu, or cannot boot as a plain Linux ISO VM.
+var quickgetExcludedOSes = []string{"windows", "windows-server", "macos"}
+
+// genericHardware is the VM profile offered for OSes outside the catalog.
+var genericHardware = catalog.Hardware{Cores: 2, Memory: 4096, Disk: 32}
+
+// quickgetDiskImageExts are the disk image formats qm can import, before any .gz or .xz
+// compression.
+var quickgetDiskImageExts = []string{".img", ".raw", ".qcow2", ".vmdk", ".vhdx", ".vdi"}
+
+// isQuickgetDiskImage reports whether a file quickget resolved is a disk image that a VM
+// can be created from, rather than an installer ISO.
+func isQuickgetDiskImage(name string) bool {
+	ext := strings.ToLower(filepath.Ext(vmdownloader.UnpackedName(name)))
+	return slices.Contains(quickgetDiskImageExts, ext)
+}
+
+func isISO(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".iso")
+}
+
+// acceptQuickgetImage refuses, before the download, files no VM can be created from,
+// such as archives.
+func acceptQuickgetImage(name string) error {
+	if isISO(name) || isQuickgetDiskImage(name) {
+		return nil
+	}
+	return fmt.Errorf("quickget 提供的 %s 既不是 ISO 也不是磁盘镜像，无法创建虚拟机，可选择“仅下载”", name)
+}
+
+// promptForQuickget installs any OS the quickget script knows: pick an OS and release,
+// download the image it resolves and create a VM from the ISO, or by importing the disk
+// image.
+func promptForQuickget() error {
+	isoStorage, err := promptISOStorage()
+	if err != nil {
+		return err
+	}
+	isoPath := isoStorage.ISOPath()
+	cachePath, err := storageCachePath(isoStorage)
+	if err != nil {
+		return err
+	}
+	downer := newDownloader()
+	statusPath := filepath.Join(cachePath, "quickget_install.ops")
+	status, _ := vmdownloader.IsStatusValid(downer, statusPath)
+
+	ctx := context.TODO()
+	distros, err := quickget.Distros(ctx)
+	if err != nil {
+		return err
+	}
+	distros = slices.DeleteFunc(distros, func(d quickget.Distro) bool {
+		return slices.Contains(quickgetExcludedOSes, d.ID)
+	})
+	var items []string
+	if status != nil {
+		name := strings.TrimSuffix(filepath.Base(status.TargetFile), ".syn")
+		progress := status.Curr * 100 / (status.TotalSize + 1)
+		items = append(items, fmt.Sprintf("继续下载 %s(%02d%%)", name, progress))
+	}
+	for _, d := range distros {
+		items = append(items, fmt.Sprintf("%s（%s）", d.Name, d.ID))
+	}
+	idx, err := promptSearchSelect("选择系统（输入 / 搜索）：", items)
+	if err != nil {
+		return err
+	}
+
+	info := &releaseInstallInfo{ISOStorage: isoStorage.Name}
+	var osName, release, edition string
+	if status != nil && idx == 0 {
+		info.ISO = status.TargetFile
+	} else {
+		if status != nil {
+			idx--
+		}
+		osName = distros[idx].ID
+		release, edition, err = promptQuickgetRelease(ctx, distros[idx])
+		if err != nil {
+			return err
+		}
+		info.Release = strings.TrimSpace(release + " " + edition)
+	}
+	info.Cores, info.Memory, info.Disk, err = promptPVEHardware(genericHardware)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("install=", utils.ToString(info))
+	next, err := promptReleaseDownloadInstall(info, true)
+	if err != nil {
+		return err
+	}
+	if !next {
+		return nil
+	}
+	accept := acceptQuickgetImage
+	if info.DownloadOnly {
+		accept = nil
+	}
+	info.ISO, err = vmdownloader.DownloadQuickgetImage(ctx, downer, isoPath, cachePath, statusPath, status, osName, release, edition, accept)
+	if err != nil {
+		return err
+	}
+	if info.DownloadOnly {
+		return nil
+	}
+	imgName := filepath.Base(info.ISO)
+	if isQuickgetDiskImage(imgName) {
+		imgName, err = vmdownloader.UnpackImage(info.ISO, isoPath)
+		if err != nil {
+			return err
+		}
+		return createDiskImageVM(ctx, &diskImageVM{
+			Name:       toBetterUbuntuName(strings.TrimSuffix(imgName, filepath.Ext(imgName))),
+			ImagePath:  filepath.Join(isoPath, imgName),
+			Cores:      info.Cores,
+			Memory:     info.Memory,
+			SystemDisk: info.Disk,
+		})
+	}
+	return createLinuxISOVM(ctx, &linuxISOVM{
+		Name:       toBetterUbuntuName(imgName),
+		ISOStorage: isoStorage,
+		ISO:        imgName,
+		Cores:      info.Cores,
+		Memory:     info.Memory,
+		Disk:       info.Disk,
+	})
+}
+
+// promptQuickgetRelease lists the releases and editions quickget offers for an OS.
+func promptQuickgetRelease(ctx context.Context, distro quickget.Distro) (release, edition string, err error) {
+	fmt.Println("查询", distro.Name, "可用版本...")
+	entries, err := quickget.List(ctx, distro.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if len(entries) == 0 {
+		return "", "", fmt.Errorf("quickget 未列出 %s 的可用版本", distro.Name)
+	}
+	items := make([]string, len(entries))
+	for i, e := range entries {
+		items[i] = strings.TrimSpace(e.Release + " " + e.Option)
+	}
+	idx, err := promptSearchSelect("选择"+distro.Name+"版本：", items)
+	if err != nil {
+		return "", "", err
+	}
+	return entries[idx].Release, entries[idx].Option, nil
+}
+
+func promptSearchSelect(label string, items []string) (int, error) {
+	prompt := promptui.Select{
+		Label: label,
+		Items: items,
+		Size:  15,
+		Searcher: func(input string, index int) bool {
+			return strings.Contains(strings.ToLower(items[index]), strings.ToLower(input))
+		},
+	}
+	idx, _, err := prompt.Run()
+	return idx, err
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestAcceptQuickgetImage(t *testing.T) {
+	tests := []struct {
+		name string
+		disk bool
+		ok   bool
+	}{
+		{"alpine-virt-3.20.iso", false, true},
+		{"NixOS.ISO", false, true},
+		{"haiku-r1beta5.img", true, true},
+		{"batocera-x86_64.img.gz", true, true},
+		{"openwrt-combined-efi.qcow2.xz", true, true},
+		{"reactos-bootcd.zip", false, false},
+		{"kolibri.7z", false, false},
+	}
+	for _, tt := range tests {
+		if got := isQuickgetDiskImage(tt.name); got != tt.disk {
+			t.Errorf("isQuickgetDiskImage(%s) = %v", tt.name, got)
+		}
+		if err := acceptQuickgetImage(tt.name); (err == nil) != tt.ok {
+			t.Errorf("acceptQuickgetImage(%s) = %v", tt.name, err)
+		}
+	}
+}
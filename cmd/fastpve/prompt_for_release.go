@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/utils"
+	"github.com/linkease/fastpve/vmdownloader"
+	"github.com/manifoldco/promptui"
+)
+
+type releaseInstallInfo struct {
+	ISOStorage   string `json:"isoStorage"`
+	ISO          string `json:"iso"`
+	Release      string `json:"release"`
+	Memory       int    `json:"memory"`
+	Cores        int    `json:"cores"`
+	Disk         int    `json:"disk"`
+	DownloadOnly bool   `json:"downloadOnly"`
+}
+
+var rhelOSIDs = []string{"rocky", "almalinux", "centos-stream", "fedora"}
+
+var openwrtOSIDs = []string{"openwrt", "immortalwrt"}
+
+func promptForOpenWrt() error {
+	return promptForOSChoice(openwrtOSIDs)
+}
+
+func promptForRHEL() error {
+	return promptForOSChoice(rhelOSIDs)
+}
+
+func promptForOSChoice(osIDs []string) error {
+	var items []string
+	var ids []string
+	for _, id := range osIDs {
+		o, err := catalog.Current().FindOS(id)
+		if err != nil {
+			continue
+		}
+		items = append(items, o.Name)
+		ids = append(ids, id)
+	}
+	prompt := promptui.Select{
+		Label: "选择系统：",
+		Items: items,
+	}
+	idx, _, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+	return promptForReleaseISO(ids[idx])
+}
+
+// promptForReleaseISO installs a catalog OS whose releases are installer ISOs or disk images:
+// pick a file already in the storage or a release to download, then create the VM.
+func promptForReleaseISO(osID string) error {
+	o, err := catalog.Current().FindOS(osID)
+	if err != nil {
+		return err
+	}
+	isoStorage, err := promptISOStorage()
+	if err != nil {
+		return err
+	}
+	isoPath := isoStorage.ISOPath()
+	cachePath, err := storageCachePath(isoStorage)
+	if err != nil {
+		return err
+	}
+	downer := newDownloader()
+	statusPath := filepath.Join(cachePath, osID+"_install.ops")
+	status, _ := vmdownloader.IsStatusValid(downer, statusPath)
+
+	var isos []string
+	dirs, err := os.ReadDir(isoPath)
+	if err == nil {
+		isos = getReleaseISO(dirs, o)
+	}
+
+	info := &releaseInstallInfo{
+		ISOStorage: isoStorage.Name,
+	}
+	err = promptReleaseFiles(info, o, status, isos)
+	if err != nil {
+		return err
+	}
+	hw := o.HardwareProfile()
+	var rel *catalog.Release
+	if info.Release != "" {
+		rel, err = o.FindRelease(info.Release)
+		if err != nil {
+			return err
+		}
+		hw = rel.HardwareProfile()
+	}
+	info.Cores, info.Memory, info.Disk, err = promptPVEHardware(hw)
+	if err != nil {
+		return err
+	}
+	var dataDisks []dataDisk
+	if slices.Contains(nasOSIDs, osID) {
+		dataDisks, err = promptNASDataDisks()
+		if err != nil {
+			return err
+		}
+	}
+	var cloudInit *cloudInitConfig
+	if o.Kind == catalog.KindCloudImage {
+		cloudInit, err = promptCloudInit(osID)
+		if err != nil {
+			return err
+		}
+	}
+	var usbDevices []string
+	if osID == haosOSID {
+		usbDevices, err = promptUSBDevices()
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("install=", utils.ToString(info))
+	needDownload := (status != nil && info.ISO == status.TargetFile) || rel != nil
+	next, err := promptReleaseDownloadInstall(info, needDownload)
+	if err != nil {
+		return err
+	}
+	if !next {
+		return nil
+	}
+
+	ctx := context.TODO()
+	download := vmdownloader.DownloadRelease
+	if o.ImportsImage() {
+		download = vmdownloader.DownloadDiskImage
+	}
+	if status != nil && info.ISO == status.TargetFile {
+		// Continue download target file
+		info.ISO, err = download(ctx, downer, isoPath, cachePath, statusPath, status, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if rel != nil {
+		info.ISO, err = download(ctx, downer, isoPath, cachePath, statusPath, nil, rel)
+		if err != nil {
+			return err
+		}
+	}
+	if info.DownloadOnly {
+		return nil
+	}
+
+	imgName := filepath.Base(info.ISO)
+	if cloudInit != nil {
+		return createCloudImageVM(ctx, &cloudImageVM{
+			Name:      toBetterUbuntuName(strings.TrimSuffix(imgName, filepath.Ext(imgName))),
+			ImagePath: filepath.Join(isoPath, imgName),
+			Cores:     info.Cores,
+			Memory:    info.Memory,
+			Disk:      info.Disk,
+			CloudInit: cloudInit,
+		})
+	}
+	if o.Kind == catalog.KindDiskImage {
+		vm := &diskImageVM{
+			Name:       toBetterUbuntuName(strings.TrimSuffix(imgName, filepath.Ext(imgName))),
+			ImagePath:  filepath.Join(isoPath, imgName),
+			Cores:      info.Cores,
+			Memory:     info.Memory,
+			Disk:       info.Disk,
+			Legacy:     hw.BIOS == "seabios",
+			USBDevices: usbDevices,
+		}
+		if slices.Contains(openwrtOSIDs, osID) && !strings.Contains(imgName, "-efi") {
+			// Existing and resumed images carry no release, so tell them apart by name.
+			vm.Legacy = true
+		}
+		if osID == haosOSID {
+			// HAOS keeps its data on the system disk and grows into it on boot.
+			vm.SystemDisk, vm.Disk = info.Disk, 0
+		}
+		return createDiskImageVM(ctx, vm)
+	}
+	return createLinuxISOVM(ctx, &linuxISOVM{
+		Name:       toBetterUbuntuName(imgName),
+		ISOStorage: isoStorage,
+		ISO:        imgName,
+		Cores:      info.Cores,
+		Memory:     info.Memory,
+		Disk:       info.Disk,
+		DataDisks:  dataDisks,
+	})
+}
+
+func promptReleaseFiles(info *releaseInstallInfo, o *catalog.OS, status *downloader.DownloadStatus, isos []string) error {
+	origLen := len(isos)
+	if status != nil {
+		name := filepath.Base(status.TargetFile)
+		name = strings.TrimSuffix(name, ".syn")
+		progress := status.Curr * 100 / (status.TotalSize + 1)
+		name = fmt.Sprintf("继续下载 %s(%02d%%)", name, progress)
+		isos = append(isos, name)
+	}
+	startNew := len(isos)
+	for _, rel := range o.Releases {
+		isos = append(isos, "全新下载 "+rel.Name)
+	}
+	prompt := promptui.Select{
+		Label: "选择" + o.Name + "安装文件",
+		Items: isos,
+	}
+	idx, file, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+	if idx < origLen {
+		info.ISO = file
+	} else if status != nil && idx == origLen {
+		info.ISO = status.TargetFile
+	} else if idx >= startNew {
+		info.Release = o.Releases[idx-startNew].ID
+	}
+	return nil
+}
+
+// getReleaseISO lists the ISOs, or the unpacked images of a disk-image OS, whose names
+// start like one of the OS release files.
+func getReleaseISO(dirs []os.DirEntry, o *catalog.OS) []string {
+	exts := make(map[string]bool)
+	var prefixes []string
+	for _, rel := range o.Releases {
+		file := vmdownloader.UnpackedName(rel.File)
+		exts[filepath.Ext(file)] = true
+		prefix, _, _ := strings.Cut(file, "{")
+		if prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	var isoFiles []string
+	for _, dir := range dirs {
+		if dir.IsDir() || !exts[filepath.Ext(dir.Name())] {
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(dir.Name(), prefix) {
+				isoFiles = append(isoFiles, dir.Name())
+				break
+			}
+		}
+	}
+	return isoFiles
+}
+
+func promptReleaseDownloadInstall(info *releaseInstallInfo, needDownload bool) (bool, error) {
+	var items []string
+	if needDownload {
+		items = []string{"下载并安装", "仅下载", "退出"}
+	} else {
+		items = []string{"安装", "退出"}
+	}
+	prompt := promptui.Select{
+		Label: fmt.Sprintf("选择完成，继续安装%s：（CPU：%d,内存：%dMB,硬盘：%dGB）",
+			filepath.Base(info.ISO),
+			info.Cores,
+			info.Memory,
+			info.Disk),
+		Items: items,
+	}
+	idx, _, err := prompt.Run()
+	if err != nil {
+		return false, err
+	}
+	if idx == 0 {
+		return true, nil
+	}
+	if needDownload && idx == 1 {
+		info.DownloadOnly = true
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/linkease/fastpve/quickget"
+	"github.com/manifoldco/promptui"
+)
+
+// promptISOStorage lets the user pick where images are stored. On a cluster a shared
+// storage keeps a single copy for every node and lets VMs migrate with the CD attached.
+func promptISOStorage() (*quickget.ISOStorage, error) {
+	storages, err := quickget.ISOStorages()
+	if err != nil || len(storages) == 0 {
+		return quickget.DefaultISOStorage(), nil
+	}
+	if len(storages) == 1 {
+		return storages[0], nil
+	}
+	items := make([]string, len(storages))
+	for i, s := range storages {
+		scope := "仅本节点"
+		if s.Shared {
+			scope = "集群共享"
+		}
+		items[i] = fmt.Sprintf("%s（%s，%s）", s.Name, s.Type, scope)
+	}
+	prompt := promptui.Select{
+		Label: "选择镜像存储位置",
+		Items: items,
+	}
+	idx, _, err := prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+	return storages[idx], nil
+}
+
+// storageCachePath creates the partial download directory of a storage. Downloads are
+// cached on the storage they end up on, so finishing them is a rename.
+func storageCachePath(storage *quickget.ISOStorage) (string, error) {
+	cachePath := storage.CachePath()
+	if err := os.MkdirAll(cachePath, 0755); err != nil {
+		return "", err
+	}
+	return cachePath, nil
+}
@@ -2,13 +2,13 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"time"
 
+	"github.com/linkease/fastpve/catalog"
 	"github.com/linkease/fastpve/downloader"
 	"github.com/linkease/fastpve/quickget"
 	"github.com/linkease/fastpve/utils"
@@ -16,18 +16,10 @@ import (
 	"github.com/manifoldco/promptui"
 )
 
-const (
-	Ubuntu2204ForDesk = iota
-	Ubuntu2204ForServer
-	Ubuntu2410ForDesk
-	Ubuntu2410ForServer
-	Ubuntu2504ForDesk
-	Ubuntu2504ForServer
-)
-
 type ubuntuInstallInfo struct {
+	ISOStorage   string `json:"isoStorage"`
 	UbuntuISO    string `json:"ubuntuISO"`
-	UbuntuVer    int    `json:"ubuntuVer"`
+	UbuntuVer    string `json:"ubuntuVer"`
 	Memory       int    `json:"memory"`
 	Cores        int    `json:"cores"`
 	Disk         int    `json:"disk"`
@@ -35,8 +27,15 @@ type ubuntuInstallInfo struct {
 }
 
 func promptForUbuntu() error {
-	isoPath := "/var/lib/vz/template/iso/"
-	cachePath := "/var/lib/vz/template/cache"
+	isoStorage, err := promptISOStorage()
+	if err != nil {
+		return err
+	}
+	isoPath := isoStorage.ISOPath()
+	cachePath, err := storageCachePath(isoStorage)
+	if err != nil {
+		return err
+	}
 	downer := newDownloader()
 	statusPath := filepath.Join(cachePath, "ubuntu_install.ops")
 	status, _ := vmdownloader.IsStatusValid(downer, statusPath)
@@ -47,23 +46,29 @@ func promptForUbuntu() error {
 		ubuntuISOs = getUbuntuISO(dirs)
 	}
 
-	info := &ubuntuInstallInfo{
-		UbuntuVer: -1,
-	}
-
-	err = promptUbuntuFiles(info, status, ubuntuISOs)
+	ubuntuOS, err := catalog.Current().FindOS("ubuntu")
 	if err != nil {
 		return err
 	}
-	info.Cores, err = promptPVECore()
-	if err != nil {
-		return err
+	info := &ubuntuInstallInfo{
+		ISOStorage: isoStorage.Name,
 	}
-	info.Memory, err = promptPVEMemory()
+
+	ctx := context.TODO()
+	err = promptUbuntuFiles(info, status, ubuntuISOs, ubuntuChoices(ctx, downer))
 	if err != nil {
 		return err
 	}
-	info.Disk, err = promptPVEDisk()
+	hw := ubuntuOS.HardwareProfile()
+	var rel *catalog.Release
+	if info.UbuntuVer != "" {
+		rel, err = vmdownloader.FindUbuntuRelease(ctx, downer, info.UbuntuVer)
+		if err != nil {
+			return err
+		}
+		hw = rel.HardwareProfile()
+	}
+	info.Cores, info.Memory, info.Disk, err = promptPVEHardware(hw)
 	if err != nil {
 		return err
 	}
@@ -71,7 +76,7 @@ func promptForUbuntu() error {
 	fmt.Println("install=", utils.ToString(info))
 	var needDownload bool
 	if (status != nil && info.UbuntuISO == status.TargetFile) ||
-		info.UbuntuVer >= 0 {
+		rel != nil {
 		needDownload = true
 	}
 	next, err := promptUbuntuDownloadInstall(info, needDownload)
@@ -82,17 +87,16 @@ func promptForUbuntu() error {
 		return nil
 	}
 
-	ctx := context.TODO()
 	if status != nil && info.UbuntuISO == status.TargetFile {
 		// Continue download target file
-		info.UbuntuISO, err = vmdownloader.DownloadUbuntuISO(ctx, downer, isoPath, cachePath, statusPath, status, -1)
+		info.UbuntuISO, err = vmdownloader.DownloadUbuntuISO(ctx, downer, isoPath, cachePath, statusPath, status, nil)
 		if err != nil {
 			return err
 		}
 	}
-	if info.UbuntuVer >= 0 {
+	if rel != nil {
 		status = nil
-		info.UbuntuISO, err = vmdownloader.DownloadUbuntuISO(ctx, downer, isoPath, cachePath, statusPath, status, info.UbuntuVer)
+		info.UbuntuISO, err = vmdownloader.DownloadUbuntuISO(ctx, downer, isoPath, cachePath, statusPath, status, rel)
 		if err != nil {
 			return err
 		}
@@ -101,10 +105,44 @@ func promptForUbuntu() error {
 		return nil
 	}
 
-	return createUbuntuVM(ctx, isoPath, info)
+	return createUbuntuVM(ctx, isoStorage, info)
+}
+
+// ubuntuChoice is a "全新下载" menu entry; Version is passed to vmdownloader.FindUbuntuRelease.
+type ubuntuChoice struct {
+	Label     string
+	Version   string
+	AskFlavor bool
+}
+
+// ubuntuChoices lists the discovered Ubuntu releases, or the catalog ones when discovery fails.
+func ubuntuChoices(ctx context.Context, d vmdownloader.Downloader) []ubuntuChoice {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	var choices []ubuntuChoice
+	releases, err := vmdownloader.DiscoverUbuntuReleases(ctx, d)
+	if err != nil {
+		fmt.Println("获取 Ubuntu 版本列表失败，使用内置列表:", err)
+		o, err := catalog.Current().FindOS("ubuntu")
+		if err != nil {
+			return nil
+		}
+		for _, rel := range o.Releases {
+			choices = append(choices, ubuntuChoice{Label: "全新下载 " + rel.Name, Version: rel.ID})
+		}
+		return choices
+	}
+	for _, u := range releases {
+		label := "全新下载 " + u.Title()
+		if u.EOL {
+			label += "（已停止支持）"
+		}
+		choices = append(choices, ubuntuChoice{Label: label, Version: u.Version, AskFlavor: true})
+	}
+	return choices
 }
 
-func promptUbuntuFiles(info *ubuntuInstallInfo, status *downloader.DownloadStatus, ubuntuISOs []string) error {
+func promptUbuntuFiles(info *ubuntuInstallInfo, status *downloader.DownloadStatus, ubuntuISOs []string, choices []ubuntuChoice) error {
 	origUbuntuLen := len(ubuntuISOs)
 	if status != nil {
 		name := filepath.Base(status.TargetFile)
@@ -113,15 +151,14 @@ func promptUbuntuFiles(info *ubuntuInstallInfo, status *downloader.DownloadStatu
 		name = fmt.Sprintf("继续下载 %s(%02d%%)", name, progress)
 		ubuntuISOs = append(ubuntuISOs, name)
 	}
-	ubuntuISOs = append(ubuntuISOs, "全新下载 Ubuntu 22.04-desktop")
-	ubuntuISOs = append(ubuntuISOs, "全新下载 Ubuntu 22.04-live-server")
-	ubuntuISOs = append(ubuntuISOs, "全新下载 Ubuntu 24.10-desktop")
-	ubuntuISOs = append(ubuntuISOs, "全新下载 Ubuntu 24.10-live-server")
-	ubuntuISOs = append(ubuntuISOs, "全新下载 Ubuntu 25.04-desktop")
-	ubuntuISOs = append(ubuntuISOs, "全新下载 Ubuntu 25.04-live-server")
+	startNew := len(ubuntuISOs)
+	for _, c := range choices {
+		ubuntuISOs = append(ubuntuISOs, c.Label)
+	}
 	prompt := promptui.Select{
 		Label: "选择Ubuntu安装文件",
 		Items: ubuntuISOs,
+		Size:  10,
 	}
 	idx, file, err := prompt.Run()
 	if err != nil {
@@ -130,10 +167,26 @@ func promptUbuntuFiles(info *ubuntuInstallInfo, status *downloader.DownloadStatu
 	if idx < origUbuntuLen {
 		info.UbuntuISO = file
 	} else {
-		if status != nil && idx == (len(ubuntuISOs)-7) {
+		if status != nil && idx == origUbuntuLen {
 			info.UbuntuISO = status.TargetFile
-		} else if idx >= (len(ubuntuISOs) - 6) {
-			info.UbuntuVer = idx - (len(ubuntuISOs) - 6)
+		} else if idx >= startNew {
+			c := choices[idx-startNew]
+			info.UbuntuVer = c.Version
+			if c.AskFlavor {
+				prompt := promptui.Select{
+					Label: "选择Ubuntu版本类型",
+					Items: []string{"桌面版（desktop）", "服务器版（live-server）"},
+				}
+				idx, _, err := prompt.Run()
+				if err != nil {
+					return err
+				}
+				if idx == 0 {
+					info.UbuntuVer += "-desktop"
+				} else {
+					info.UbuntuVer += "-live-server"
+				}
+			}
 		}
 	}
 
@@ -183,59 +236,14 @@ func promptUbuntuDownloadInstall(info *ubuntuInstallInfo, needDownload bool) (bo
 	return false, nil
 }
 
-func createUbuntuVM(ctx context.Context, isoPath string, info *ubuntuInstallInfo) error {
-	disks, err := quickget.DiskStatus()
-	if err != nil {
-		return err
-	}
-	useDisk := "local"
-	if len(disks) > 0 {
-		useDisk = disks[0]
-	}
-	for _, disk := range disks {
-		if disk == "local-lvm" {
-			useDisk = "local-lvm"
-			break
-		}
-	}
-
-	items, err := quickget.QMList()
-	if err != nil {
-		return err
-	}
-	vmid := 100
-	if len(items) > 0 {
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].VMID < items[j].VMID
-		})
-		vmid = items[len(items)-1].VMID + 1
-	}
+func createUbuntuVM(ctx context.Context, isoStorage *quickget.ISOStorage, info *ubuntuInstallInfo) error {
 	imgName := filepath.Base(info.UbuntuISO)
-	vmName := toBetterUbuntuName(imgName)
-	scripts := []string{
-		"set -e",
-		`export LC_ALL="en_US.UTF-8"`,
-		fmt.Sprintf("export VMID=%d", vmid),
-		fmt.Sprintf(`qm create $VMID --name "%s" --memory %d --scsihw virtio-scsi-single --cores %d --sockets 1 --machine q35 --bios ovmf --cpu host --net0 virtio,bridge=vmbr0`,
-			vmName,
-			info.Memory,
-			info.Cores),
-		fmt.Sprintf("qm set $VMID -efidisk0 %s:1,format=raw,efitype=4m", useDisk),
-		fmt.Sprintf("qm set $VMID --scsi0 %s:%d", useDisk, info.Disk),
-		fmt.Sprintf(`qm set $VMID --ide0 local:iso/%s,media=cdrom`, imgName),
-		`qm set $VMID --boot order='scsi0;ide0'`,
-		`qm set $VMID --agent enabled=1,fstrim_cloned_disks=1`,
-		`qm set $VMID --ostype l26`,
-		`echo "VMOK"`,
-	}
-	//fmt.Println(strings.Join(scripts, "\n"))
-	out, err := utils.BatchOutput(ctx, scripts, 0)
-	if err != nil {
-		return err
-	}
-	if strings.Contains(string(out), "VMOK") {
-		fmt.Println("创建虚拟机：", vmid, "成功，请到网页端启动虚拟机并继续安装系统")
-		return nil
-	}
-	return errors.New("VM creation failed")
+	return createLinuxISOVM(ctx, &linuxISOVM{
+		Name:       toBetterUbuntuName(imgName),
+		ISOStorage: isoStorage,
+		ISO:        imgName,
+		Cores:      info.Cores,
+		Memory:     info.Memory,
+		Disk:       info.Disk,
+	})
 }
@@ -5,12 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 
+	"github.com/linkease/fastpve/catalog"
 	"github.com/linkease/fastpve/downloader"
 	"github.com/linkease/fastpve/quickget"
 	"github.com/linkease/fastpve/utils"
@@ -18,29 +18,22 @@ import (
 	"github.com/manifoldco/promptui"
 )
 
-var winEditions = []string{
-	"Chinese (Simplified)",
-	"Chinese (Traditional)",
-	"English (United States)",
-	"English International",
-	"English Enterprise",
-}
-
-var win7Editions = []string{
-	"Chinese (Simplified) x64",
-	"English Enterprise",
-}
-
 const (
 	Win11 = iota
 	Win10
 	Win7
+	WinServer2025
+	WinServer2022
+	WinServer2019
 )
 
+var windowsVersions = []int{Win11, Win10, Win7, WinServer2025, WinServer2022, WinServer2019}
+
 type windowsInstallInfo struct {
+	ISOStorage   string `json:"isoStorage"`
 	WindowISO    string `json:"windowISO"`
 	VirtIO       string `json:"virtio"`
-	WinVersion   int    `json:"winVersion"` // 0:11, 1:10, 2:7
+	WinVersion   int    `json:"winVersion"` // 0:11, 1:10, 2:7, 3-5:Server 2025/2022/2019
 	WinEdition   int    `json:"winEdition"`
 	Memory       int    `json:"memory"`
 	Cores        int    `json:"cores"`
@@ -49,22 +42,28 @@ type windowsInstallInfo struct {
 }
 
 func promptInstallWindows() error {
-	isoPath := "/var/lib/vz/template/iso/"
-	cachePath := "/var/lib/vz/template/cache"
+	isoStorage, err := promptISOStorage()
+	if err != nil {
+		return err
+	}
+	isoPath := isoStorage.ISOPath()
+	cachePath, err := storageCachePath(isoStorage)
+	if err != nil {
+		return err
+	}
 	downer := newDownloader()
 	statusPath := filepath.Join(cachePath, "windows_install.ops")
 	status, _ := vmdownloader.IsStatusValid(downer, statusPath)
 	registerGHCRMirrorPrompt()
 
 	var windows []string
-	var virtio []string
 	dirs, err := os.ReadDir(isoPath)
 	if err == nil {
 		windows = getWindowISO(dirs)
-		virtio = getVirtIOISO(dirs)
 	}
 
 	info := &windowsInstallInfo{
+		ISOStorage: isoStorage.Name,
 		WinVersion: -1,
 		WinEdition: -1,
 	}
@@ -73,6 +72,7 @@ func promptInstallWindows() error {
 	if err != nil {
 		return err
 	}
+	virtio := getVirtIOISO(dirs, vmdownloader.WindowsVirtIOVersion(info.WinVersion))
 	if len(virtio) > 0 {
 		prompt := promptui.Select{
 			Label: "选择VirtIO驱动文件",
@@ -85,15 +85,11 @@ func promptInstallWindows() error {
 		}
 		info.VirtIO = file
 	}
-	info.Cores, err = promptPVECore()
-	if err != nil {
-		return err
-	}
-	info.Memory, err = promptPVEMemory()
-	if err != nil {
-		return err
+	var hw catalog.Hardware
+	if rel, err := vmdownloader.WindowsRelease(info.WinVersion); err == nil {
+		hw = rel.HardwareProfile()
 	}
-	info.Disk, err = promptPVEDisk()
+	info.Cores, info.Memory, info.Disk, err = promptPVEHardware(hw)
 	if err != nil {
 		return err
 	}
@@ -114,42 +110,10 @@ func promptInstallWindows() error {
 	}
 
 	ctx := context.TODO()
-	var hasJq, uuidgen bool
-	if _, err := exec.LookPath("jq"); err == nil {
-		hasJq = true
-	}
-	if _, err := exec.LookPath("uuidgen"); err == nil {
-		uuidgen = true
-	}
-	if !hasJq || !uuidgen {
-		fmt.Println("安装缺失的 jq uuidgen")
-		utils.BatchRunStdout(ctx, []string{"apt update && apt install -y jq uuid-runtime"}, 0)
-		if _, err := exec.LookPath("jq"); err == nil {
-			hasJq = true
-		}
-		if _, err := exec.LookPath("uuidgen"); err == nil {
-			uuidgen = true
-		}
-		if !hasJq {
-			fmt.Println("缺少 jq 而且再次安装也失败")
-			return errors.New("缺少 jq")
-		}
-		if !uuidgen {
-			fmt.Println("缺少 uuidgen 而且再次安装也失败")
-			return errors.New("缺少 uuidgen")
-		}
-	}
-
-	quickGet, err := quickget.CreateQuickGet()
-	if err != nil {
-		return err
-	}
-	defer os.Remove(quickGet)
-	//log.Println("quickGet=", quickGet)
 
 	if status != nil && info.WindowISO == status.TargetFile {
 		// Continue download target file
-		info.WindowISO, err = vmdownloader.DownloadWindowsISO(ctx, downer, quickGet, isoPath, statusPath, status, -1, "")
+		info.WindowISO, err = vmdownloader.DownloadWindowsISO(ctx, downer, isoPath, statusPath, status, -1, "")
 		if err != nil {
 			return err
 		}
@@ -159,7 +123,7 @@ func promptInstallWindows() error {
 		if err != nil {
 			return err
 		}
-		info.WindowISO, err = vmdownloader.DownloadWindowsISO(ctx, downer, quickGet, isoPath, statusPath, status, info.WinVersion, editionName)
+		info.WindowISO, err = vmdownloader.DownloadWindowsISO(ctx, downer, isoPath, statusPath, status, info.WinVersion, editionName)
 		if err != nil {
 			return err
 		}
@@ -168,7 +132,11 @@ func promptInstallWindows() error {
 	if info.VirtIO == "" {
 		virtStatusPath := filepath.Join(cachePath, "windows_virtio.ops")
 		virtStatus, _ := vmdownloader.IsStatusValid(downer, virtStatusPath)
-		info.VirtIO, err = vmdownloader.DownloadVirtIO(ctx, downer, isoPath, virtStatusPath, virtStatus)
+		rel, err := vmdownloader.VirtIORelease(ctx, downer, vmdownloader.VirtIOStable, vmdownloader.WindowsVirtIOVersion(info.WinVersion))
+		if err != nil {
+			return err
+		}
+		info.VirtIO, err = vmdownloader.DownloadVirtIO(ctx, downer, isoPath, virtStatusPath, virtStatus, rel)
 		if err != nil {
 			return err
 		}
@@ -177,7 +145,7 @@ func promptInstallWindows() error {
 		return nil
 	}
 
-	return createWindowVM(ctx, info)
+	return createWindowVM(ctx, isoStorage, info)
 }
 
 func getWindowISO(dirs []os.DirEntry) []string {
@@ -192,7 +160,9 @@ func getWindowISO(dirs []os.DirEntry) []string {
 	return isoFiles
 }
 
-func getVirtIOISO(dirs []os.DirEntry) []string {
+// getVirtIOISO lists the VirtIO driver ISOs, the best match for the chosen Windows
+// version first (see vmdownloader.SortVirtIOFiles).
+func getVirtIOISO(dirs []os.DirEntry, maxVersion string) []string {
 	var isoFiles []string
 	for _, dir := range dirs {
 		if !dir.IsDir() &&
@@ -201,6 +171,7 @@ func getVirtIOISO(dirs []os.DirEntry) []string {
 			isoFiles = append(isoFiles, dir.Name())
 		}
 	}
+	vmdownloader.SortVirtIOFiles(isoFiles, maxVersion)
 	return isoFiles
 }
 
@@ -215,17 +186,15 @@ func promptWinFiles(info *windowsInstallInfo,
 		name = fmt.Sprintf("继续下载 %s(%02d%%)", name, progress)
 		windows = append(windows, name)
 	}
-	newOptions := []struct {
-		Label   string
-		Version int
-	}{
-		{"全新下载 Windows11", Win11},
-		{"全新下载 Windows10", Win10},
-		{"全新下载 Windows7 (支持简体/英文)", Win7},
-	}
+	var newVersions []int
 	startNew := len(windows)
-	for _, opt := range newOptions {
-		windows = append(windows, opt.Label)
+	for _, version := range windowsVersions {
+		rel, err := vmdownloader.WindowsRelease(version)
+		if err != nil {
+			continue
+		}
+		newVersions = append(newVersions, version)
+		windows = append(windows, "全新下载 "+rel.Name)
 	}
 	prompt := promptui.Select{
 		Label: "选择Windows安装文件",
@@ -242,17 +211,8 @@ func promptWinFiles(info *windowsInstallInfo,
 		info.WindowISO = status.TargetFile
 	} else if idx >= startNew {
 		selWin = true
-		opt := newOptions[idx-startNew]
-		info.WinVersion = opt.Version
-		if opt.Version == Win7 {
-			err = promptWin7Edition(info)
-		} else {
-			err = promptWinEdition(info)
-			if err != nil {
-				return err
-			}
-		}
-		if err != nil {
+		info.WinVersion = newVersions[idx-startNew]
+		if err = promptWinEdition(info); err != nil {
 			return err
 		}
 	} else {
@@ -260,17 +220,27 @@ func promptWinFiles(info *windowsInstallInfo,
 	}
 
 	if !selWin {
+		var items []string
+		var versions []int
+		for _, version := range windowsVersions {
+			rel, err := vmdownloader.WindowsRelease(version)
+			if err != nil {
+				continue
+			}
+			items = append(items, rel.Name)
+			versions = append(versions, version)
+		}
 		prompt := promptui.Select{
 			Label: "选择系统：",
-			Items: []string{"11", "10", "7"},
+			Items: items,
 		}
 		idx, _, err := prompt.Run()
 		if err != nil {
 			return err
 		}
-		info.WinVersion = idx
+		info.WinVersion = versions[idx]
 		if info.WinVersion == Win7 && info.WinEdition < 0 {
-			info.WinEdition = findEditionIndex(win7Editions, "Chinese (Simplified) x64")
+			info.WinEdition = findEditionIndex(windowsEditions(Win7), "Chinese (Simplified) x64")
 		}
 	}
 
@@ -286,24 +256,33 @@ func findEditionIndex(options []string, name string) int {
 	return -1
 }
 
+// windowsEditions lists the editions of a Windows version: the catalog editions, then
+// the languages quickget offers. The catalog alone is used when quickget cannot be listed.
+func windowsEditions(version int) []string {
+	editions, err := vmdownloader.WindowsEditions(context.TODO(), version)
+	if err != nil {
+		fmt.Println("获取 quickget 版本列表失败，按镜像目录显示:", err)
+	}
+	return editions
+}
+
 func selectedEdition(info *windowsInstallInfo) (string, error) {
 	if info.WinEdition < 0 {
 		return "", errors.New("未选择 Windows 版本语言")
 	}
-	if info.WinVersion == Win7 {
-		if info.WinEdition >= len(win7Editions) {
-			return "", fmt.Errorf("无效的 Windows 7 版本选项: %d", info.WinEdition)
-		}
-		return win7Editions[info.WinEdition], nil
-	}
-	if info.WinEdition >= len(winEditions) {
+	editions := windowsEditions(info.WinVersion)
+	if info.WinEdition >= len(editions) {
 		return "", fmt.Errorf("无效的 Windows 版本选项: %d", info.WinEdition)
 	}
-	return winEditions[info.WinEdition], nil
+	return editions[info.WinEdition], nil
 }
 
 func promptWinEdition(info *windowsInstallInfo) error {
-	idx, err := promptEdition("Windows版本语言", winEditions)
+	label := "Windows版本语言"
+	if info.WinVersion == Win7 {
+		label = "Windows 7 语言/架构"
+	}
+	idx, err := promptEdition(label, windowsEditionItems(info.WinVersion))
 	if err != nil {
 		return err
 	}
@@ -311,13 +290,32 @@ func promptWinEdition(info *windowsInstallInfo) error {
 	return nil
 }
 
-func promptWin7Edition(info *windowsInstallInfo) error {
-	idx, err := promptEdition("Windows 7 语言/架构", win7Editions)
+// windowsEditionItems labels the editions of a Windows version for the menu, marking
+// the ones that fall back to GHCR when the official download fails. Which packages
+// exist is read from the registry tag list, or from the catalog when that fails.
+func windowsEditionItems(version int) []string {
+	rel, err := vmdownloader.WindowsRelease(version)
 	if err != nil {
-		return err
+		return nil
 	}
-	info.WinEdition = idx
-	return nil
+	fmt.Println("查询 GHCR 可用版本...")
+	published, err := vmdownloader.AvailableGHCREditions(context.TODO(), rel)
+	if err != nil {
+		fmt.Println("查询 GHCR 版本失败，按镜像目录显示:", err)
+		published = rel.GHCREditions()
+	}
+	editions := windowsEditions(version)
+	items := make([]string, len(editions))
+	for i, edition := range editions {
+		items[i] = edition
+		for _, p := range published {
+			if strings.EqualFold(p, edition) {
+				items[i] += "（GHCR 备用源）"
+				break
+			}
+		}
+	}
+	return items
 }
 
 func promptEdition(label string, editions []string) (int, error) {
@@ -368,6 +366,10 @@ var (
 
 func registerGHCRMirrorPrompt() {
 	vmdownloader.GHCRMirrorSelector = func(ctx context.Context, reference string) ([]string, error) {
+		if !strings.HasPrefix(reference, "ghcr.io/") {
+			// A custom GHCR namespace is not served by the public GHCR mirrors.
+			return []string{}, nil
+		}
 		ghcrMirrorOnce.Do(func() {
 			ghcrMirrors, ghcrMirrorErr = promptGHCRMirrors()
 		})
@@ -407,7 +409,7 @@ func promptGHCRMirrors() ([]string, error) {
 	}
 }
 
-func createWindowVM(ctx context.Context, info *windowsInstallInfo) error {
+func createWindowVM(ctx context.Context, isoStorage *quickget.ISOStorage, info *windowsInstallInfo) error {
 	disks, err := quickget.DiskStatus()
 	if err != nil {
 		return err
@@ -434,22 +436,24 @@ func createWindowVM(ctx context.Context, info *windowsInstallInfo) error {
 		})
 		vmid = items[len(items)-1].VMID + 1
 	}
-	winID := 10
-	tpmStr := `echo win10`
-	switch info.WinVersion {
-	case Win11:
-		winID = 11
+	var hw catalog.Hardware
+	if rel, err := vmdownloader.WindowsRelease(info.WinVersion); err == nil {
+		hw = rel.HardwareProfile()
+	}
+	osType := hw.OSType
+	if osType == "" {
+		osType = "win10"
+	}
+	tpmStr := "echo " + osType
+	if hw.TPM {
 		tpmStr = fmt.Sprintf(`qm set $VMID -tpmstate0 %s:1,version=v2.0`, useDisk)
-	case Win7:
-		winID = 7
-		tpmStr = `echo win7`
 	}
 	winName := filepath.Base(info.WindowISO)
 	vmName := toBetterWindowName(winName)
 	bios := "ovmf"
 	machine := "q35"
 	needEFI := true
-	if info.WinVersion == Win7 {
+	if hw.BIOS == "seabios" {
 		bios = "seabios"
 		needEFI = false
 	}
@@ -469,12 +473,12 @@ func createWindowVM(ctx context.Context, info *windowsInstallInfo) error {
 	}
 	scripts = append(scripts,
 		fmt.Sprintf("qm set $VMID --scsi0 %s:%d", useDisk, info.Disk),
-		fmt.Sprintf(`qm set $VMID --ide0 local:iso/%s,media=cdrom`, winName),
-		fmt.Sprintf(`qm set $VMID --ide1 local:iso/%s,media=cdrom`, filepath.Base(info.VirtIO)),
+		fmt.Sprintf(`qm set $VMID --ide0 %s`, utils.ShellQuote(isoStorage.VolumeID(winName)+",media=cdrom")),
+		fmt.Sprintf(`qm set $VMID --ide1 %s`, utils.ShellQuote(isoStorage.VolumeID(info.VirtIO)+",media=cdrom")),
 		`qm set $VMID --boot order='scsi0;ide0;ide1'`,
 		`qm set $VMID --agent enabled=1,fstrim_cloned_disks=1`,
 		tpmStr,
-		fmt.Sprintf("qm set %d --ostype win%d", vmid, winID),
+		fmt.Sprintf("qm set %d --ostype %s", vmid, osType),
 		`echo "VMOK"`,
 	)
 	//fmt.Println(strings.Join(scripts, "\n"))
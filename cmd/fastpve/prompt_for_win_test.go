@@ -32,18 +32,6 @@ func (f *fakeDownloader) HeadInfo(urlStr string) (int64, time.Time, error) {
 	return res.size, res.mod, res.err
 }
 
-func (f *fakeDownloader) ResumableDownloader(_ context.Context, urlStr, targetFile string, status *downloader.DownloadStatus, _ chan *downloader.ProgressInfo) error {
-	res, ok := f.head[urlStr]
-	if !ok {
-		return errors.New("url not found")
-	}
-	if status.TotalSize == 0 {
-		status.TotalSize = res.size
-	}
-	status.ModTime = res.mod
-	return os.WriteFile(targetFile, []byte("ok"), 0644)
-}
-
 func (f *fakeDownloader) DownloadStatusVerify(status *downloader.DownloadStatus, remoteSize int64, remoteModTime time.Time) bool {
 	return status.TotalSize == remoteSize && status.ModTime.Equal(remoteModTime)
 }
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestMainMenuLabels(t *testing.T) {
+	labeled := make(map[mainSelection]bool, len(mainMenu))
+	for _, sel := range mainMenu {
+		labeled[sel] = true
+	}
+	for sel := selectChangeSources; sel <= selectInstallCustomISO; sel++ {
+		if !labeled[sel] {
+			t.Errorf("main selection %d has no menu label", sel)
+		}
+	}
+	if !labeled[selectQuit] {
+		t.Error("no menu label to quit")
+	}
+}
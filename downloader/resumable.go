@@ -4,15 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"sync"
 	"time"
-
-	"github.com/linkease/fastpve/utils"
 )
 
 var ErrNoRedirectFound = errors.New("no redirect found")
@@ -25,6 +20,12 @@ type DownloadStatus struct {
 	TotalSize  int64     `json:"total_size"`
 	Curr       int64     `json:"curr"`
 	ModTime    time.Time `json:"mod_time"`
+	// Checksum is the "algo:hex" digest the finished file is verified against, kept so
+	// that a resumed download is still verified.
+	Checksum string `json:"checksum,omitempty"`
+	// Fallback lists the locations to download from instead when the file came from a
+	// LAN peer and fails verification.
+	Fallback []string `json:"fallback,omitempty"`
 }
 
 func ReadUpdateDownload(statusPath string) (*DownloadStatus, error) {
@@ -45,143 +46,6 @@ func UpdateDownloadStatus(status *DownloadStatus, statusPath string) error {
 	return os.WriteFile(statusPath, data, 0644)
 }
 
-type ProgressInfo struct {
-	Status   *DownloadStatus
-	Progress int64
-	Speed    int64
-}
-
-func (d *Downloader) ResumableDownloader(ctx context.Context,
-	urlStr, filePath string,
-	status *DownloadStatus,
-	progressCh chan *ProgressInfo) error {
-	var req *http.Request
-	/* statusPath := filepath.Base(filePath) + ".syn"
-	status, err := ReadUpdateDownload(statusPath)
-	isValid := true
-	if err != nil ||
-		status.Url != urlStr ||
-		status.TargetFile != filePath {
-		isValid = false
-		status = &DownloadStatus{
-			Url:        urlStr,
-			TargetFile: filePath,
-			Curr:       0,
-		}
-	} */
-
-	// Open file for writing
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	isValid := d.statusIsValid(urlStr, file, status)
-
-	if isValid {
-		// Resume download from current position
-		req, err = http.NewRequestWithContext(ctx, "GET", urlStr, nil)
-		if err != nil {
-			return err
-		}
-		req.Header.Add("Range", fmt.Sprintf("bytes=%d-", status.Curr))
-	} else {
-		status.Curr = 0
-		req, err = http.NewRequestWithContext(ctx, "GET", urlStr, nil)
-		if err != nil {
-			return err
-		}
-	}
-	file.Seek(status.Curr, io.SeekStart)
-
-	resp, err := d.client.Do(req)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HTTP error: %s", resp.Status)
-	}
-	var once sync.Once
-	defer once.Do(func() {
-		resp.Body.Close()
-	})
-
-	const waitTimeout = time.Second * 60
-	const sizeMin = 8 * 1024 * 1024
-	const sizeMax = 256 * 1024 * 1024
-	buf := make([]byte, 2*1024*1024)
-	var n int64
-	var defSize int64 = sizeMin
-
-	doneCh := make(chan struct{})
-	loopCh := make(chan struct{}, 1)
-	timeoutTick := time.NewTimer(waitTimeout)
-	go func() {
-	LOOP_SEL:
-		for {
-			select {
-			case <-timeoutTick.C:
-				fmt.Println("Download timeout")
-				once.Do(func() {
-					resp.Body.Close()
-				})
-				break LOOP_SEL
-			case <-loopCh:
-				utils.ResetTimer(timeoutTick, waitTimeout)
-			case <-doneCh:
-				break LOOP_SEL
-			}
-		}
-	}()
-
-	for {
-		now := time.Now()
-		n, err = io.CopyBuffer(file, io.LimitReader(resp.Body, defSize), buf)
-		status.Curr += n
-		select {
-		case loopCh <- struct{}{}:
-		default:
-		}
-		since := time.Since(now)
-		if since < time.Second*5 {
-			defSize *= 2
-			if defSize > sizeMax {
-				defSize = sizeMax
-			}
-		} else {
-			defSize = defSize / 2
-			if defSize < sizeMin {
-				defSize = sizeMin
-			}
-		}
-		speed := 1000 * n / (since.Milliseconds() + 1)
-		var progress int64
-		if status.TotalSize > 0 {
-			progress = status.Curr * 100 / status.TotalSize
-		}
-
-		select {
-		case progressCh <- &ProgressInfo{
-			Status:   status,
-			Speed:    speed,
-			Progress: progress,
-		}:
-		default:
-			// Not block here
-		}
-
-		//UpdateDownloadStatus(status, statusPath)
-		if err != nil || n == 0 {
-			break
-		}
-	}
-
-	if err == io.EOF {
-		err = nil
-	}
-	return err
-}
-
 func (d *Downloader) HeadInfo(urlStr string) (int64, time.Time, error) {
 	founds := []string{urlStr}
 	var total int64
@@ -270,30 +134,3 @@ func (d *Downloader) DownloadStatusVerify(status *DownloadStatus, remoteSize int
 	}
 	return true
 }
-
-func (d *Downloader) statusIsValid(urlStr string, file *os.File, status *DownloadStatus) bool {
-	remoteSize, remoteModTime, err := d.HeadInfo(urlStr)
-	if err != nil {
-		fmt.Println("Range request failed, err=", err)
-		return false
-	}
-
-	if status.TotalSize != remoteSize ||
-		!status.ModTime.Equal(remoteModTime) {
-		status.ModTime = remoteModTime
-		status.TotalSize = remoteSize
-		return false
-	}
-
-	if file != nil {
-		p0, _ := file.Seek(0, io.SeekStart)
-		p1, err := file.Seek(0, io.SeekEnd)
-		if err != nil {
-			return false
-		}
-		if p1-p0 < status.Curr {
-			return false
-		}
-	}
-	return true
-}
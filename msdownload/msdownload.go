@@ -0,0 +1,390 @@
+// Package msdownload resolves Windows ISO download links from Microsoft without
+// external tools: consumer Windows 10/11 through the software-download session, SKU and
+// link API, Windows Server and LTSC editions through the Evaluation Center pages. The
+// flow is the one of the Mido project, which the quickget script implements in bash.
+package msdownload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultBaseURL   = "https://www.microsoft.com"
+	DefaultPermitURL = "https://vlscppe.microsoft.com"
+
+	// profile and orgID are the constants the Microsoft download page itself sends.
+	profile   = "606624d44113"
+	orgID     = "y6jn8c31"
+	userAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:100.0) Gecko/20100101 Firefox/100.0"
+
+	maxPageSize = 1 << 20
+	maxAPISize  = 100 << 10
+)
+
+var (
+	// ErrRateLimited is returned when Microsoft asks to retry later.
+	ErrRateLimited = errors.New("microsoft download api rate limited")
+	// ErrBlocked is returned when Microsoft rejects automated downloads from the
+	// region or IP address of the caller.
+	ErrBlocked = errors.New("microsoft blocked the download request for this region or ip")
+	// ErrEditionUnavailable is returned when the release or language is not offered.
+	ErrEditionUnavailable = errors.New("windows edition unavailable")
+)
+
+var (
+	productEditionPattern = regexp.MustCompile(`<option value="([0-9]+)">Windows`)
+	evalLinkPattern       = regexp.MustCompile(`https?://[^"'\s<>]*fwlink/p/\?LinkID=[0-9]+&(?:amp;)?clcid=0x[0-9a-f]+&(?:amp;)?culture=([a-z]{2}-[a-z]{2})&(?:amp;)?country=([A-Z]{2})`)
+)
+
+// evalCultures maps the Evaluation Center languages to their culture codes, in menu order.
+var evalCultures = []struct{ language, culture string }{
+	{"English (United States)", "en-us"},
+	{"English (Great Britain)", "en-gb"},
+	{"Chinese (Simplified)", "zh-cn"},
+	{"Chinese (Traditional)", "zh-tw"},
+	{"French", "fr-fr"},
+	{"German", "de-de"},
+	{"Italian", "it-it"},
+	{"Japanese", "ja-jp"},
+	{"Korean", "ko-kr"},
+	{"Portuguese (Brazil)", "pt-br"},
+	{"Spanish", "es-es"},
+	{"Russian", "ru-ru"},
+}
+
+// Client talks to the Microsoft download endpoints; tests point BaseURL and
+// PermitURL at a local server.
+type Client struct {
+	HTTP      *http.Client
+	BaseURL   string
+	PermitURL string
+}
+
+// NewClient returns a client for the Microsoft endpoints; a nil client uses http.DefaultClient.
+func NewClient(client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{HTTP: client, BaseURL: DefaultBaseURL, PermitURL: DefaultPermitURL}
+}
+
+// URL returns the x64 ISO link of a release in quickget terms: osName is "windows" or
+// "windows-server", release is "11", "10", "11-ltsc", "11-iot-ltsc", "2022"...
+func (c *Client) URL(ctx context.Context, osName, release, language string) (string, error) {
+	if page, kind, ok := evalPage(osName, release); ok {
+		return c.evalURL(ctx, page, kind, language)
+	}
+	return c.consumerURL(ctx, release, language)
+}
+
+// Languages lists the languages a release is offered in.
+func (c *Client) Languages(ctx context.Context, osName, release string) ([]string, error) {
+	if page, _, ok := evalPage(osName, release); ok {
+		links, err := c.evalLinks(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		var languages []string
+		for _, ec := range evalCultures {
+			if len(links[ec.culture]) > 0 {
+				languages = append(languages, ec.language)
+			}
+		}
+		return languages, nil
+	}
+	s, err := c.newSession(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+	skus, err := c.skus(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	languages := make([]string, 0, len(skus))
+	for _, sku := range skus {
+		languages = append(languages, sku.name())
+	}
+	return languages, nil
+}
+
+// evalPage returns the Evaluation Center page of the releases downloaded from there and
+// which of the links of a language is the x64 ISO.
+func evalPage(osName, release string) (page, kind string, ok bool) {
+	switch {
+	case osName == "windows-server":
+		return "windows-server-" + release, "server", true
+	case strings.HasSuffix(release, "-iot-ltsc"):
+		return "windows-" + strings.TrimSuffix(release, "-iot-ltsc") + "-iot-enterprise-ltsc-eval", "iot", true
+	case strings.HasSuffix(release, "-ltsc"):
+		return "windows-" + strings.TrimSuffix(release, "-ltsc") + "-enterprise", "ltsc", true
+	}
+	return "", "", false
+}
+
+type session struct {
+	id               string
+	page             string
+	productEditionID string
+}
+
+type sku struct {
+	ID                string `json:"Id"`
+	Language          string `json:"Language"`
+	LocalizedLanguage string `json:"LocalizedLanguage"`
+}
+
+func (s sku) name() string {
+	if s.LocalizedLanguage != "" {
+		return s.LocalizedLanguage
+	}
+	return s.Language
+}
+
+type apiErrors struct {
+	Errors []struct {
+		Key   string `json:"Key"`
+		Value string `json:"Value"`
+	} `json:"Errors"`
+}
+
+// newSession reads the product edition of the newest release from the download page
+// and registers a new session id, as the page does before any API call.
+func (c *Client) newSession(ctx context.Context, release string) (*session, error) {
+	page := c.BaseURL + "/en-us/software-download/windows" + release
+	if release == "10" {
+		page += "ISO"
+	}
+	html, err := c.get(ctx, page, "", maxPageSize)
+	if err != nil {
+		return nil, err
+	}
+	m := productEditionPattern.FindStringSubmatch(string(html))
+	if m == nil {
+		return nil, fmt.Errorf("%w: no product edition on %s", ErrEditionUnavailable, page)
+	}
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.get(ctx, c.PermitURL+"/tags?org_id="+orgID+"&session_id="+id, "", maxAPISize); err != nil {
+		return nil, fmt.Errorf("permit session: %w", err)
+	}
+	return &session{id: id, page: page, productEditionID: m[1]}, nil
+}
+
+func (c *Client) skus(ctx context.Context, s *session) ([]sku, error) {
+	query := url.Values{
+		"profile":          {profile},
+		"ProductEditionId": {s.productEditionID},
+		"SKU":              {"undefined"},
+		"friendlyFileName": {"undefined"},
+		"Locale":           {"en-US"},
+		"sessionID":        {s.id},
+	}
+	body, err := c.get(ctx, c.BaseURL+"/software-download-connector/api/getskuinformationbyproductedition?"+query.Encode(), "", maxAPISize)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		apiErrors
+		Skus []sku `json:"Skus"`
+	}
+	if blocked(string(body)) {
+		return nil, ErrBlocked
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("sku list: %w", err)
+	}
+	if err := checkAPIErrors(resp.apiErrors); err != nil {
+		return nil, err
+	}
+	return resp.Skus, nil
+}
+
+func (c *Client) consumerURL(ctx context.Context, release, language string) (string, error) {
+	s, err := c.newSession(ctx, release)
+	if err != nil {
+		return "", err
+	}
+	skus, err := c.skus(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	var skuID string
+	for _, sku := range skus {
+		if sku.Language == language || sku.LocalizedLanguage == language {
+			skuID = sku.ID
+			break
+		}
+	}
+	if skuID == "" {
+		return "", fmt.Errorf("%w: windows %s has no %s download", ErrEditionUnavailable, release, language)
+	}
+
+	query := url.Values{
+		"profile":          {profile},
+		"productEditionId": {"undefined"},
+		"SKU":              {skuID},
+		"friendlyFileName": {"undefined"},
+		"Locale":           {"en-US"},
+		"sessionID":        {s.id},
+	}
+	// Microsoft rejects this request without the download page as referer.
+	body, err := c.get(ctx, c.BaseURL+"/software-download-connector/api/GetProductDownloadLinksBySku?"+query.Encode(), s.page, maxAPISize)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		apiErrors
+		ProductDownloadOptions []struct {
+			URI string `json:"Uri"`
+		} `json:"ProductDownloadOptions"`
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return "", errors.New("download links: empty response")
+	}
+	if blocked(string(body)) {
+		return "", ErrBlocked
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("download links: %w", err)
+	}
+	if err := checkAPIErrors(resp.apiErrors); err != nil {
+		return "", err
+	}
+	for _, option := range resp.ProductDownloadOptions {
+		if strings.Contains(option.URI, "x64") {
+			return option.URI, nil
+		}
+	}
+	return "", fmt.Errorf("%w: windows %s %s has no x64 iso", ErrEditionUnavailable, release, language)
+}
+
+// evalLinks returns the ISO links of an Evaluation Center page by culture, in page order.
+func (c *Client) evalLinks(ctx context.Context, page string) (map[string][]string, error) {
+	html, err := c.get(ctx, c.BaseURL+"/en-us/evalcenter/download-"+page, "", maxPageSize)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string][]string)
+	for _, m := range evalLinkPattern.FindAllStringSubmatch(string(html), -1) {
+		link := strings.ReplaceAll(m[0], "&amp;", "&")
+		links[m[1]] = append(links[m[1]], link)
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("%w: no download link on %s", ErrEditionUnavailable, page)
+	}
+	return links, nil
+}
+
+func (c *Client) evalURL(ctx context.Context, page, kind, language string) (string, error) {
+	var culture string
+	for _, ec := range evalCultures {
+		if ec.language == language {
+			culture = ec.culture
+			break
+		}
+	}
+	if culture == "" {
+		return "", fmt.Errorf("%w: %s is not offered in %s", ErrEditionUnavailable, page, language)
+	}
+	links, err := c.evalLinks(ctx, page)
+	if err != nil {
+		return "", err
+	}
+	// Enterprise pages list the x86 and x64 ISOs, then the LTSC x86 and x64 ones; server
+	// and IoT LTSC pages start with the x64 ISO.
+	index := 0
+	if kind == "ltsc" {
+		index = 3
+	}
+	if index >= len(links[culture]) {
+		return "", fmt.Errorf("%w: %s has no %s iso", ErrEditionUnavailable, page, language)
+	}
+
+	// Follow the fwlink redirects to the ISO itself, for a useful file name and log line.
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, links[culture][index], nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if err := statusError(resp); err != nil {
+		return "", err
+	}
+	return resp.Request.URL.String(), nil
+}
+
+func (c *Client) get(ctx context.Context, urlStr, referer string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if referer != "" {
+		req.Header.Set("Referer", referer)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := statusError(resp); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s: response larger than %d bytes", urlStr, limit)
+	}
+	return data, nil
+}
+
+func statusError(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", ErrRateLimited, resp.Request.URL.Path)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("%s: %s", resp.Request.URL.Redacted(), resp.Status)
+	}
+	return nil
+}
+
+// checkAPIErrors turns the "Errors" list of an API answer into an error.
+func checkAPIErrors(e apiErrors) error {
+	if len(e.Errors) > 0 {
+		return fmt.Errorf("microsoft download api: %s: %s", e.Errors[0].Key, e.Errors[0].Value)
+	}
+	return nil
+}
+
+// blocked recognizes the rejection of automated downloads: the "Sentinel" message, or
+// error 715-123130 of the download page.
+func blocked(body string) bool {
+	return strings.Contains(body, "Sentinel marked this request as rejected") || strings.Contains(body, "715-123130")
+}
+
+// newSessionID returns a random (version 4) UUID.
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
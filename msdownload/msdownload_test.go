@@ -0,0 +1,163 @@
+package msdownload
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// standIn replays the responses recorded in testdata for the Microsoft endpoints.
+type standIn struct {
+	srv      *httptest.Server
+	mu       sync.Mutex
+	sessions map[string]bool
+	links    string // testdata file answering GetProductDownloadLinksBySku
+	status   int    // status of GetProductDownloadLinksBySku, 0 for 200
+}
+
+func newStandIn(t *testing.T) (*standIn, *Client) {
+	s := &standIn{sessions: make(map[string]bool), links: "GetProductDownloadLinksBySku.json"}
+	mux := http.NewServeMux()
+	replay := func(w http.ResponseWriter, name string) {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Errorf("testdata: %v", err)
+		}
+		w.Write([]byte(strings.ReplaceAll(string(data), "https://go.microsoft.com", s.srv.URL)))
+	}
+	mux.HandleFunc("/en-us/software-download/windows11", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.UserAgent(), "Mozilla") {
+			http.Error(w, "browser required", http.StatusForbidden)
+			return
+		}
+		replay(w, "software-download-windows11.html")
+	})
+	mux.HandleFunc("/tags", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.sessions[r.URL.Query().Get("session_id")] = true
+		s.mu.Unlock()
+	})
+	mux.HandleFunc("/software-download-connector/api/getskuinformationbyproductedition", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		permitted := s.sessions[r.URL.Query().Get("sessionID")]
+		s.mu.Unlock()
+		if !permitted || r.URL.Query().Get("ProductEditionId") != "3113" {
+			http.Error(w, `{"Errors":[{"Key":"ErrorSettings.InvalidSession","Value":"invalid session"}]}`, http.StatusOK)
+			return
+		}
+		replay(w, "getskuinformationbyproductedition.json")
+	})
+	mux.HandleFunc("/software-download-connector/api/GetProductDownloadLinksBySku", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.Referer(), "/en-us/software-download/windows11") || r.URL.Query().Get("SKU") != "18484" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if s.status != 0 {
+			w.WriteHeader(s.status)
+			return
+		}
+		replay(w, s.links)
+	})
+	mux.HandleFunc("/en-us/evalcenter/download-windows-server-2022", func(w http.ResponseWriter, r *http.Request) {
+		replay(w, "evalcenter-download-windows-server-2022.html")
+	})
+	mux.HandleFunc("/fwlink/p/", func(w http.ResponseWriter, r *http.Request) {
+		culture := r.URL.Query().Get("culture")
+		http.Redirect(w, r, "/dl/SERVER_EVAL_x64FRE_"+culture+".iso", http.StatusFound)
+	})
+	mux.HandleFunc("/dl/", func(w http.ResponseWriter, r *http.Request) {})
+	s.srv = httptest.NewServer(mux)
+	t.Cleanup(s.srv.Close)
+
+	c := NewClient(s.srv.Client())
+	c.BaseURL, c.PermitURL = s.srv.URL, s.srv.URL
+	return s, c
+}
+
+func TestConsumerURL(t *testing.T) {
+	s, c := newStandIn(t)
+	ctx := context.Background()
+
+	urlStr, err := c.URL(ctx, "windows", "11", "Chinese (Simplified)")
+	if err != nil {
+		t.Fatalf("URL: %v", err)
+	}
+	if !strings.HasPrefix(urlStr, "https://software.download.prss.microsoft.com/dbazure/Win11_24H2_Chinese_Simplified_x64.iso?") {
+		t.Fatalf("unexpected url %s", urlStr)
+	}
+
+	languages, err := c.Languages(ctx, "windows", "11")
+	if err != nil {
+		t.Fatalf("Languages: %v", err)
+	}
+	if got := strings.Join(languages, ","); got != "Arabic,Chinese (Simplified),English International,English (United States)" {
+		t.Fatalf("Languages = %s", got)
+	}
+
+	if _, err := c.URL(ctx, "windows", "11", "Klingon"); !errors.Is(err, ErrEditionUnavailable) {
+		t.Fatalf("unknown language: got %v, want ErrEditionUnavailable", err)
+	}
+
+	s.links = "GetProductDownloadLinksBySku-rejected.json"
+	if _, err := c.URL(ctx, "windows", "11", "Chinese (Simplified)"); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("rejected request: got %v, want ErrBlocked", err)
+	}
+
+	s.status = http.StatusTooManyRequests
+	if _, err := c.URL(ctx, "windows", "11", "Chinese (Simplified)"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("throttled request: got %v, want ErrRateLimited", err)
+	}
+}
+
+func TestEvalURL(t *testing.T) {
+	s, c := newStandIn(t)
+	ctx := context.Background()
+
+	urlStr, err := c.URL(ctx, "windows-server", "2022", "Chinese (Simplified)")
+	if err != nil {
+		t.Fatalf("URL: %v", err)
+	}
+	if urlStr != s.srv.URL+"/dl/SERVER_EVAL_x64FRE_zh-cn.iso" {
+		t.Fatalf("unexpected url %s", urlStr)
+	}
+
+	languages, err := c.Languages(ctx, "windows-server", "2022")
+	if err != nil {
+		t.Fatalf("Languages: %v", err)
+	}
+	if got := strings.Join(languages, ","); got != "English (United States),Chinese (Simplified),French" {
+		t.Fatalf("Languages = %s", got)
+	}
+
+	if _, err := c.URL(ctx, "windows-server", "2022", "Japanese"); !errors.Is(err, ErrEditionUnavailable) {
+		t.Fatalf("missing language: got %v, want ErrEditionUnavailable", err)
+	}
+	if _, err := c.URL(ctx, "windows", "10-ltsc", "English (United States)"); err == nil {
+		t.Fatal("missing page succeeded")
+	}
+}
+
+func TestEvalPage(t *testing.T) {
+	tests := []struct {
+		osName, release, page, kind string
+	}{
+		{"windows-server", "2025", "windows-server-2025", "server"},
+		{"windows", "11-ltsc", "windows-11-enterprise", "ltsc"},
+		{"windows", "11-iot-ltsc", "windows-11-iot-enterprise-ltsc-eval", "iot"},
+	}
+	for _, tt := range tests {
+		page, kind, ok := evalPage(tt.osName, tt.release)
+		if !ok || page != tt.page || kind != tt.kind {
+			t.Errorf("evalPage(%s, %s) = %s, %s, %v", tt.osName, tt.release, page, kind, ok)
+		}
+	}
+	if _, _, ok := evalPage("windows", "11"); ok {
+		t.Error("windows 11 is not an evaluation download")
+	}
+}
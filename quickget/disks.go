@@ -0,0 +1,136 @@
+package quickget
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const diskByIDDir = "/dev/disk/by-id"
+
+// PhysicalDisk is a whole disk of the PVE host that can be passed through to a VM.
+type PhysicalDisk struct {
+	Name   string // kernel name, e.g. sdb
+	ByID   string // stable /dev/disk/by-id path used for passthrough
+	Size   string
+	Model  string
+	Serial string
+	// InUse is set when the disk or one of its partitions is mounted or holds
+	// LVM/ZFS/RAID members, which is the case for the PVE system disk.
+	InUse bool
+}
+
+type lsblkDevice struct {
+	Name        string         `json:"name"`
+	Type        string         `json:"type"`
+	Size        string         `json:"size"`
+	Model       string         `json:"model"`
+	Serial      string         `json:"serial"`
+	FSType      string         `json:"fstype"`
+	Mountpoints []string       `json:"mountpoints"`
+	Children    []*lsblkDevice `json:"children"`
+}
+
+// PhysicalDisks lists the host disks together with their /dev/disk/by-id names.
+func PhysicalDisks() ([]*PhysicalDisk, error) {
+	out, err := exec.Command("lsblk", "-J", "-o", "NAME,TYPE,SIZE,MODEL,SERIAL,FSTYPE,MOUNTPOINTS").Output()
+	if err != nil {
+		return nil, err
+	}
+	disks, err := parseLsblk(out)
+	if err != nil {
+		return nil, err
+	}
+	entries, _ := os.ReadDir(diskByIDDir)
+	byID := make(map[string][]string)
+	for _, entry := range entries {
+		target, err := filepath.EvalSymlinks(filepath.Join(diskByIDDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		dev := filepath.Base(target)
+		byID[dev] = append(byID[dev], entry.Name())
+	}
+	for _, disk := range disks {
+		if id := preferredDiskID(byID[disk.Name]); id != "" {
+			disk.ByID = filepath.Join(diskByIDDir, id)
+		}
+	}
+	return disks, nil
+}
+
+func parseLsblk(out []byte) ([]*PhysicalDisk, error) {
+	var result struct {
+		Devices []*lsblkDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, err
+	}
+	var disks []*PhysicalDisk
+	for _, dev := range result.Devices {
+		if dev.Type != "disk" || strings.HasPrefix(dev.Name, "zd") {
+			continue
+		}
+		disks = append(disks, &PhysicalDisk{
+			Name:   dev.Name,
+			Size:   dev.Size,
+			Model:  strings.TrimSpace(dev.Model),
+			Serial: strings.TrimSpace(dev.Serial),
+			InUse:  deviceInUse(dev),
+		})
+	}
+	return disks, nil
+}
+
+func deviceInUse(dev *lsblkDevice) bool {
+	for _, mp := range dev.Mountpoints {
+		if mp != "" {
+			return true
+		}
+	}
+	switch dev.FSType {
+	case "LVM2_member", "zfs_member", "linux_raid_member", "swap":
+		return true
+	}
+	for _, child := range dev.Children {
+		if deviceInUse(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferredDiskID picks the most descriptive by-id name of a disk, skipping the
+// wwn/eui aliases that carry no model information.
+func preferredDiskID(ids []string) string {
+	var candidates []string
+	for _, id := range ids {
+		if strings.Contains(id, "-part") {
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		gi, gj := genericDiskID(candidates[i]), genericDiskID(candidates[j])
+		if gi != gj {
+			return !gi
+		}
+		return candidates[i] < candidates[j]
+	})
+	return candidates[0]
+}
+
+func genericDiskID(id string) bool {
+	for _, prefix := range []string{"wwn-", "eui.", "nvme-eui.", "nvme-nvme."} {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
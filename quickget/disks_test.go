@@ -0,0 +1,43 @@
+package quickget
+
+import "testing"
+
+var lsblkOut = `{
+   "blockdevices": [
+      {"name":"sda", "type":"disk", "size":"3.6T", "model":"WDC WD40EFRX-68N32N0 ", "serial":"WD-WCC7K0000001", "fstype":null, "mountpoints":[null]},
+      {"name":"nvme0n1", "type":"disk", "size":"476.9G", "model":"Samsung SSD 980", "serial":"S64DNX0R000000", "fstype":null, "mountpoints":[null],
+         "children": [
+            {"name":"nvme0n1p2", "type":"part", "size":"1G", "model":null, "serial":null, "fstype":"vfat", "mountpoints":["/boot/efi"]},
+            {"name":"nvme0n1p3", "type":"part", "size":"475G", "model":null, "serial":null, "fstype":"LVM2_member", "mountpoints":[null]}
+         ]
+      },
+      {"name":"zd0", "type":"disk", "size":"32G", "model":null, "serial":null, "fstype":null, "mountpoints":[null]},
+      {"name":"sr0", "type":"rom", "size":"1024M", "model":"QEMU DVD-ROM", "serial":null, "fstype":null, "mountpoints":[null]}
+   ]
+}`
+
+func TestParseLsblk(t *testing.T) {
+	disks, err := parseLsblk([]byte(lsblkOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disks) != 2 {
+		t.Fatalf("got %d disks, want 2", len(disks))
+	}
+	if disks[0].Name != "sda" || disks[0].InUse || disks[0].Model != "WDC WD40EFRX-68N32N0" {
+		t.Fatalf("sda = %+v", disks[0])
+	}
+	if disks[1].Name != "nvme0n1" || !disks[1].InUse {
+		t.Fatalf("nvme0n1 = %+v", disks[1])
+	}
+}
+
+func TestPreferredDiskID(t *testing.T) {
+	ids := []string{"wwn-0x50014ee2b0000001", "ata-WDC_WD40EFRX-68N32N0_WD-WCC7K0000001", "ata-WDC_WD40EFRX-68N32N0_WD-WCC7K0000001-part1"}
+	if got := preferredDiskID(ids); got != "ata-WDC_WD40EFRX-68N32N0_WD-WCC7K0000001" {
+		t.Fatalf("preferredDiskID = %s", got)
+	}
+	if got := preferredDiskID([]string{"wwn-0x1"}); got != "wwn-0x1" {
+		t.Fatalf("preferredDiskID = %s", got)
+	}
+}
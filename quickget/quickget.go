@@ -1,15 +1,19 @@
 package quickget
 
 import (
+	"bytes"
 	"context"
 	"embed"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"regexp"
 	"strings"
+
+	"github.com/linkease/fastpve/utils"
 )
 
 //go:embed scripts/*
@@ -35,43 +39,224 @@ func CreateQuickGet() (string, error) {
 	return tmpFile.Name(), nil
 }
 
-func ParseLastURL(input string) (string, error) {
-	if strings.Contains(input, "failing HTTP status code") {
-		return "", fmt.Errorf("HTTP status code error")
-	}
+// Result is the machine-readable answer of "quickget --json <os> <release> [edition]".
+type Result struct {
+	URL  string `json:"url"`
+	File string `json:"file"`
+	// Checksum is "algo:hex" when quickget knows the hash of the image, or empty.
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+	Error    string `json:"error"`
+}
+
+// ErrLookup is returned when quickget cannot resolve a download URL.
+var ErrLookup = errors.New("quickget lookup failed")
 
-	// 使用正则表达式匹配最后一个 xxx: 后的 URL
-	re := regexp.MustCompile(`[^:]+:\s+(https?://[^\s]+)\s*$`)
+// outputTail is how much of quickget's output is kept in errors.
+const outputTail = 512
 
-	// 查找所有匹配项
-	matches := re.FindAllStringSubmatch(input, -1)
-	if len(matches) == 0 {
-		return "", fmt.Errorf("no URL found in input")
+// ParseResult reads the JSON line quickget prints last in --json mode; the lines before
+// it are progress messages.
+func ParseResult(output []byte) (*Result, error) {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var res Result
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrLookup, err)
+		}
+		if res.Checksum != "" && !strings.Contains(res.Checksum, ":") {
+			// Guess the algorithm by the hash length, as quickget's check_hash does.
+			if algo, ok := utils.ChecksumAlgo(res.Checksum); ok {
+				res.Checksum = algo + ":" + strings.ToLower(res.Checksum)
+			} else {
+				res.Checksum = ""
+			}
+		}
+		return &res, nil
 	}
+	return nil, fmt.Errorf("%w: no result in output", ErrLookup)
+}
 
-	// 获取最后一个匹配的 URL
-	lastMatch := matches[len(matches)-1]
-	if len(lastMatch) < 2 {
-		return "", fmt.Errorf("invalid URL format")
+// Lookup extracts the quickget script and asks it for the image of an OS release as JSON.
+// Failures carry the messages quickget printed, such as the "ERROR! ..." lines it writes to
+// stdout before exiting, and the tail of its stderr. The Windows downloads need the tools of
+// EnsureDependencies.
+func Lookup(ctx context.Context, osName, release, edition string) (*Result, error) {
+	path, err := CreateQuickGet()
+	if err != nil {
+		return nil, err
 	}
+	defer os.Remove(path)
 
-	// 清理 URL 中的换行符和空格
-	url := strings.TrimSpace(lastMatch[1])
-	if strings.Contains(url, "virtio-win") {
-		return "", errors.New("URL contains virtio-win")
+	args := []string{"--json", osName, release}
+	if edition != "" {
+		args = append(args, edition)
 	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
 
-	return url, nil
+	res, err := ParseResult(stdout.Bytes())
+	switch {
+	case err == nil && res.Error == "" && res.URL != "":
+		return res, nil
+	case err == nil && res.Error != "":
+		err = fmt.Errorf("%w: %s", ErrLookup, res.Error)
+	case err == nil:
+		err = fmt.Errorf("%w: empty url", ErrLookup)
+	case runErr != nil:
+		err = fmt.Errorf("%w: %v", ErrLookup, runErr)
+	}
+	for _, msg := range []string{messageTail(stdout.String(), outputTail), tail(stderr.String(), outputTail)} {
+		if msg != "" {
+			err = fmt.Errorf("%w\n%s", err, msg)
+		}
+	}
+	return nil, err
+}
+
+// Entry is one row of "quickget --list-csv".
+type Entry struct {
+	DisplayName string
+	OS          string
+	Release     string
+	// Option is the edition, or the language of Windows releases.
+	Option string
 }
 
-func GetSystemURL(ctx context.Context, quickget string, args []string) (string, error) {
-	cmd := exec.CommandContext(ctx, quickget, args...)
+// List returns what quickget can download of an OS, or of every OS when osName is empty.
+func List(ctx context.Context, osName string) ([]Entry, error) {
+	path, err := CreateQuickGet()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+
+	args := []string{"--list-csv"}
+	if osName != "" {
+		args = append(args, osName)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = &stderr
 	output, err := cmd.Output()
 	if err != nil {
-		return "", err
+		if msg := tail(stderr.String(), outputTail); msg != "" {
+			return nil, fmt.Errorf("quickget --list-csv: %w\n%s", err, msg)
+		}
+		return nil, fmt.Errorf("quickget --list-csv: %w", err)
+	}
+	return ParseList(output)
+}
+
+// ParseList parses the CSV printed by "quickget --list-csv", skipping the header.
+func ParseList(output []byte) ([]Entry, error) {
+	r := csv.NewReader(bytes.NewReader(output))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for i, rec := range records {
+		if len(rec) < 4 || (i == 0 && rec[0] == "Display Name") {
+			continue
+		}
+		entries = append(entries, Entry{DisplayName: rec[0], OS: rec[1], Release: rec[2], Option: rec[3]})
+	}
+	return entries, nil
+}
+
+// Distro is an OS the quickget script supports.
+type Distro struct {
+	ID   string
+	Name string
+}
+
+// Distros lists the OSes of "quickget --list-os". Unlike List, it does not look up
+// releases and needs no network.
+func Distros(ctx context.Context) ([]Distro, error) {
+	path, err := CreateQuickGet()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+
+	output, err := exec.CommandContext(ctx, path, "--list-os").Output()
+	if err != nil {
+		return nil, fmt.Errorf("quickget --list-os: %w", err)
+	}
+	r := csv.NewReader(bytes.NewReader(output))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var distros []Distro
+	for i, rec := range records {
+		if len(rec) < 2 || i == 0 && rec[0] == "OS" {
+			continue
+		}
+		distros = append(distros, Distro{ID: rec[0], Name: rec[1]})
+	}
+	return distros, nil
+}
+
+// messageTail returns the lines of output that are not a JSON result, from the last
+// "ERROR!" line on when there is one, cut to n bytes.
+func messageTail(output string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ERROR!") {
+			lines = lines[:0]
+		}
+		if line != "" && !strings.HasPrefix(line, "{") {
+			lines = append(lines, line)
+		}
+	}
+	msg := strings.Join(lines, "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "ERROR!") && len(msg) > n {
+		return msg[:n] + "..."
+	}
+	return tail(msg, n)
+}
+
+func tail(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		s = "..." + s[len(s)-n:]
+	}
+	return s
+}
+
+// EnsureDependencies installs jq and uuidgen, which the quickget script needs, when missing.
+func EnsureDependencies(ctx context.Context) error {
+	missing := func() []string {
+		var tools []string
+		for _, tool := range []string{"jq", "uuidgen"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				tools = append(tools, tool)
+			}
+		}
+		return tools
+	}
+	if len(missing()) == 0 {
+		return nil
+	}
+	fmt.Println("安装缺失的 jq uuidgen")
+	utils.BatchRunStdout(ctx, []string{"apt update && apt install -y jq uuid-runtime"}, 0)
+	if tools := missing(); len(tools) > 0 {
+		fmt.Println("缺少", strings.Join(tools, " "), "而且再次安装也失败")
+		return fmt.Errorf("缺少 %s", strings.Join(tools, " "))
 	}
-	input := strings.Replace(string(output), "\n", "", -1)
-	return ParseLastURL(input)
+	return nil
 }
 
 func PveReverseScripts() ([]byte, error) {
@@ -1,6 +1,8 @@
 package quickget
 
 import (
+	"context"
+	"errors"
 	"log"
 	"strings"
 	"testing"
@@ -18,26 +20,79 @@ func TestQuickGetPath(t *testing.T) {
 	}
 }
 
-func TestParseLastURL(t *testing.T) {
-	input := `
-Downloading Windows 11 (English International)   
+func TestParseResult(t *testing.T) {
+	output := `Downloading Windows 11 (English International)
  - Parsing download page: https://www.microsoft.com/en-us/software-download/windows11
- - Getting Product edition ID: 3113             
- - Permit Session ID: 6e64fd31-3ed0-4450-a33d-90c04a4d2378                                                             
- - Getting language SKU ID: 18481                                                                                           
- - Getting ISO download link...              
+ - Getting Product edition ID: 3113
  - URL: https://software.download.prss.microsoft.com/dbazure/Win11_24H2_EnglishInternational_x64.iso
-windows-11:                          https://software.download.prss.microsoft.com/dbazure/Win11_24H2_EnglishInternational_x64.is
-o?t=accb893f-365a-4492-af0d-c6e5cc12e150&P1=1748068024&P2=601&P3=2&P4=M9iVhLiSQLdZBN8xE%2fLVpuMMeWN7nFs9dYdxHzqSGrAD0dFJlBn5BmfH
-Rax3J1SGZ1aXo%2f7y6UeqyiIbRrn8e5yly%2b%2bi1ml9%2fdEQBbwJfuMSeZ%2bys824Mm5O4ugyJvdhu5%2b5%2f1PXE3C7Tj0I4IAoUjD09XkjI8BLmRfTKu5REq
-V0xEJvQFablM%2bByEQ%2bAWidLloEveLSg7vIZ8xaY8HLLd8mXWnworHlrP3jw0s%2bEltSZHh8gpBFwGz4pBx1iI3i%2bDiO67cJAJL5gCGkqLt5WfEeGMHjSJVWwU
-CZE9CIpzi5npeJ1d6uDDZnj9LEc1HPeWfbUToKSqI0GRThSJDAiQ%3d%3d
-	`
-	input = strings.Replace(input, "\n", "", -1)
-	log.Println("input=", input)
-	urlStr, err := ParseLastURL(input)
+{"url":"https://software.download.prss.microsoft.com/dbazure/Win11_24H2_EnglishInternational_x64.iso?t=accb893f","file":"Win11_24H2_EnglishInternational_x64.iso","checksum":"","size":5819484160}
+`
+	res, err := ParseResult([]byte(output))
 	if err != nil {
 		t.Fatal(err)
 	}
-	log.Println("urlStr=", urlStr)
+	if !strings.HasSuffix(res.URL, "x64.iso?t=accb893f") || res.Size != 5819484160 || res.Checksum != "" {
+		t.Fatalf("ParseResult = %+v", res)
+	}
+
+	res, err = ParseResult([]byte(`{"url":"https://example.com/a.iso","file":"a.iso","checksum":"ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789","size":0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Checksum != "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789" {
+		t.Fatalf("Checksum = %s", res.Checksum)
+	}
+
+	res, err = ParseResult([]byte("Downloading Windows 11\n{\"error\":\"Unable to get the download URL\"}\n"))
+	if err != nil || res.Error != "Unable to get the download URL" {
+		t.Fatalf("ParseResult(error) = %+v, %v", res, err)
+	}
+	if _, err := ParseResult([]byte("ERROR! Debian 12 is not a supported release.")); !errors.Is(err, ErrLookup) {
+		t.Fatalf("ParseResult(no json) = %v, want ErrLookup", err)
+	}
+}
+
+func TestLookupError(t *testing.T) {
+	_, err := Lookup(context.Background(), "alma", "1", "")
+	if !errors.Is(err, ErrLookup) || !strings.Contains(err.Error(), "ERROR! AlmaLinux 1 is not a supported release.") {
+		t.Fatalf("Lookup(alma 1) = %v, want quickget's message", err)
+	}
+	if msg := messageTail("ERROR! x is not a supported OS.\n"+strings.Repeat("os ", 400), 64); !strings.HasPrefix(msg, "ERROR! x") {
+		t.Fatalf("messageTail dropped the error line: %q", msg)
+	}
+}
+
+func TestList(t *testing.T) {
+	entries, err := List(context.Background(), "windows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, e := range entries {
+		if e.OS != "windows" {
+			t.Fatalf("List(windows) returned %+v", e)
+		}
+		if e.Release == "11" && e.Option == "Chinese (Simplified)" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("List(windows) has no Windows 11 Chinese (Simplified): %d entries", len(entries))
+	}
+}
+
+func TestDistros(t *testing.T) {
+	distros, err := Distros(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, d := range distros {
+		if d.ID == "fedora" && d.Name == "Fedora" {
+			found = true
+		}
+	}
+	if len(distros) < 50 || !found {
+		t.Fatalf("Distros = %d entries, fedora found: %v", len(distros), found)
+	}
 }
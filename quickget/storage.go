@@ -0,0 +1,166 @@
+package quickget
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	pveStorageCfg = "/etc/pve/storage.cfg"
+	// LocalISOStorage is the storage every PVE node has for ISO images.
+	LocalISOStorage = "local"
+)
+
+// ISOStorage is a PVE storage that can hold ISO images.
+type ISOStorage struct {
+	Name   string
+	Type   string
+	Path   string
+	Shared bool
+}
+
+// ISOPath is the directory PVE reads "<storage>:iso/<file>" volumes from.
+func (s *ISOStorage) ISOPath() string {
+	return filepath.Join(s.Path, "template", "iso") + "/"
+}
+
+// CachePath is the directory for partial downloads on this storage. Keeping them on the
+// same filesystem as ISOPath lets finished downloads be renamed into place.
+func (s *ISOStorage) CachePath() string {
+	return filepath.Join(s.Path, "template", "cache")
+}
+
+// VolumeID returns the volume id of an ISO file on this storage, as used in qm commands.
+func (s *ISOStorage) VolumeID(fileName string) string {
+	return s.Name + ":iso/" + filepath.Base(fileName)
+}
+
+// DefaultISOStorage is the node local storage used when nothing else is configured.
+func DefaultISOStorage() *ISOStorage {
+	return &ISOStorage{Name: LocalISOStorage, Type: "dir", Path: "/var/lib/vz"}
+}
+
+type storageCfg struct {
+	Type    string
+	Path    string
+	Shared  bool
+	Content []string
+}
+
+// sharedStorageTypes are storages that every cluster node sees by design.
+var sharedStorageTypes = map[string]bool{
+	"nfs":       true,
+	"cifs":      true,
+	"cephfs":    true,
+	"glusterfs": true,
+}
+
+// ISOStorages lists the active storages with "iso" content, shared storages first.
+func ISOStorages() ([]*ISOStorage, error) {
+	out, err := exec.Command("pvesm", "status", "--content", "iso").Output()
+	if err != nil {
+		return nil, err
+	}
+	cfgData, err := os.ReadFile(pveStorageCfg)
+	if err != nil {
+		return nil, err
+	}
+	return buildISOStorages(out, parseStorageCfg(cfgData)), nil
+}
+
+// FindISOStorage returns the iso capable storage with the given name.
+func FindISOStorage(name string) (*ISOStorage, error) {
+	storages, err := ISOStorages()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range storages {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func buildISOStorages(status []byte, cfg map[string]*storageCfg) []*ISOStorage {
+	var storages []*ISOStorage
+	lines := strings.Split(string(status), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] != "active" {
+			continue
+		}
+		name := fields[0]
+		c, ok := cfg[name]
+		if !ok || !contains(c.Content, "iso") {
+			continue
+		}
+		path := c.Path
+		if path == "" {
+			// Network storages are mounted below /mnt/pve/<storage> unless configured otherwise.
+			path = filepath.Join("/mnt/pve", name)
+		}
+		storages = append(storages, &ISOStorage{
+			Name:   name,
+			Type:   c.Type,
+			Path:   path,
+			Shared: c.Shared || sharedStorageTypes[c.Type],
+		})
+	}
+	sort.SliceStable(storages, func(i, j int) bool {
+		return storages[i].Shared && !storages[j].Shared
+	})
+	return storages
+}
+
+func parseStorageCfg(data []byte) map[string]*storageCfg {
+	items := make(map[string]*storageCfg)
+	var curr *storageCfg
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			// Section header, e.g. "nfs: nas-iso".
+			typ, name, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				curr = nil
+				continue
+			}
+			curr = &storageCfg{Type: strings.TrimSpace(typ)}
+			items[strings.TrimSpace(name)] = curr
+			continue
+		}
+		if curr == nil {
+			continue
+		}
+		key, value, _ := strings.Cut(trimmed, " ")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "path":
+			curr.Path = value
+		case "shared":
+			curr.Shared = value == "1"
+		case "content":
+			curr.Content = strings.Split(value, ",")
+		}
+	}
+	return items
+}
+
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if strings.TrimSpace(item) == s {
+			return true
+		}
+	}
+	return false
+}
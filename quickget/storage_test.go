@@ -0,0 +1,60 @@
+package quickget
+
+import "testing"
+
+var storageCfgData = `dir: local
+	path /var/lib/vz
+	content iso,vztmpl,backup
+
+lvmthin: local-lvm
+	thinpool data
+	vgname pve
+	content rootdir,images
+
+nfs: nas-iso
+	export /volume1/iso
+	path /mnt/pve/nas-iso
+	server 192.168.1.2
+	content iso,vztmpl
+
+cephfs: cephfs
+	content backup,iso
+
+dir: shared-dir
+	path /srv/iso
+	content iso
+	shared 1
+`
+
+var pvesmStatusISO = `Name             Type     Status           Total            Used       Available        %
+cephfs         cephfs     active       100000000        10000000        90000000   10.00%
+local             dir     active        98497780        12345678        81085216   12.53%
+nas-iso           nfs     active      1000000000       500000000       500000000   50.00%
+shared-dir        dir   inactive               0               0               0    0.00%
+`
+
+func TestBuildISOStorages(t *testing.T) {
+	storages := buildISOStorages([]byte(pvesmStatusISO), parseStorageCfg([]byte(storageCfgData)))
+	if len(storages) != 3 {
+		t.Fatalf("expected 3 active iso storages, got %d", len(storages))
+	}
+	if !storages[0].Shared || !storages[1].Shared || storages[2].Shared {
+		t.Fatalf("shared storages must come first: %+v %+v %+v", storages[0], storages[1], storages[2])
+	}
+	byName := make(map[string]*ISOStorage)
+	for _, s := range storages {
+		byName[s.Name] = s
+	}
+	if got := byName["cephfs"].ISOPath(); got != "/mnt/pve/cephfs/template/iso/" {
+		t.Fatalf("unexpected cephfs iso path: %s", got)
+	}
+	if got := byName["cephfs"].CachePath(); got != "/mnt/pve/cephfs/template/cache" {
+		t.Fatalf("unexpected cephfs cache path: %s", got)
+	}
+	if got := byName["nas-iso"].VolumeID("/mnt/pve/nas-iso/template/iso/win.iso"); got != "nas-iso:iso/win.iso" {
+		t.Fatalf("unexpected volume id: %s", got)
+	}
+	if byName["local"].Shared {
+		t.Fatal("local dir storage must not be shared")
+	}
+}
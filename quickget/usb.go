@@ -0,0 +1,52 @@
+package quickget
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// USBDevice is a host USB device that can be passed through by vendor:product id.
+type USBDevice struct {
+	ID   string // vendor:product, e.g. 10c4:ea60
+	Name string
+	// Zigbee marks the USB serial chips and coordinators used by common Zigbee/Z-Wave dongles.
+	Zigbee bool
+}
+
+var lsusbPattern = regexp.MustCompile(`^Bus \d+ Device \d+: ID ([0-9a-f]{4}:[0-9a-f]{4})\s*(.*)$`)
+
+var zigbeeUSBIDs = map[string]bool{
+	"10c4:ea60": true, // Silicon Labs CP210x: Sonoff ZBDongle-P, SkyConnect
+	"1a86:55d4": true, // WCH CH9102: Sonoff ZBDongle-E
+	"1a86:7523": true, // WCH CH340
+	"0451:16a8": true, // TI CC2531
+	"1cf1:0030": true, // dresden elektronik ConBee II
+	"10c4:8a2a": true, // Nortek HUSBZB-1
+	"0658:0200": true, // Aeotec Z-Stick
+}
+
+// USBDevices lists the host USB devices except the root hubs.
+func USBDevices() ([]*USBDevice, error) {
+	out, err := exec.Command("lsusb").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseLsusb(out), nil
+}
+
+func parseLsusb(out []byte) []*USBDevice {
+	var devices []*USBDevice
+	for _, line := range strings.Split(string(out), "\n") {
+		m := lsusbPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil || strings.HasPrefix(m[1], "1d6b:") {
+			continue
+		}
+		devices = append(devices, &USBDevice{
+			ID:     m[1],
+			Name:   strings.TrimSpace(m[2]),
+			Zigbee: zigbeeUSBIDs[m[1]],
+		})
+	}
+	return devices
+}
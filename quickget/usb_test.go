@@ -0,0 +1,22 @@
+package quickget
+
+import "testing"
+
+var lsusbOut = `Bus 002 Device 001: ID 1d6b:0003 Linux Foundation 3.0 root hub
+Bus 001 Device 003: ID 10c4:ea60 Silicon Labs CP210x UART Bridge
+Bus 001 Device 002: ID 046d:c52b Logitech, Inc. Unifying Receiver
+Bus 001 Device 001: ID 1d6b:0002 Linux Foundation 2.0 root hub
+`
+
+func TestParseLsusb(t *testing.T) {
+	devices := parseLsusb([]byte(lsusbOut))
+	if len(devices) != 2 {
+		t.Fatalf("got %d devices, want 2", len(devices))
+	}
+	if devices[0].ID != "10c4:ea60" || !devices[0].Zigbee || devices[0].Name != "Silicon Labs CP210x UART Bridge" {
+		t.Fatalf("device 0 = %+v", devices[0])
+	}
+	if devices[1].Zigbee {
+		t.Fatalf("device 1 = %+v", devices[1])
+	}
+}
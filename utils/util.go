@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"regexp"
 	"strings"
@@ -33,3 +34,27 @@ func ResetTimer(t *time.Timer, dur time.Duration) {
 	}
 	t.Reset(dur)
 }
+
+// ShellQuote quotes s as a single POSIX shell word.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ChecksumAlgo guesses the algorithm of a bare hex digest by its length; anything that is
+// not hex has none.
+func ChecksumAlgo(digest string) (string, bool) {
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", false
+	}
+	switch len(digest) {
+	case 32:
+		return "md5", true
+	case 40:
+		return "sha1", true
+	case 64:
+		return "sha256", true
+	case 128:
+		return "sha512", true
+	}
+	return "", false
+}
@@ -0,0 +1,32 @@
+package utils
+
+import "testing"
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"ubuntu":    `'ubuntu'`,
+		"p@ss word": `'p@ss word'`,
+		"it's":      `'it'\''s'`,
+		"":          `''`,
+	}
+	for in, want := range tests {
+		if got := ShellQuote(in); got != want {
+			t.Fatalf("ShellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestChecksumAlgo(t *testing.T) {
+	tests := map[string]string{
+		"d41d8cd98f00b204e9800998ecf8427e":                                 "md5",
+		"da39a3ee5e6b4b0d3255bfef95601890afd80709":                         "sha1",
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855": "sha256",
+		"not-a-digest-but-32-characters!!":                                 "",
+		"abc":                                                              "",
+	}
+	for in, want := range tests {
+		if got, ok := ChecksumAlgo(in); got != want || ok != (want != "") {
+			t.Fatalf("ChecksumAlgo(%q) = %s, %v, want %s", in, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package vmdownloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+)
+
+// ReleaseURLs expands a catalog release into its file name and mirror URLs,
+// discovering the latest version and build first when the release asks for it.
+func ReleaseURLs(ctx context.Context, d Downloader, rel *catalog.Release) (string, []string) {
+	return DiscoverRelease(ctx, d, rel).Expand("")
+}
+
+// DiscoverRelease returns a copy of rel with the version and file variables its
+// indexes advertise; on failure the catalog defaults are kept. Releases without
+// VersionIndex, VersionMatch or FileMatch are returned unchanged.
+func DiscoverRelease(ctx context.Context, d Downloader, rel *catalog.Release) *catalog.Release {
+	if rel.VersionIndex == "" && rel.VersionMatch == "" && rel.FileMatch == "" {
+		return rel
+	}
+	r := rel.Clone()
+	r.VersionIndex, r.VersionMatch, r.VersionKey, r.FileMatch = "", "", "", ""
+	if rel.VersionIndex != "" || rel.VersionMatch != "" {
+		latest, err := discoverVersion(ctx, d, rel)
+		if err == nil && latest != "" {
+			r.Version = latest
+		} else {
+			fmt.Println("获取最新版本失败，使用默认版本:", r.Version)
+		}
+	}
+	if rel.FileMatch != "" {
+		vars, err := discoverFileVars(ctx, d, r, rel.FileMatch)
+		if err != nil {
+			fmt.Println("获取最新文件失败，使用默认文件:", err)
+		}
+		for k, v := range vars {
+			if r.Vars == nil {
+				r.Vars = make(map[string]string)
+			}
+			r.Vars[k] = v
+		}
+	}
+	return r
+}
+
+func discoverVersion(ctx context.Context, d Downloader, rel *catalog.Release) (string, error) {
+	if rel.VersionMatch == "" {
+		return fetchVersionIndex(ctx, d, rel.VersionIndex, rel.VersionKey)
+	}
+	re, err := regexp.Compile(rel.VersionMatch)
+	if err != nil {
+		return "", err
+	}
+	if rel.VersionIndex != "" {
+		entries, err := ListIndex(ctx, d, rel.VersionIndex)
+		if err != nil {
+			return "", err
+		}
+		return highestMatch(entries, re), nil
+	}
+	return latestListedVersion(ctx, d, rel, re)
+}
+
+func fetchVersionIndex(ctx context.Context, d Downloader, urlStr, key string) (string, error) {
+	if key == "" {
+		version, err := fetchText(ctx, d, urlStr, 4096)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(version), nil
+	}
+	body, err := fetchText(ctx, d, urlStr, maxIndexSize)
+	if err != nil {
+		return "", err
+	}
+	return jsonVersion([]byte(body), key)
+}
+
+// jsonVersion looks up the string at a dotted key path in a JSON document.
+func jsonVersion(data []byte, key string) (string, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", err
+	}
+	for _, part := range strings.Split(key, ".") {
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("version key %s not found", key)
+		}
+		if doc, ok = m[part]; !ok {
+			return "", fmt.Errorf("version key %s not found", key)
+		}
+	}
+	version, ok := doc.(string)
+	if !ok || version == "" {
+		return "", fmt.Errorf("version key %s is not a string", key)
+	}
+	return version, nil
+}
+
+// latestListedVersion lists the directory holding "{version}/" on each mirror of rel
+// until one has an entry matching re, and returns the highest version found.
+func latestListedVersion(ctx context.Context, d Downloader, rel *catalog.Release, re *regexp.Regexp) (string, error) {
+	mirrors := rel.Mirrors
+	if len(mirrors) == 0 && rel.OS() != nil {
+		mirrors = rel.OS().Mirrors
+	}
+	lastErr := fmt.Errorf("no mirror of %s lists its versions", rel.ID)
+	for _, tmpl := range mirrors {
+		idx := strings.Index(tmpl, "{version}")
+		if idx < 0 {
+			continue
+		}
+		base := tmpl[:strings.LastIndex(tmpl[:idx], "/")+1]
+		entries, err := ListIndex(ctx, d, base)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if latest := highestMatch(entries, re); latest != "" {
+			return latest, nil
+		}
+	}
+	return "", lastErr
+}
+
+// highestMatch returns the highest version captured by re (first group, or the whole match).
+func highestMatch(entries []string, re *regexp.Regexp) string {
+	var latest string
+	for _, entry := range entries {
+		m := re.FindStringSubmatch(entry)
+		if m == nil {
+			continue
+		}
+		v := m[0]
+		if len(m) > 1 {
+			v = m[1]
+		}
+		if compareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// discoverFileVars lists the image directory of rel and returns the named groups of
+// the newest entry matching pattern.
+func discoverFileVars(ctx context.Context, d Downloader, rel *catalog.Release, pattern string) (map[string]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	_, urls := rel.Expand("")
+	lastErr := fmt.Errorf("no file of %s matches %s", rel.ID, pattern)
+	for _, u := range urls {
+		entries, err := ListIndex(ctx, d, u[:strings.LastIndex(u, "/")+1])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var best map[string]string
+		var bestKey string
+		for _, entry := range entries {
+			m := re.FindStringSubmatch(entry)
+			if m == nil {
+				continue
+			}
+			vars := make(map[string]string)
+			var key []string
+			for i, name := range re.SubexpNames() {
+				if name != "" {
+					vars[name] = m[i]
+					key = append(key, m[i])
+				}
+			}
+			if k := strings.Join(key, "."); best == nil || compareVersions(k, bestKey) > 0 {
+				best, bestKey = vars, k
+			}
+		}
+		if best != nil {
+			return best, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// resolveRelease returns the path of the image when it is already present in isoPath
+// (destName maps the downloaded file name to the final one), otherwise a download
+// status for the first reachable mirror of rel, LAN peers first and the GHCR package of
+// the release, if any, last.
+func resolveRelease(ctx context.Context, d Downloader, rel *catalog.Release, cachePath, isoPath string, destName func(string) string) (string, *downloader.DownloadStatus, error) {
+	fileName, urls := ReleaseURLs(ctx, d, rel)
+	dest := filepath.Join(isoPath, destName(fileName))
+	// The size of an unpacked image is unknown, so it cannot be checked.
+	unpacked := destName(fileName) != fileName
+	if len(urls) == 0 {
+		return "", nil, fmt.Errorf("%s %s has no download mirrors", rel.OS().ID, rel.ID)
+	}
+	urls = withPeerURLs(ctx, d, fileName, urls)
+	if loc, ok := ghcrLocation(ctx, rel, ""); ok {
+		urls = append(urls, loc)
+	}
+	urlStr, totalSize, modTime, err := SelectFirstReachable(d, urls)
+	if err != nil {
+		if unpacked && existingImage(dest, 0) {
+			return dest, nil, nil
+		}
+		return "", nil, err
+	}
+	if src, err := NewSource(d, urlStr); err == nil {
+		if oci, ok := src.(*ociSource); ok {
+			// A package may hold the image under another name, e.g. already unpacked.
+			if name, err := oci.Name(ctx); err == nil {
+				fileName = path.Base(name)
+				dest = filepath.Join(isoPath, destName(fileName))
+				unpacked = destName(fileName) != fileName
+			}
+		}
+	}
+	size := totalSize
+	if unpacked {
+		size = 0
+	}
+	if existingImage(dest, size) {
+		return dest, nil, nil
+	}
+	return "", &downloader.DownloadStatus{
+		Url:        urlStr,
+		TargetFile: filepath.Join(cachePath, fileName),
+		TotalSize:  totalSize,
+		ModTime:    modTime,
+		Fallback:   peerFallback(urlStr, urls),
+	}, nil
+}
+
+// DownloadRelease resumes a pending download when status is provided, or downloads the
+// catalog release into isoPath and verifies it against the release checksum.
+func DownloadRelease(ctx context.Context, d Downloader, isoPath, cachePath, statusPath string, status *downloader.DownloadStatus, rel *catalog.Release) (string, error) {
+	if status != nil {
+		baseFileName := filepath.Base(status.TargetFile)
+		fmt.Println("downloading:", baseFileName, "url=\n", status.Url)
+		target, err := downloadAndMove(ctx, d, statusPath, status, filepath.Join(isoPath, baseFileName))
+		if err != nil {
+			return "", err
+		}
+		return target, verifyDownload(target, status, true)
+	}
+	if rel == nil {
+		return "", errors.New("no download target provided")
+	}
+	rel = DiscoverRelease(ctx, d, rel)
+	existing, status, err := resolveRelease(ctx, d, rel, cachePath, isoPath, sameName)
+	if err != nil || existing != "" {
+		return existing, err
+	}
+	fileName := filepath.Base(status.TargetFile)
+	// The checksum is kept with the status so that a resumed download is verified too.
+	status.Checksum, err = releaseChecksum(ctx, d, rel, status.Url, fileName)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("downloading:", fileName, "url=\n", status.Url)
+	target, err := downloadAndMove(ctx, d, statusPath, status, filepath.Join(isoPath, fileName))
+	if err != nil {
+		return "", err
+	}
+	return target, verifyDownload(target, status, false)
+}
+
+func sameName(name string) string {
+	return name
+}
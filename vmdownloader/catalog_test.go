@@ -0,0 +1,107 @@
+package vmdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+)
+
+func TestDiscoverRelease(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fedora/releases/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="41/">41/</a><a href="42/">42/</a><a href="test/">test/</a>`)
+	})
+	mux.HandleFunc("/fedora/releases/42/Server/x86_64/iso/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="Fedora-Server-42-1.1-x86_64-CHECKSUM">c</a>
+<a href="Fedora-Server-netinst-x86_64-42-1.1.iso">n</a>
+<a href="Fedora-Server-dvd-x86_64-42-1.1.iso">d</a>`)
+	})
+	mux.HandleFunc("/fedora/releases/42/Server/x86_64/iso/Fedora-Server-42-1.1-x86_64-CHECKSUM", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "# Fedora-Server-netinst-x86_64-42-1.1.iso: 1 bytes\nSHA256 (Fedora-Server-netinst-x86_64-42-1.1.iso) = %s\n", strings.Repeat("1", 64))
+	})
+	mux.HandleFunc("/centos/10-stream/iso/CentOS-Stream-10-latest-x86_64-boot.iso.SHA256SUM", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "SHA256 (CentOS-Stream-10-20250101.0-x86_64-boot.iso) = %s\n", strings.Repeat("2", 64))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := catalog.Parse([]byte(`{"os":[
+		{"id":"fedora","checksum_file":"Fedora-Server-{version}-{respin}-x86_64-CHECKSUM",
+		 "mirrors":["` + srv.URL + `/fedora/releases/{version}/Server/x86_64/iso/{file}"],
+		 "releases":[{"id":"netinst","version":"40","version_match":"^(\\d+)/$",
+			"file_match":"^Fedora-Server-netinst-x86_64-\\d+-(?P<respin>[\\d.]+)\\.iso$",
+			"vars":{"respin":"1.0"},"file":"Fedora-Server-netinst-x86_64-{version}-{respin}.iso"}]},
+		{"id":"centos-stream","checksum_file":"{file}.SHA256SUM",
+		 "mirrors":["` + srv.URL + `/centos/{version}-stream/iso/{file}"],
+		 "releases":[{"id":"10-boot","version":"10","file":"CentOS-Stream-{version}-latest-x86_64-boot.iso"}]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := downloader.NewDownloader()
+	ctx := context.Background()
+
+	orig, _ := c.FindRelease("fedora", "netinst")
+	rel := DiscoverRelease(ctx, d, orig)
+	file, urls := rel.Expand("")
+	if file != "Fedora-Server-netinst-x86_64-42-1.1.iso" {
+		t.Fatalf("unexpected file %s", file)
+	}
+	if urls[0] != srv.URL+"/fedora/releases/42/Server/x86_64/iso/"+file {
+		t.Fatalf("unexpected url %s", urls[0])
+	}
+	if orig.Version != "40" || orig.Vars["respin"] != "1.0" {
+		t.Fatal("catalog release modified by discovery")
+	}
+	if sum, err := releaseChecksum(ctx, d, rel, urls[0], file); err != nil || sum != "sha256:"+strings.Repeat("1", 64) {
+		t.Fatalf("unexpected fedora checksum %q: %v", sum, err)
+	}
+
+	stream, _ := c.FindRelease("centos-stream", "10-boot")
+	file, urls = stream.Expand("")
+	if sum, err := releaseChecksum(ctx, d, stream, urls[0], file); err != nil || sum != "sha256:"+strings.Repeat("2", 64) {
+		t.Fatalf("unexpected centos checksum %q: %v", sum, err)
+	}
+	if _, err := releaseChecksum(ctx, d, rel, srv.URL+"/fedora/releases/42/Server/x86_64/iso/Fedora-Server-dvd-x86_64-42-1.1.iso", "Fedora-Server-dvd-x86_64-42-1.1.iso"); !errors.Is(err, ErrChecksumUnavailable) {
+		t.Fatalf("missing sums entry accepted: %v", err)
+	}
+}
+
+func TestDefaultCatalogTemplates(t *testing.T) {
+	for _, o := range catalog.Default().OS {
+		for _, rel := range o.Releases {
+			file, urls := rel.Expand("")
+			if strings.Contains(file, "{") {
+				t.Errorf("%s %s: unexpanded file %s", o.ID, rel.ID, file)
+			}
+			for _, u := range urls {
+				if strings.Contains(u, "{") {
+					t.Errorf("%s %s: unexpanded url %s", o.ID, rel.ID, u)
+				}
+			}
+			if sums := rel.Template(rel.ChecksumFileName()); strings.Contains(sums, "{") {
+				t.Errorf("%s %s: unexpanded checksum file %s", o.ID, rel.ID, sums)
+			}
+		}
+	}
+}
+
+func TestJSONVersion(t *testing.T) {
+	doc := []byte(`{"channel": "stable", "hassos": {"ova": "16.2", "generic-x86-64": "16.2"}}`)
+	if v, err := jsonVersion(doc, "hassos.ova"); err != nil || v != "16.2" {
+		t.Fatalf("jsonVersion = %q, %v", v, err)
+	}
+	if _, err := jsonVersion(doc, "hassos.rpi5"); err == nil {
+		t.Fatal("expected error for missing key")
+	}
+	if _, err := jsonVersion(doc, "hassos"); err == nil {
+		t.Fatal("expected error for non-string value")
+	}
+}
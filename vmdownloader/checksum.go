@@ -0,0 +1,160 @@
+package vmdownloader
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/utils"
+)
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// VerifyChecksum compares a file against an "<algo>:<hex>" checksum. An empty checksum is accepted.
+func VerifyChecksum(filePath, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	algo, want, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return fmt.Errorf("invalid checksum %q", checksum)
+	}
+	h, err := newHash(algo)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Println("校验", algo, "...")
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("%w: %s want %s got %s", ErrChecksumMismatch, algo, want, got)
+	}
+	return nil
+}
+
+func newHash(algo string) (hash.Hash, error) {
+	switch strings.ToLower(algo) {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+}
+
+var bsdChecksumPattern = regexp.MustCompile(`^(SHA1|SHA256|SHA512)\s*\((.+)\)\s*=\s*([0-9a-fA-F]+)$`)
+
+// ParseChecksums reads a sums file in GNU ("<hex>  <name>", "<hex> *<name>") or
+// BSD ("SHA256 (<name>) = <hex>") format into "<algo>:<hex>" checksums by file name.
+// Other lines, such as PGP armor, are ignored.
+func ParseChecksums(data string) map[string]string {
+	sums := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if m := bsdChecksumPattern.FindStringSubmatch(line); m != nil {
+			sums[m[2]] = strings.ToLower(m[1]) + ":" + strings.ToLower(m[3])
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		algo, ok := utils.ChecksumAlgo(fields[0])
+		if !ok {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = algo + ":" + strings.ToLower(fields[0])
+	}
+	return sums
+}
+
+// ErrChecksumUnavailable is returned when the catalog declares a sums file for a release
+// but the checksum of the downloaded file cannot be read from it.
+var ErrChecksumUnavailable = errors.New("checksum unavailable")
+
+// releaseChecksum returns the checksum of fileName for rel: the catalog value, or the entry
+// of the release sums file published in the same directory as urlStr. Releases without
+// either are not verified, which is reported; a declared sums file that cannot be fetched
+// or has no entry for the file is an error.
+func releaseChecksum(ctx context.Context, d Downloader, rel *catalog.Release, urlStr, fileName string) (string, error) {
+	if strings.HasPrefix(urlStr, "oci://") {
+		// OCI packages are verified against their blob digests, and may hold the image
+		// in another form than the mirrors.
+		return "", nil
+	}
+	if rel.Checksum != "" {
+		return rel.Checksum, nil
+	}
+	u, err := url.Parse(urlStr)
+	if err == nil && strings.HasPrefix(u.Path, filesPrefix) {
+		// LAN peers are verified against the digest they publish.
+		return "", nil
+	}
+	sumsTemplate := rel.ChecksumFileName()
+	if sumsTemplate == "" {
+		fmt.Println("警告：镜像目录没有", fileName, "的校验值，下载后不校验")
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrChecksumUnavailable, err)
+	}
+	sumsFile := rel.Template(sumsTemplate)
+	u.RawQuery = ""
+	u.Path = path.Join(path.Dir(u.Path), sumsFile)
+	data, err := fetchText(ctx, d, u.String(), maxIndexSize)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrChecksumUnavailable, u, err)
+	}
+	sums := ParseChecksums(data)
+	sum, ok := sums[fileName]
+	if !ok && len(sums) == 1 && strings.Contains(sumsTemplate, "{file}") {
+		// Per-file sums of a "latest" alias name the dated file they point to.
+		for _, v := range sums {
+			sum, ok = v, true
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no entry for %s", ErrChecksumUnavailable, sumsFile, fileName)
+	}
+	return sum, nil
+}
+
+// verifyDownload checks a finished download against the checksum recorded in its status,
+// removing the file when it does not match. Resumed downloads started before checksums
+// were recorded cannot be verified, which is reported; OCI sources verify themselves.
+func verifyDownload(target string, status *downloader.DownloadStatus, resumed bool) error {
+	if status.Checksum == "" && resumed && !strings.HasPrefix(status.Url, "oci://") {
+		fmt.Println("警告：下载状态中没有记录校验值，不校验", filepath.Base(target))
+	}
+	if err := VerifyChecksum(target, status.Checksum); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package vmdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/utils"
+)
+
+// ParseExpectedChecksum accepts "algo:hex", or a bare hex digest whose algorithm is
+// guessed from its length, and returns it as "algo:hex". An empty string stays empty.
+func ParseExpectedChecksum(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if algo, digest, ok := strings.Cut(s, ":"); ok {
+		if _, err := newHash(algo); err != nil {
+			return "", err
+		}
+		return strings.ToLower(algo) + ":" + strings.ToLower(digest), nil
+	}
+	algo, ok := utils.ChecksumAlgo(s)
+	if !ok {
+		return "", fmt.Errorf("invalid checksum %q", s)
+	}
+	return algo + ":" + strings.ToLower(s), nil
+}
+
+// CustomLocation turns user input into a download location: URLs are kept, other input
+// is a local path, such as a USB stick mount, made absolute.
+func CustomLocation(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("empty location")
+	}
+	if strings.Contains(input, "://") {
+		return input, nil
+	}
+	return filepath.Abs(input)
+}
+
+// imageNamePattern is what the names of downloaded images may contain. They end up in
+// PVE volume ids and the qm commands that attach them.
+var imageNamePattern = regexp.MustCompile(`^[A-Za-z0-9_+-][A-Za-z0-9._+-]*$`)
+
+// ErrInvalidFileName is returned for image names outside imageNamePattern.
+var ErrInvalidFileName = errors.New("file name may only contain letters, digits and ._+-")
+
+// CustomFileName is the name a custom location is saved as: the last element of its path.
+// It is empty when that name has characters outside imageNamePattern.
+func CustomFileName(location string) string {
+	p := location
+	if strings.Contains(location, "://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return ""
+		}
+		p = u.Path
+	}
+	name := path.Base(p)
+	if !imageNamePattern.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// DownloadURL downloads a user-supplied location into isoPath as fileName (CustomFileName
+// when empty): a URL is downloaded resumably, a local path is copied. The file is verified
+// against checksum when one is given. status is resumed when it is for the same location,
+// and verified against the checksum it was started with unless another one is given.
+func DownloadURL(ctx context.Context, d Downloader, isoPath, cachePath, statusPath string, status *downloader.DownloadStatus, location, fileName, checksum string) (string, error) {
+	checksum, err := ParseExpectedChecksum(checksum)
+	if err != nil {
+		return "", err
+	}
+	if fileName == "" {
+		fileName = CustomFileName(location)
+		if fileName == "" {
+			return "", fmt.Errorf("%w: %s names no usable file, give a file name", ErrInvalidFileName, location)
+		}
+	}
+	if !imageNamePattern.MatchString(fileName) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidFileName, fileName)
+	}
+	dest := filepath.Join(isoPath, fileName)
+	if status == nil || status.Url != location {
+		urlStr, totalSize, modTime, err := SelectFirstReachable(d, []string{location})
+		if err != nil {
+			return "", err
+		}
+		// The file may already be in the ISO directory, copied there or as the source itself.
+		if existingImage(dest, totalSize) {
+			return dest, VerifyChecksum(dest, checksum)
+		}
+		status = &downloader.DownloadStatus{
+			Url:        urlStr,
+			TargetFile: filepath.Join(cachePath, fileName),
+			TotalSize:  totalSize,
+			ModTime:    modTime,
+			Checksum:   checksum,
+		}
+	} else if checksum != "" {
+		status.Checksum = checksum
+	}
+	fmt.Println("downloading:", fileName, "url=\n", status.Url)
+	target, err := downloadAndMove(ctx, d, statusPath, status, dest)
+	if err != nil {
+		return "", err
+	}
+	if err := VerifyChecksum(target, status.Checksum); err != nil {
+		os.Remove(target)
+		return "", err
+	}
+	return target, nil
+}
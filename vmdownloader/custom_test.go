@@ -0,0 +1,106 @@
+package vmdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/linkease/fastpve/downloader"
+)
+
+func TestParseExpectedChecksum(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"SHA256:ABCD", "sha256:abcd"},
+		{"d41d8cd98f00b204e9800998ecf8427e", "md5:d41d8cd98f00b204e9800998ecf8427e"},
+	}
+	for _, tt := range tests {
+		if got, err := ParseExpectedChecksum(tt.in); err != nil || got != tt.want {
+			t.Fatalf("ParseExpectedChecksum(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"abc", "crc32:1234"} {
+		if _, err := ParseExpectedChecksum(in); err == nil {
+			t.Fatalf("ParseExpectedChecksum(%q) accepted", in)
+		}
+	}
+}
+
+func TestCustomFileName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"https://example.com/isos/debian-12.5.0+nonfree.iso?x=1", "debian-12.5.0+nonfree.iso"},
+		{"/mnt/usb/os.iso", "os.iso"},
+		{"https://example.com/isos/my%20os.iso", ""},
+		{"/mnt/usb/a;reboot;.iso", ""},
+		{"https://example.com/", ""},
+		{"/mnt/usb/..", ""},
+	}
+	for _, tt := range tests {
+		if got := CustomFileName(tt.in); got != tt.want {
+			t.Fatalf("CustomFileName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	_, err := DownloadURL(context.Background(), downloader.NewDownloader(), t.TempDir(), t.TempDir(), "", nil, "/mnt/usb/os.iso", "$(reboot).iso", "")
+	if !errors.Is(err, ErrInvalidFileName) {
+		t.Fatalf("DownloadURL with an unsafe name = %v, want ErrInvalidFileName", err)
+	}
+}
+
+func TestDownloadURL(t *testing.T) {
+	data := bytes.Repeat([]byte("custom iso "), 1000)
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "custom.iso", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	usb, isoPath, cachePath := filepath.Join(dir, "usb"), filepath.Join(dir, "iso"), filepath.Join(dir, "cache")
+	for _, p := range []string{usb, isoPath, cachePath} {
+		os.MkdirAll(p, 0755)
+	}
+	local := filepath.Join(usb, "local.iso")
+	os.WriteFile(local, data, 0644)
+	// A truncated copy left in the ISO directory is replaced, not reused.
+	os.WriteFile(filepath.Join(isoPath, "local.iso"), data[:100], 0644)
+
+	ctx := context.Background()
+	d := downloader.NewDownloader()
+	statusPath := filepath.Join(cachePath, "custom.ops")
+	for _, location := range []string{srv.URL + "/isos/custom.iso?token=1", local} {
+		target, err := DownloadURL(ctx, d, isoPath, cachePath, statusPath, nil, location, "", digest)
+		if err != nil {
+			t.Fatalf("DownloadURL(%s): %v", location, err)
+		}
+		got, _ := os.ReadFile(target)
+		if want := filepath.Join(isoPath, CustomFileName(location)); target != want || !bytes.Equal(got, data) {
+			t.Fatalf("DownloadURL(%s) = %s with %d bytes, want %s", location, target, len(got), want)
+		}
+	}
+
+	// A resumed download is verified against the checksum it was started with.
+	info, _ := os.Stat(local)
+	partial := filepath.Join(cachePath, "resumed.iso")
+	os.WriteFile(partial, data[:100], 0644)
+	status := &downloader.DownloadStatus{Url: local, TargetFile: partial, TotalSize: info.Size(), ModTime: info.ModTime(), Curr: 100, Checksum: "sha256:" + digest[1:] + "0"}
+	if _, err := DownloadURL(ctx, d, isoPath, cachePath, statusPath, status, local, "resumed.iso", ""); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("resumed DownloadURL = %v, want ErrChecksumMismatch", err)
+	}
+
+	_, err := DownloadURL(ctx, d, isoPath, cachePath, statusPath, nil, local, "bad.iso", "sha256:"+digest[1:]+"0")
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("DownloadURL with a wrong checksum = %v, want ErrChecksumMismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(isoPath, "bad.iso")); !os.IsNotExist(err) {
+		t.Fatalf("file with a wrong checksum was kept: %v", err)
+	}
+}
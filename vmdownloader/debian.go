@@ -0,0 +1,135 @@
+package vmdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+)
+
+var (
+	debianVersionPattern = regexp.MustCompile(`^(\d+)\.\d+\.\d+$`)
+	debianMajorPattern   = regexp.MustCompile(`^\d+$`)
+	debianListPattern    = regexp.MustCompile(`^(\d+\.\d+\.\d+)/$`)
+
+	debianVersionsMu sync.Mutex
+	debianVersions   map[string]string
+)
+
+// DiscoverDebianVersions returns the current point release of the "stable" and "oldstable"
+// suites, read from the directory listings of the catalog mirrors. The result is cached.
+func DiscoverDebianVersions(ctx context.Context, d Downloader) (map[string]string, error) {
+	debianVersionsMu.Lock()
+	defer debianVersionsMu.Unlock()
+	if debianVersions != nil {
+		return debianVersions, nil
+	}
+	stableRel, err := catalog.Current().FindRelease("debian", "stable-netinst")
+	if err != nil {
+		return nil, err
+	}
+	stable, err := latestListedVersion(ctx, d, stableRel, debianListPattern)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string]string{"stable": stable}
+	major, _ := strconv.Atoi(debianVersionPattern.FindStringSubmatch(stable)[1])
+	if oldRel, err := catalog.Current().FindRelease("debian", "oldstable-netinst"); err == nil {
+		oldPattern := regexp.MustCompile(`^(` + strconv.Itoa(major-1) + `\.\d+\.\d+)/$`)
+		if old, err := latestListedVersion(ctx, d, oldRel, oldPattern); err == nil {
+			versions["oldstable"] = old
+		}
+	}
+	debianVersions = versions
+	return versions, nil
+}
+
+// splitDebianSpec splits "12-dvd" into version and image type; the type defaults to netinst.
+func splitDebianSpec(spec string) (string, string) {
+	for _, suffix := range []string{"-netinst", "-dvd"} {
+		if strings.HasSuffix(spec, suffix) {
+			return strings.TrimSuffix(spec, suffix), strings.TrimPrefix(suffix, "-")
+		}
+	}
+	switch spec {
+	case "netinst", "dvd":
+		return "", spec
+	}
+	return spec, "netinst"
+}
+
+// FindDebianRelease resolves "stable", "oldstable-dvd", a major version such as "12",
+// or a point release such as "12.10.0-netinst" to a catalog release with the discovered
+// version. Point releases that are no longer current come from the archive mirrors.
+func FindDebianRelease(ctx context.Context, d Downloader, spec string) (*catalog.Release, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	version, kind := splitDebianSpec(spec)
+	current := make(map[string]string)
+	for _, suite := range []string{"stable", "oldstable"} {
+		if rel, err := catalog.Current().FindRelease("debian", suite+"-"+kind); err == nil {
+			current[suite] = rel.Version
+		}
+	}
+	versions, err := DiscoverDebianVersions(ctx, d)
+	if err != nil {
+		fmt.Println("获取 Debian 最新版本失败，使用默认版本:", err)
+	}
+	for suite, v := range versions {
+		current[suite] = v
+	}
+
+	suite, pinned := "", ""
+	switch {
+	case version == "" || version == "stable" || version == "oldstable":
+		suite = version
+		if suite == "" {
+			suite = "stable"
+		}
+	case debianMajorPattern.MatchString(version):
+		for name, v := range current {
+			if strings.HasPrefix(v, version+".") {
+				suite = name
+			}
+		}
+	case debianVersionPattern.MatchString(version):
+		for name, v := range current {
+			if v == version {
+				suite = name
+			}
+		}
+		if suite == "" {
+			suite, pinned = "oldstable", version
+		}
+	default:
+		return catalog.Current().FindRelease("debian", spec)
+	}
+	if suite == "" {
+		return nil, fmt.Errorf("%w: debian %s", catalog.ErrUnknownRelease, spec)
+	}
+
+	rel, err := catalog.Current().FindRelease("debian", suite+"-"+kind)
+	if err != nil {
+		return nil, err
+	}
+	rel = rel.Clone()
+	rel.Version = current[suite]
+	if pinned != "" {
+		rel.Version = pinned
+	}
+	rel.Name = fmt.Sprintf("Debian %s %s", rel.Version, kind)
+	return rel, nil
+}
+
+// DownloadDebianISO resumes a pending download when status is provided, or downloads the given release.
+func DownloadDebianISO(ctx context.Context, d Downloader, isoPath, cachePath, statusPath string, status *downloader.DownloadStatus, rel *catalog.Release) (string, error) {
+	if status == nil && rel == nil {
+		return "", errors.New("no debian download target provided")
+	}
+	return DownloadRelease(ctx, d, isoPath, cachePath, statusPath, status, rel)
+}
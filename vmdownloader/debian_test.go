@@ -0,0 +1,117 @@
+package vmdownloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+)
+
+func TestParseChecksums(t *testing.T) {
+	sha256 := strings.Repeat("ab", 32)
+	sha512 := strings.Repeat("CD", 64)
+	sums := ParseChecksums(strings.Join([]string{
+		"-----BEGIN PGP SIGNED MESSAGE-----",
+		sha256 + " *ubuntu-24.04.2-desktop-amd64.iso",
+		sha512 + "  debian-13.1.0-amd64-netinst.iso",
+		"SHA256 (Rocky-9.6-x86_64-minimal.iso) = " + sha256,
+		"# comment",
+	}, "\n"))
+	want := map[string]string{
+		"ubuntu-24.04.2-desktop-amd64.iso": "sha256:" + sha256,
+		"debian-13.1.0-amd64-netinst.iso":  "sha512:" + strings.ToLower(sha512),
+		"Rocky-9.6-x86_64-minimal.iso":     "sha256:" + sha256,
+	}
+	if len(sums) != len(want) {
+		t.Fatalf("got %v", sums)
+	}
+	for name, sum := range want {
+		if sums[name] != sum {
+			t.Fatalf("%s: got %s want %s", name, sums[name], sum)
+		}
+	}
+}
+
+func resetDebianVersions(t *testing.T) {
+	t.Helper()
+	debianVersionsMu.Lock()
+	debianVersions = nil
+	debianVersionsMu.Unlock()
+	t.Cleanup(func() {
+		debianVersionsMu.Lock()
+		debianVersions = nil
+		debianVersionsMu.Unlock()
+	})
+}
+
+func TestFindDebianRelease(t *testing.T) {
+	resetDebianVersions(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debian-cd/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="13.1.0/">13.1.0/</a><a href="13.1.0-live/">x</a><a href="current/">current/</a><a href="project/">project/</a>`)
+	})
+	mux.HandleFunc("/archive/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="11.11.0/">a</a><a href="12.9.0/">b</a><a href="12.12.0/">c</a><a href="13.0.0/">d</a>`)
+	})
+	mux.HandleFunc("/debian-cd/13.1.0/amd64/iso-cd/SHA512SUMS", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  debian-13.1.0-amd64-netinst.iso\n", strings.Repeat("0", 128))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := catalog.Parse([]byte(`{"os":[{"id":"debian","checksum_file":"SHA512SUMS",
+		"mirrors":["` + srv.URL + `/debian-cd/{version}/amd64/{type}/{file}"],
+		"releases":[
+			{"id":"stable-netinst","version":"13.0.0","vars":{"type":"iso-cd"},"file":"debian-{version}-amd64-netinst.iso"},
+			{"id":"stable-dvd","version":"13.0.0","vars":{"type":"iso-dvd"},"file":"debian-{version}-amd64-DVD-1.iso"},
+			{"id":"oldstable-netinst","version":"12.0.0","vars":{"type":"iso-cd"},"file":"debian-{version}-amd64-netinst.iso",
+				"mirrors":["` + srv.URL + `/archive/{version}/amd64/{type}/{file}"]},
+			{"id":"oldstable-dvd","version":"12.0.0","vars":{"type":"iso-dvd"},"file":"debian-{version}-amd64-DVD-1.iso",
+				"mirrors":["` + srv.URL + `/archive/{version}/amd64/{type}/{file}"]}
+		]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog.SetCurrent(c)
+	defer catalog.SetCurrent(nil)
+
+	d := downloader.NewDownloader()
+	tests := []struct {
+		spec, url string
+	}{
+		{"", "/debian-cd/13.1.0/amd64/iso-cd/debian-13.1.0-amd64-netinst.iso"},
+		{"stable-dvd", "/debian-cd/13.1.0/amd64/iso-dvd/debian-13.1.0-amd64-DVD-1.iso"},
+		{"oldstable", "/archive/12.12.0/amd64/iso-cd/debian-12.12.0-amd64-netinst.iso"},
+		{"12-dvd", "/archive/12.12.0/amd64/iso-dvd/debian-12.12.0-amd64-DVD-1.iso"},
+		{"13", "/debian-cd/13.1.0/amd64/iso-cd/debian-13.1.0-amd64-netinst.iso"},
+		{"12.9.0-netinst", "/archive/12.9.0/amd64/iso-cd/debian-12.9.0-amd64-netinst.iso"},
+	}
+	for _, tt := range tests {
+		rel, err := FindDebianRelease(context.Background(), d, tt.spec)
+		if err != nil {
+			t.Fatalf("FindDebianRelease(%q): %v", tt.spec, err)
+		}
+		_, urls := rel.Expand("")
+		if len(urls) != 1 || urls[0] != srv.URL+tt.url {
+			t.Fatalf("FindDebianRelease(%q) urls = %v, want %s", tt.spec, urls, tt.url)
+		}
+	}
+	if _, err := FindDebianRelease(context.Background(), d, "10"); err == nil {
+		t.Fatal("expected error for debian 10")
+	}
+	// The shared catalog entry keeps its default version.
+	if rel, _ := c.FindRelease("debian", "stable-netinst"); rel.Version != "13.0.0" {
+		t.Fatalf("catalog release modified: %s", rel.Version)
+	}
+
+	rel, _ := FindDebianRelease(context.Background(), d, "stable")
+	file, urls := rel.Expand("")
+	if sum, err := releaseChecksum(context.Background(), d, rel, urls[0], file); err != nil || sum != "sha512:"+strings.Repeat("0", 128) {
+		t.Fatalf("unexpected checksum %q: %v", sum, err)
+	}
+}
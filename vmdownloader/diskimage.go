@@ -0,0 +1,121 @@
+package vmdownloader
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+)
+
+// DownloadDiskImage resumes a pending download when status is provided, or downloads the
+// given catalog release, verifies it and unpacks .gz or .xz images into isoPath. The GHCR
+// package of the release, if any, is tried after the mirrors. It returns the file name of the image inside isoPath.
+func DownloadDiskImage(ctx context.Context, d Downloader, isoPath, cachePath, statusPath string, status *downloader.DownloadStatus, rel *catalog.Release) (string, error) {
+	resumed := status != nil
+	if status == nil {
+		if rel == nil {
+			return "", errors.New("no disk image download target provided")
+		}
+		rel = DiscoverRelease(ctx, d, rel)
+		var existing string
+		var err error
+		existing, status, err = resolveRelease(ctx, d, rel, cachePath, isoPath, UnpackedName)
+		if err != nil {
+			return "", err
+		}
+		if existing != "" {
+			return filepath.Base(existing), nil
+		}
+		status.Checksum, err = releaseChecksum(ctx, d, rel, status.Url, filepath.Base(status.TargetFile))
+		if err != nil {
+			return "", err
+		}
+	}
+	fmt.Println("downloading:", filepath.Base(status.TargetFile), "url=\n", status.Url)
+	if err := downloadVerified(ctx, d, statusPath, status); err != nil {
+		return "", err
+	}
+	if err := verifyDownload(status.TargetFile, status, resumed); err != nil {
+		return "", err
+	}
+	return UnpackImage(status.TargetFile, isoPath)
+}
+
+// UnpackedName is the image name once the .gz or .xz compression is removed.
+func UnpackedName(name string) string {
+	for _, ext := range []string{".gz", ".xz"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// UnpackImage moves a downloaded image into isoPath, decompressing it on the way, and
+// returns its file name there.
+// Only the first gzip member is read: OpenWrt style images are padded after it, which
+// makes the gunzip tool exit with a "trailing garbage" warning status. The standard
+// library has no xz reader, so .xz images go through the xz tool shipped with PVE.
+func UnpackImage(srcPath, isoPath string) (string, error) {
+	name := UnpackedName(filepath.Base(srcPath))
+	destPath := filepath.Join(isoPath, name)
+	if name == filepath.Base(srcPath) {
+		if err := moveFile(srcPath, destPath); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+
+	fmt.Println("download OK, unzipping and moving file...")
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	tmpPath := destPath + ".syn"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(srcPath, ".xz") {
+		cmd := exec.Command("xz", "-dc")
+		cmd.Stdin = src
+		cmd.Stdout = dst
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	} else {
+		err = gunzip(dst, src)
+	}
+	if err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return "", err
+	}
+	os.Remove(srcPath)
+	return name, nil
+}
+
+func gunzip(dst io.Writer, src io.Reader) error {
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return err
+	}
+	zr.Multistream(false)
+	_, err = io.Copy(dst, zr)
+	return err
+}
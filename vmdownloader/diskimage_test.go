@@ -0,0 +1,71 @@
+package vmdownloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnpackImage(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("disk image"))
+	zw.Close()
+	// OpenWrt images are padded after the gzip member.
+	buf.Write(make([]byte, 512))
+	src := filepath.Join(dir, "openwrt.img.gz")
+	if err := os.WriteFile(src, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "iso")
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	name, err := UnpackImage(src, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "openwrt.img" {
+		t.Fatalf("name = %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(out, name))
+	if err != nil || string(data) != "disk image" {
+		t.Fatalf("unpacked = %q, %v", data, err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatal("compressed image was not removed")
+	}
+}
+
+func TestUnpackImageXZ(t *testing.T) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		t.Skip("xz not installed")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "haos_ova-16.2.qcow2.xz")
+	cmd := exec.Command("xz", "-c")
+	cmd.Stdin = strings.NewReader("qcow2 image")
+	data, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	name, err := UnpackImage(src, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "haos_ova-16.2.qcow2" {
+		t.Fatalf("name = %q", name)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != "qcow2 image" {
+		t.Fatalf("unpacked = %q", data)
+	}
+}
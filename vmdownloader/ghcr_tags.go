@@ -0,0 +1,189 @@
+package vmdownloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kspeeder/docker-registry/lib"
+	"github.com/linkease/fastpve/catalog"
+)
+
+var (
+	registryTagsMu sync.Mutex
+	registryTags   = make(map[string][]string)
+
+	// fetchRegistryTags lists the tags of the repository of one candidate reference.
+	fetchRegistryTags = listRepositoryTags
+)
+
+// errRepositoryNotFound is returned when a registry does not have the repository at all.
+var errRepositoryNotFound = errors.New("repository not found")
+
+// GHCRPackage is a GHCR reference of the catalog, moved into GHCRNamespace.
+type GHCRPackage struct {
+	Repository string // "ghcr.io/kspeeder/win11x64"
+	Tag        string // "cn_simplified"
+	Release    *catalog.Release
+	Editions   []string
+}
+
+// CatalogGHCRPackages lists the GHCR packages the current catalog refers to.
+func CatalogGHCRPackages() []GHCRPackage {
+	var pkgs []GHCRPackage
+	for _, o := range catalog.Current().OS {
+		for _, rel := range o.Releases {
+			for _, g := range rel.GHCR {
+				if pkg, ok := ghcrPackage(rel, g.Ref); ok {
+					pkg.Editions = g.Editions
+					pkgs = append(pkgs, pkg)
+				}
+			}
+		}
+	}
+	return pkgs
+}
+
+func ghcrPackage(rel *catalog.Release, ref string) (GHCRPackage, bool) {
+	host, repo, tag, err := parseRegistryReference(ghcrNamespaced(rel.Template(ref)))
+	if err != nil {
+		return GHCRPackage{}, false
+	}
+	return GHCRPackage{Repository: host + "/" + repo, Tag: tag, Release: rel}, true
+}
+
+// ListRegistryTags lists the tags of a repository such as "ghcr.io/kspeeder/win11x64",
+// trying the registry mirrors in the same order as downloads. A successful result is
+// cached for the life of the process.
+func ListRegistryTags(ctx context.Context, repository string) ([]string, error) {
+	repository = strings.TrimSpace(repository)
+	if i := strings.LastIndexByte(repository, ':'); i > strings.LastIndexByte(repository, '/') {
+		repository = repository[:i]
+	}
+	registryTagsMu.Lock()
+	defer registryTagsMu.Unlock()
+	if tags, ok := registryTags[repository]; ok {
+		return tags, nil
+	}
+
+	reference := repository + ":latest"
+	mirrors, err := registryMirrors(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, candidate := range buildGHCRReferences(reference, mirrors) {
+		tags, err := fetchRegistryTags(ctx, candidate)
+		if err != nil {
+			lastErr = explainRegistryAuthError(candidate, err)
+			continue
+		}
+		sort.Strings(tags)
+		registryTags[repository] = tags
+		return tags, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no GHCR reference candidates")
+	}
+	return nil, fmt.Errorf("list tags of %s: %w", repository, lastErr)
+}
+
+// ghcrPublished reports whether the registry of a catalog GHCR reference lists its tag, so
+// packages that are not published yet are skipped rather than tried. When the tags cannot
+// be listed the package is assumed to exist and its download decides.
+func ghcrPublished(ctx context.Context, reference string) bool {
+	host, repo, tag, err := parseRegistryReference(reference)
+	if err != nil {
+		return false
+	}
+	tags, err := ListRegistryTags(ctx, host+"/"+repo)
+	if errors.Is(err, errRepositoryNotFound) {
+		return false
+	}
+	return err != nil || slices.Contains(tags, tag)
+}
+
+// listRepositoryTags reads every page of the tag list of the repository of reference.
+func listRepositoryTags(ctx context.Context, reference string) ([]string, error) {
+	host, repo, _, err := parseRegistryReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	creds := registryCredentials(host)
+	c := &registryClient{
+		client: registryHTTPClient,
+		base:   registryURL(host),
+		repo:   repo,
+		scope:  "pull",
+		user:   creds.User(),
+		pass:   creds.Password(),
+	}
+	var tags []string
+	next := c.url("tags/list")
+	for next != "" {
+		resp, err := c.do(ctx, http.MethodGet, next, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			err = json.NewDecoder(resp.Body).Decode(&page)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			err = lib.AutorizationError("list tags: " + resp.Status)
+		case http.StatusNotFound:
+			err = fmt.Errorf("list tags: %w", errRepositoryNotFound)
+		default:
+			err = fmt.Errorf("list tags: %s", resp.Status)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+		next = nextPageURL(c.base, resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// nextPageURL returns the rel="next" target of a Link header, resolved against base.
+func nextPageURL(base url.URL, link string) string {
+	target, params, ok := strings.Cut(link, ";")
+	if !ok || !strings.Contains(params, `rel="next"`) {
+		return ""
+	}
+	u, err := base.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// AvailableGHCREditions returns the editions of rel whose GHCR package is actually
+// published, according to the tag list of its repositories.
+func AvailableGHCREditions(ctx context.Context, rel *catalog.Release) ([]string, error) {
+	var editions []string
+	for _, g := range rel.GHCR {
+		pkg, ok := ghcrPackage(rel, g.Ref)
+		if !ok {
+			continue
+		}
+		tags, err := ListRegistryTags(ctx, pkg.Repository)
+		if err != nil {
+			return nil, err
+		}
+		if i := sort.SearchStrings(tags, pkg.Tag); i < len(tags) && tags[i] == pkg.Tag {
+			editions = append(editions, g.Editions...)
+		}
+	}
+	return editions, nil
+}
@@ -0,0 +1,61 @@
+package vmdownloader
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestAvailableGHCREditions(t *testing.T) {
+	calls := 0
+	oldFetch, oldSelector := fetchRegistryTags, GHCRMirrorSelector
+	defer func() {
+		fetchRegistryTags, GHCRMirrorSelector = oldFetch, oldSelector
+		registryTags = make(map[string][]string)
+	}()
+	GHCRMirrorSelector = func(context.Context, string) ([]string, error) { return []string{}, nil }
+	fetchRegistryTags = func(_ context.Context, reference string) ([]string, error) {
+		calls++
+		if reference != "ghcr.io/kspeeder/win11x64:latest" {
+			t.Fatalf("unexpected reference %s", reference)
+		}
+		return []string{"en_us", "cn_simplified"}, nil
+	}
+
+	rel, err := WindowsRelease(Win11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	editions, err := AvailableGHCREditions(context.Background(), rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(editions, []string{"Chinese (Simplified)", "English (United States)"}) {
+		t.Fatalf("AvailableGHCREditions = %v", editions)
+	}
+	if calls != 1 {
+		t.Fatalf("tag list fetched %d times, want once", calls)
+	}
+	tags, err := ListRegistryTags(context.Background(), "ghcr.io/kspeeder/win11x64:ignored")
+	if err != nil || !slices.Equal(tags, []string{"cn_simplified", "en_us"}) || calls != 1 {
+		t.Fatalf("ListRegistryTags = %v, %v after %d fetches", tags, err, calls)
+	}
+
+	if loc, ok := ghcrLocation(context.Background(), rel, "English (United States)"); !ok || loc != "oci://ghcr.io/kspeeder/win11x64:en_us" {
+		t.Fatalf("ghcrLocation(en_us) = %q, %v", loc, ok)
+	}
+	if loc, ok := ghcrLocation(context.Background(), rel, "LTSC Chinese (Simplified)"); ok {
+		t.Fatalf("unpublished package offered as %s", loc)
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	base := url.URL{Scheme: "https", Host: "ghcr.io"}
+	if got := nextPageURL(base, `</v2/kspeeder/win11x64/tags/list?last=en_us&n=100>; rel="next"`); got != "https://ghcr.io/v2/kspeeder/win11x64/tags/list?last=en_us&n=100" {
+		t.Fatalf("nextPageURL = %s", got)
+	}
+	if got := nextPageURL(base, ""); got != "" {
+		t.Fatalf("nextPageURL without a link = %s", got)
+	}
+}
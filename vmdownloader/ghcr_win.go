@@ -4,127 +4,62 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
-	"sync/atomic"
-	"time"
 
-	"github.com/kspeeder/blobDownload/blobDownloader"
 	"github.com/kspeeder/docker-registry/lib"
-	"github.com/linkease/fastpve/utils"
+	"github.com/linkease/fastpve/catalog"
 )
 
 const (
-	defaultGHCRMirror = "ghcr.1ms.run"
+	defaultGHCRMirror    = "ghcr.1ms.run"
+	defaultGHCRNamespace = "ghcr.io/kspeeder"
 )
 
 var (
 	defaultGHCRMirrors = []string{defaultGHCRMirror}
 	// GHCRMirrorSelector, when set, is used to obtain user preferred registry mirrors before attempting a download.
 	GHCRMirrorSelector func(ctx context.Context, reference string) ([]string, error)
+	// GHCRNamespace, when set, replaces "ghcr.io/kspeeder" in the GHCR references of the
+	// catalog, so a team can serve the same packages from its own registry.
+	GHCRNamespace string
+	// RegistryPlainHTTP reaches every registry over plain HTTP instead of HTTPS, e.g. a
+	// local test registry.
+	RegistryPlainHTTP bool
 )
 
-func downloadWindowsFromGHCR(ctx context.Context, isoPath string, version int, edition string) (string, error) {
-	ref, err := ghcrWindowsReference(version, edition)
-	if err != nil {
-		return "", err
-	}
-
-	mirrors := defaultGHCRMirrors
-	if GHCRMirrorSelector != nil {
-		selected, err := GHCRMirrorSelector(ctx, ref)
-		if err != nil {
-			return "", err
-		}
-		if selected != nil {
-			mirrors = selected
-		}
-	}
-	refs := buildGHCRReferences(ref, mirrors)
-
-	var lastErr error
-	for _, candidate := range refs {
-		target, err := fetchGHCRArtifact(ctx, candidate, isoPath)
-		if err == nil {
-			return target, nil
-		}
-		lastErr = err
-	}
-	if lastErr == nil {
-		lastErr = errors.New("no GHCR reference candidates")
-	}
-	return "", fmt.Errorf("GHCR fallback failed: %w", lastErr)
+// SetGHCRNamespace configures GHCRNamespace from user input such as a flag or
+// FASTPVE_GHCR_NAMESPACE, e.g. "harbor.example.com/isos".
+func SetGHCRNamespace(namespace string) {
+	GHCRNamespace = strings.TrimSuffix(strings.TrimSpace(namespace), "/")
 }
 
-func fetchGHCRArtifact(ctx context.Context, reference, isoPath string) (string, error) {
-	api, refspec, err := buildRegistryClient(reference)
-	if err != nil {
-		return "", err
-	}
-	dl, err := blobDownloader.New(ctx, api, refspec)
-	if err != nil {
-		return "", err
-	}
-	files := dl.Files()
-	if len(files) == 0 {
-		return "", errors.New("GHCR package contains no files")
-	}
-	entry := files[0]
-	dest := filepath.Join(isoPath, entry.Name)
-	if info, err := os.Stat(dest); err == nil && info.Size() == entry.Size {
-		return dest, nil
-	}
-
-	temp := dest + ".syn"
-	start := int64(0)
-	if info, err := os.Stat(temp); err == nil {
-		start = info.Size()
-		if start > entry.Size {
-			start = 0
-		}
-	}
-	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-		return "", err
-	}
-	out, err := os.OpenFile(temp, os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return "", err
-	}
-	defer out.Close()
-
-	if _, err := out.Seek(start, io.SeekStart); err != nil {
-		return "", err
+// ghcrNamespaced moves a catalog GHCR reference into GHCRNamespace.
+func ghcrNamespaced(ref string) string {
+	if GHCRNamespace == "" {
+		return ref
 	}
-
-	reader, err := dl.ReaderAt(ctx, entry.Name, start)
-	if err != nil {
-		return "", err
+	if rest, ok := strings.CutPrefix(ref, defaultGHCRNamespace+"/"); ok {
+		return GHCRNamespace + "/" + rest
 	}
-	defer reader.Close()
-
-	var written int64
-	stopCh := make(chan struct{})
-	go reportGHCRProgress(entry.Name, entry.Size, start, &written, stopCh)
+	return ref
+}
 
-	if _, err := io.Copy(io.MultiWriter(out, &progressWriter{counter: &written}), reader); err != nil {
-		close(stopCh)
-		return "", err
+// ghcrLocation returns the GHCR package of rel for edition as a download location, moved
+// into GHCRNamespace, for flows to try after their mirrors. Packages the registry does
+// not list yet are skipped.
+func ghcrLocation(ctx context.Context, rel *catalog.Release, edition string) (string, bool) {
+	ref, ok := rel.GHCRReference(edition)
+	if !ok {
+		return "", false
 	}
-	close(stopCh)
-	if err := out.Sync(); err != nil {
-		return "", err
-	}
-	if err := out.Close(); err != nil {
-		return "", err
-	}
-
-	if err := os.Rename(temp, dest); err != nil {
-		return "", err
+	ref = ghcrNamespaced(rel.Template(ref))
+	if !ghcrPublished(ctx, ref) {
+		fmt.Println("GHCR 包尚未发布，跳过:", ref)
+		return "", false
 	}
-	return dest, nil
+	return "oci://" + ref, true
 }
 
 func buildRegistryClient(reference string) (lib.RegistryApi, lib.Refspec, error) {
@@ -133,11 +68,10 @@ func buildRegistryClient(reference string) (lib.RegistryApi, lib.Refspec, error)
 		return nil, nil, err
 	}
 
-	user, pass := ghcrCredentials()
 	cfg := lib.NewConfig()
-	cfg.SetUrl(url.URL{Scheme: "https", Host: host})
+	cfg.SetUrl(registryURL(host))
 	cfg.SetAllowInsecure(false)
-	cfg.SetCredentials(lib.NewRegistryCredentials(user, pass))
+	cfg.SetCredentials(registryCredentials(host))
 
 	api, err := lib.NewRegistryApi(cfg)
 	if err != nil {
@@ -146,6 +80,14 @@ func buildRegistryClient(reference string) (lib.RegistryApi, lib.Refspec, error)
 	return api, lib.NewRefspec(repo, tag), nil
 }
 
+// registryURL is the base URL of the registry at host.
+func registryURL(host string) url.URL {
+	if RegistryPlainHTTP {
+		return url.URL{Scheme: "http", Host: host}
+	}
+	return url.URL{Scheme: "https", Host: host}
+}
+
 func ghcrCredentials() (string, string) {
 	user := envDefault("GHCR_USERNAME", envDefault("GITHUB_ACTOR", ""))
 	pass := envDefault("GHCR_PASSWORD", envDefault("GITHUB_TOKEN", ""))
@@ -196,30 +138,18 @@ func buildGHCRReferences(ref string, mirrors []string) []string {
 }
 
 func ghcrWindowsReference(version int, edition string) (string, error) {
-	switch version {
-	case Win11:
-		if !strings.EqualFold(edition, "Chinese (Simplified)") {
-			return "", fmt.Errorf("GHCR Windows 11 仅支持 Chinese (Simplified)")
-		}
-		return "ghcr.io/kspeeder/win11x64:cn_simplified", nil
-	case Win10:
-		if !strings.EqualFold(edition, "Chinese (Simplified)") {
-			return "", fmt.Errorf("GHCR Windows 10 仅支持 Chinese (Simplified)")
-		}
-		return "ghcr.io/kspeeder/win10x64:cn_simplified", nil
-	case Win7:
-		edition = strings.TrimSpace(edition)
-		switch {
-		case edition == "" || strings.EqualFold(edition, "English Enterprise"):
-			return "ghcr.io/kspeeder/win7x64:en_enterprise", nil
-		case strings.EqualFold(edition, "Chinese (Simplified)") || strings.EqualFold(edition, "Chinese (Simplified) x64"):
-			return "ghcr.io/kspeeder/win7x64:cn_simplified", nil
-		default:
-			return "", fmt.Errorf("GHCR Windows 7 仅支持 English Enterprise 或 Chinese (Simplified)")
-		}
-	default:
+	rel, err := WindowsRelease(version)
+	if err != nil {
 		return "", fmt.Errorf("unsupported Windows version for GHCR: %d", version)
 	}
+	if ref, ok := rel.GHCRReference(edition); ok {
+		return ref, nil
+	}
+	editions := rel.GHCREditions()
+	if len(editions) == 0 {
+		return "", fmt.Errorf("GHCR 暂无 %s 镜像", rel.Name)
+	}
+	return "", fmt.Errorf("GHCR Windows %s 仅支持 %s", rel.ID, strings.Join(editions, " 或 "))
 }
 
 func parseRegistryReference(reference string) (host, repo, tag string, err error) {
@@ -241,37 +171,3 @@ func parseRegistryReference(reference string) (host, repo, tag string, err error
 	tag = remainder[colon+1:]
 	return host, repo, tag, nil
 }
-
-type progressWriter struct {
-	counter *int64
-}
-
-func (p *progressWriter) Write(b []byte) (int, error) {
-	n := len(b)
-	if p.counter != nil {
-		atomic.AddInt64(p.counter, int64(n))
-	}
-	return n, nil
-}
-
-func reportGHCRProgress(name string, total, start int64, written *int64, stopCh <-chan struct{}) {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-	lastBytes := start
-	lastTime := time.Now()
-	for {
-		select {
-		case <-stopCh:
-			return
-		case <-ticker.C:
-			curr := atomic.LoadInt64(written) + start
-			delta := curr - lastBytes
-			elapsed := time.Since(lastTime).Seconds()
-			speed := float64(delta) / (elapsed + 1e-6)
-			percent := curr * 100 / (total + 1)
-			fmt.Printf("GHCR downloading %s: %02d%%, %s/s\n", name, percent, utils.ByteCountDecimal(uint64(speed)))
-			lastBytes = curr
-			lastTime = time.Now()
-		}
-	}
-}
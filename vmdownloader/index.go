@@ -0,0 +1,130 @@
+package vmdownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const maxIndexSize = 4 << 20
+
+var hrefPattern = regexp.MustCompile(`(?i)href\s*=\s*["']([^"'#?]+)["']`)
+
+// ListIndex returns the entries of an HTTP directory listing (nginx, Apache, mirror
+// front ends), directories keeping their trailing slash. Parent and absolute links are skipped.
+// An s3://bucket/prefix/ location lists the objects and sub prefixes under the prefix.
+func ListIndex(ctx context.Context, d Downloader, urlStr string) ([]string, error) {
+	if strings.HasPrefix(urlStr, "s3://") {
+		return listS3Index(ctx, d, urlStr)
+	}
+	body, err := fetchText(ctx, d, urlStr, maxIndexSize)
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	seen := make(map[string]struct{})
+	for _, m := range hrefPattern.FindAllStringSubmatch(body, -1) {
+		name, err := url.PathUnescape(m[1])
+		if err != nil {
+			continue
+		}
+		name = strings.TrimPrefix(name, "./")
+		if name == "" || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "..") || strings.Contains(name, "://") {
+			continue
+		}
+		if strings.Contains(strings.TrimSuffix(name, "/"), "/") {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		entries = append(entries, name)
+	}
+	return entries, nil
+}
+
+func listS3Index(ctx context.Context, d Downloader, urlStr string) ([]string, error) {
+	bucket, prefix, err := parseS3URL(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	client, err := newS3Client(d)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := client.List(ctx, bucket, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	for _, o := range objects {
+		if name := strings.TrimPrefix(o.Key, prefix); name != "" {
+			entries = append(entries, name)
+		}
+	}
+	return entries, nil
+}
+
+func fetchText(ctx context.Context, d Downloader, urlStr string, limit int64) (string, error) {
+	if !isHTTPURL(urlStr) {
+		src, err := NewSource(d, urlStr)
+		if err != nil {
+			return "", err
+		}
+		r, err := src.Open(ctx, 0)
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		data, err := io.ReadAll(io.LimitReader(r, limit))
+		return string(data), err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.DefaultClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch %s: %s", urlStr, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// compareVersions compares dotted numeric versions such as "24.04" and "24.04.2".
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
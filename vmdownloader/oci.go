@@ -0,0 +1,222 @@
+package vmdownloader
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kspeeder/blobDownload/blobDownloader"
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/utils"
+)
+
+var errOCIFileNotFound = errors.New("file not found in package")
+
+// DownloadOCIFiles downloads the files of the OCI package at reference matching any of
+// patterns (names or path.Match globs) into dir and returns their paths; no patterns
+// selects the first file. Registry mirrors from GHCRMirrorSelector are tried first,
+// ghcr.io packages default to defaultGHCRMirrors. Files download like any other source:
+// an interrupted download resumes from the ".syn" file through the ".ops" status next to
+// it, and every file, including one already present, is verified against the digests of
+// its blobs.
+func DownloadOCIFiles(ctx context.Context, reference, dir string, patterns []string) ([]string, error) {
+	dl, err := openOCIPackage(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := selectOCIFiles(dl.Files(), patterns)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		src := &ociSource{reference: reference, file: entry.Name, dl: dl, entry: entry}
+		target, err := downloadOCIEntry(ctx, src, dir)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// openOCIPackage reads the package manifest at reference from the first registry mirror
+// that serves it.
+func openOCIPackage(ctx context.Context, reference string) (*blobDownloader.Downloader, error) {
+	mirrors, err := registryMirrors(ctx, reference)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, candidate := range buildGHCRReferences(reference, mirrors) {
+		api, refspec, err := buildRegistryClient(candidate)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		dl, err := blobDownloader.New(ctx, api, refspec)
+		if err != nil {
+			lastErr = explainRegistryAuthError(candidate, err)
+			continue
+		}
+		return dl, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no GHCR reference candidates")
+	}
+	return nil, fmt.Errorf("open %s: %w", reference, lastErr)
+}
+
+func registryMirrors(ctx context.Context, reference string) ([]string, error) {
+	if GHCRMirrorSelector != nil {
+		selected, err := GHCRMirrorSelector(ctx, reference)
+		if err != nil {
+			return nil, err
+		}
+		if selected != nil {
+			return selected, nil
+		}
+	}
+	if host, _, _, err := parseRegistryReference(reference); err == nil && host == "ghcr.io" {
+		return defaultGHCRMirrors, nil
+	}
+	return nil, nil
+}
+
+func downloadOCIEntry(ctx context.Context, src *ociSource, dir string) (string, error) {
+	dest := filepath.Join(dir, src.entry.Name)
+	if info, err := os.Stat(dest); err == nil && info.Size() == src.entry.Size {
+		err := src.Verify(dest)
+		if err == nil {
+			return dest, nil
+		}
+		fmt.Println("已有文件校验失败，重新下载:", err)
+		os.Remove(dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+	statusPath := dest + ".ops"
+	status, err := downloader.ReadUpdateDownload(statusPath)
+	if err != nil || status.Url != src.ID() {
+		status = &downloader.DownloadStatus{Url: src.ID(), TargetFile: dest + ".syn"}
+	}
+	fmt.Println("downloading:", src.entry.Name, "url=\n", src.ID())
+	if err := copySource(ctx, src, statusPath, status); err != nil {
+		return "", err
+	}
+	if err := moveFile(status.TargetFile, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// selectOCIFiles returns the files matching any of patterns, in package order; every
+// pattern must match at least one file.
+func selectOCIFiles(files []blobDownloader.FileEntry, patterns []string) ([]blobDownloader.FileEntry, error) {
+	if len(files) == 0 {
+		return nil, errors.New("GHCR package contains no files")
+	}
+	if len(patterns) == 0 {
+		return files[:1], nil
+	}
+	matched := make([]bool, len(files))
+	for _, pattern := range patterns {
+		found := false
+		for i, f := range files {
+			ok, err := path.Match(pattern, f.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+			}
+			if ok || f.Name == pattern {
+				matched[i], found = true, true
+			}
+		}
+		if !found {
+			names := make([]string, len(files))
+			for i, f := range files {
+				names[i] = f.Name
+			}
+			return nil, fmt.Errorf("%w: %s (available: %s)", errOCIFileNotFound, pattern, strings.Join(names, ", "))
+		}
+	}
+	var selected []blobDownloader.FileEntry
+	for i, f := range files {
+		if matched[i] {
+			selected = append(selected, f)
+		}
+	}
+	return selected, nil
+}
+
+// verifyOCIEntry checks filePath against the digest of every blob (chunk) of entry, and
+// against the whole file hash when the package records one, in a single pass.
+func verifyOCIEntry(filePath string, entry blobDownloader.FileEntry) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var whole hash.Hash
+	wholeAlgo, wholeWant, _ := strings.Cut(ociFileChecksum(entry.Hash), ":")
+	if wholeWant != "" {
+		if whole, err = newHash(wholeAlgo); err != nil {
+			return err
+		}
+	}
+
+	chunks := append([]blobDownloader.FileChunk(nil), entry.Chunks...)
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	fmt.Println("校验", entry.Name, "...")
+	for _, c := range chunks {
+		algo, want, ok := strings.Cut(c.Digest, ":")
+		if !ok {
+			return fmt.Errorf("invalid blob digest %q", c.Digest)
+		}
+		h, err := newHash(algo)
+		if err != nil {
+			return err
+		}
+		var w io.Writer = h
+		if whole != nil {
+			w = io.MultiWriter(h, whole)
+		}
+		if _, err := io.CopyN(w, f, c.Size); err != nil {
+			return fmt.Errorf("%w: %s blob %d: %v", ErrChecksumMismatch, entry.Name, c.Index, err)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+			return fmt.Errorf("%w: %s blob %d want %s got %s", ErrChecksumMismatch, entry.Name, c.Index, c.Digest, got)
+		}
+	}
+	if n, _ := f.Read(make([]byte, 1)); n > 0 {
+		return fmt.Errorf("%w: %s is larger than its blobs", ErrChecksumMismatch, entry.Name)
+	}
+	if whole != nil {
+		if got := hex.EncodeToString(whole.Sum(nil)); !strings.EqualFold(got, wholeWant) {
+			return fmt.Errorf("%w: %s %s want %s got %s", ErrChecksumMismatch, entry.Name, wholeAlgo, wholeWant, got)
+		}
+	}
+	return nil
+}
+
+// ociFileChecksum turns the hash a package records for a file, "sha256:<hex>" or a bare
+// hex digest, into a VerifyChecksum value.
+func ociFileChecksum(sum string) string {
+	sum = strings.TrimSpace(sum)
+	if sum == "" || strings.Contains(sum, ":") {
+		return sum
+	}
+	if algo, ok := utils.ChecksumAlgo(sum); ok {
+		return algo + ":" + strings.ToLower(sum)
+	}
+	return ""
+}
@@ -0,0 +1,346 @@
+package vmdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kspeeder/blobDownload/blobDownloader"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Media types of the file packages read by blobDownloader.
+const (
+	ociArtifactType    = "application/vnd.linkease.file-package.v1"
+	ociConfigMediaType = "application/vnd.linkease.file-package.config.v1+json"
+	ociChunkMediaType  = "application/vnd.linkease.file-package.chunk.v1+octet-stream"
+
+	// DefaultOCIChunkSize keeps every blob well below registry layer limits and bounds
+	// what an interrupted upload has to resend.
+	DefaultOCIChunkSize = 512 << 20
+)
+
+// OCIPushOptions tunes PushOCIFile.
+type OCIPushOptions struct {
+	// ChunkSize splits the file into blobs of at most this size; 0 uses DefaultOCIChunkSize.
+	ChunkSize int64
+	// SourceURL, when set, is recorded in the org.opencontainers.image.source annotation.
+	SourceURL string
+	// PlainHTTP talks to the registry without TLS, e.g. a local test registry.
+	PlainHTTP bool
+	// Username and Password authenticate the push; empty uses the credentials configured
+	// for the registry host (see registryCredentials).
+	Username string
+	Password string
+}
+
+// PushOCIFile uploads a local file to reference as a file package that DownloadOCIFiles
+// (and any blobDownloader client) can fetch, and returns the manifest digest. The file
+// is split into chunk blobs; blobs the registry already has are skipped, so running the
+// push again resumes an interrupted upload.
+func PushOCIFile(ctx context.Context, filePath, reference string, opts OCIPushOptions) (string, error) {
+	host, repo, tag, err := parseRegistryReference(reference)
+	if err != nil {
+		return "", err
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultOCIChunkSize
+	}
+	if opts.Username == "" && opts.Password == "" {
+		creds := registryCredentials(host)
+		opts.Username, opts.Password = creds.User(), creds.Password()
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(filePath)
+
+	fmt.Println("计算摘要", name, "...")
+	entry, err := ociFileEntry(f, name, info.Size(), opts.ChunkSize)
+	if err != nil {
+		return "", err
+	}
+
+	p := &registryClient{
+		client: registryHTTPClient,
+		base:   registryURL(host),
+		repo:   repo,
+		scope:  "pull,push",
+		user:   opts.Username,
+		pass:   opts.Password,
+	}
+	if opts.PlainHTTP {
+		p.base.Scheme = "http"
+	}
+
+	layers := make([]ocispec.Descriptor, 0, len(entry.Chunks))
+	var offset int64
+	for _, c := range entry.Chunks {
+		skipped, err := p.uploadBlob(ctx, c.Digest, io.NewSectionReader(f, offset, c.Size))
+		offset += c.Size
+		if err != nil {
+			return "", err
+		}
+		if skipped {
+			fmt.Printf("%s 分块 %d/%d 已存在，跳过\n", name, c.Index+1, len(entry.Chunks))
+		} else {
+			fmt.Printf("%s 分块 %d/%d 已上传\n", name, c.Index+1, len(entry.Chunks))
+		}
+		title := name
+		if len(entry.Chunks) > 1 {
+			title = fmt.Sprintf("%s.part-%05d", name, c.Index)
+		}
+		layers = append(layers, ocispec.Descriptor{
+			MediaType:   ociChunkMediaType,
+			Digest:      digest.Digest(c.Digest),
+			Size:        c.Size,
+			Annotations: map[string]string{ocispec.AnnotationTitle: title},
+		})
+	}
+
+	created := time.Now().UTC()
+	config, err := json.Marshal(blobDownloader.PackageConfig{
+		Version:      "1.0.0",
+		ArtifactType: ociArtifactType,
+		CreatedAt:    created,
+		ChunkSize:    opts.ChunkSize,
+		Files:        []blobDownloader.FileEntry{entry},
+	})
+	if err != nil {
+		return "", err
+	}
+	configDigest := digest.FromBytes(config)
+	if _, err := p.uploadBlob(ctx, configDigest.String(), io.NewSectionReader(bytes.NewReader(config), 0, int64(len(config)))); err != nil {
+		return "", err
+	}
+
+	annotations := map[string]string{
+		ocispec.AnnotationTitle:   name,
+		ocispec.AnnotationCreated: created.Format(time.RFC3339),
+	}
+	if opts.SourceURL != "" {
+		annotations[ocispec.AnnotationSource] = opts.SourceURL
+	}
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: ociArtifactType,
+		Config: ocispec.Descriptor{
+			MediaType: ociConfigMediaType,
+			Digest:    configDigest,
+			Size:      int64(len(config)),
+		},
+		Layers:      layers,
+		Annotations: annotations,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := p.putManifest(ctx, tag, manifest); err != nil {
+		return "", err
+	}
+	return digest.FromBytes(manifest).String(), nil
+}
+
+// ociFileEntry reads f once to describe it as chunk blobs of at most chunkSize bytes.
+func ociFileEntry(f io.ReaderAt, name string, size, chunkSize int64) (blobDownloader.FileEntry, error) {
+	entry := blobDownloader.FileEntry{
+		Name:      name,
+		Size:      size,
+		ChunkSize: chunkSize,
+		MediaType: ociChunkMediaType,
+	}
+	whole := sha256.New()
+	for offset, index := int64(0), 0; offset < size || index == 0; index++ {
+		n := min(chunkSize, size-offset)
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(h, whole), io.NewSectionReader(f, offset, n)); err != nil {
+			return entry, err
+		}
+		entry.Chunks = append(entry.Chunks, blobDownloader.FileChunk{
+			Digest: "sha256:" + hex.EncodeToString(h.Sum(nil)),
+			Size:   n,
+			Index:  index,
+		})
+		offset += n
+	}
+	entry.TotalChunk = len(entry.Chunks)
+	entry.Hash = "sha256:" + hex.EncodeToString(whole.Sum(nil))
+	return entry, nil
+}
+
+// ociUploadPartSize is the size of the requests a blob is uploaded in. After a failed
+// request the upload continues from the offset the registry reports, so an interrupted
+// connection resends at most one part rather than the whole blob.
+var ociUploadPartSize int64 = 16 << 20
+
+// ociUploadRetries is how many failed parts in a row abort the upload of a blob.
+const ociUploadRetries = 3
+
+// uploadBlob uploads a blob unless the registry already has it, which it reports as skipped.
+// The blob is sent in PATCH parts of ociUploadPartSize; a registry that rejects the first
+// part as a chunked upload gets the blob in a single PUT instead.
+func (p *registryClient) uploadBlob(ctx context.Context, dgst string, blob *io.SectionReader) (bool, error) {
+	resp, err := p.do(ctx, http.MethodHead, p.url("blobs/"+dgst), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return true, nil
+	}
+
+	resp, err = p.do(ctx, http.MethodPost, p.url("blobs/uploads/"), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return false, fmt.Errorf("start blob upload: %s", resp.Status)
+	}
+	location, err := p.uploadLocation(resp, nil)
+	if err != nil {
+		return false, err
+	}
+
+	size := blob.Size()
+	var offset int64
+	for failures := 0; offset < size; {
+		start, n := offset, min(ociUploadPartSize, size-offset)
+		header := http.Header{
+			"Content-Type":  {"application/octet-stream"},
+			"Content-Range": {fmt.Sprintf("%d-%d", start, start+n-1)},
+		}
+		resp, err := p.do(ctx, http.MethodPatch, location.String(), header, func() (io.Reader, int64) {
+			return io.NewSectionReader(blob, start, n), n
+		})
+		if err == nil {
+			resp.Body.Close()
+			switch {
+			case resp.StatusCode == http.StatusAccepted:
+				if location, err = p.uploadLocation(resp, location); err != nil {
+					return false, err
+				}
+				offset += n
+				failures = 0
+				continue
+			case start == 0 && resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable:
+				// The registry does not take chunked uploads.
+				return false, p.putBlob(ctx, location, dgst, blob)
+			}
+			err = errors.New(resp.Status)
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if failures++; failures > ociUploadRetries {
+			return false, fmt.Errorf("upload blob %s: %w", dgst, err)
+		}
+		fmt.Println("上传中断，从已上传的位置继续:", err)
+		if offset, err = p.uploadOffset(ctx, location); err != nil {
+			return false, fmt.Errorf("upload blob %s: %w", dgst, err)
+		}
+	}
+	return false, p.putBlob(ctx, location, dgst, nil)
+}
+
+// putBlob completes the upload session at location with the remaining data, if any.
+func (p *registryClient) putBlob(ctx context.Context, location *url.URL, dgst string, rest *io.SectionReader) error {
+	u := *location
+	q := u.Query()
+	q.Set("digest", dgst)
+	u.RawQuery = q.Encode()
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	var body func() (io.Reader, int64)
+	if rest != nil {
+		body = func() (io.Reader, int64) {
+			return io.NewSectionReader(rest, 0, rest.Size()), rest.Size()
+		}
+	}
+	resp, err := p.do(ctx, http.MethodPut, u.String(), header, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload blob %s: %s", dgst, resp.Status)
+	}
+	return nil
+}
+
+// uploadOffset asks the registry how much of the upload session at location it has
+// stored, from the inclusive end of its Range header.
+func (p *registryClient) uploadOffset(ctx context.Context, location *url.URL) (int64, error) {
+	resp, err := p.do(ctx, http.MethodGet, location.String(), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, fmt.Errorf("blob upload status: %s", resp.Status)
+	}
+	_, end, ok := strings.Cut(resp.Header.Get("Range"), "-")
+	last, err := strconv.ParseInt(end, 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid blob upload range %q", resp.Header.Get("Range"))
+	}
+	if last == 0 {
+		// "0-0" is also what registries report for an empty session.
+		return 0, nil
+	}
+	return last + 1, nil
+}
+
+// uploadLocation resolves the Location of an upload response, keeping current when the
+// registry does not move the session.
+func (p *registryClient) uploadLocation(resp *http.Response, current *url.URL) (*url.URL, error) {
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		if current == nil {
+			return nil, errors.New("blob upload without a location")
+		}
+		return current, nil
+	}
+	u, err := p.base.Parse(loc)
+	if err != nil {
+		return nil, fmt.Errorf("blob upload location: %w", err)
+	}
+	return u, nil
+}
+
+func (p *registryClient) putManifest(ctx context.Context, tag string, manifest []byte) error {
+	header := http.Header{"Content-Type": {ocispec.MediaTypeImageManifest}}
+	resp, err := p.do(ctx, http.MethodPut, p.url("manifests/"+tag), header, func() (io.Reader, int64) {
+		return bytes.NewReader(manifest), int64(len(manifest))
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("put manifest: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package vmdownloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kspeeder/blobDownload/blobDownloader"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// fakeOCIRegistry implements the distribution API behind a bearer token that needs
+// credentials to push. Uploads are chunked; failPatches PATCH requests store only half
+// of their data and then fail.
+type fakeOCIRegistry struct {
+	mu          sync.Mutex
+	blobs       map[string][]byte
+	manifests   map[string][]byte
+	session     []byte
+	uploads     int
+	patches     int
+	failPatches int
+}
+
+func (r *fakeOCIRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.URL.Path == "/token" {
+		user, pass, _ := req.BasicAuth()
+		if strings.Contains(req.URL.Query().Get("scope"), "push") && (user != "bob" || pass != "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "t0k3n"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer t0k3n" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+req.Host+`/token",service="fake"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	const prefix = "/v2/isos/win11/"
+	path := strings.TrimPrefix(req.URL.Path, prefix)
+	switch {
+	case (req.Method == http.MethodHead || req.Method == http.MethodGet) && strings.HasPrefix(path, "blobs/sha256:"):
+		data, ok := r.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(data))
+	case req.Method == http.MethodPost && path == "blobs/uploads/":
+		r.session = nil
+		w.Header().Set("Location", prefix+"blobs/uploads/session?_state=x")
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPatch && path == "blobs/uploads/session":
+		data, _ := io.ReadAll(req.Body)
+		start, _, _ := strings.Cut(req.Header.Get("Content-Range"), "-")
+		if start != strconv.Itoa(len(r.session)) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		r.patches++
+		if r.failPatches > 0 {
+			r.failPatches--
+			r.session = append(r.session, data[:len(data)/2]...)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.session = append(r.session, data...)
+		w.Header().Set("Location", prefix+"blobs/uploads/session?_state=x")
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodGet && path == "blobs/uploads/session":
+		w.Header().Set("Range", fmt.Sprintf("0-%d", max(len(r.session)-1, 0)))
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodPut && path == "blobs/uploads/session":
+		data, _ := io.ReadAll(req.Body)
+		data = append(r.session, data...)
+		want := req.URL.Query().Get("digest")
+		if req.URL.Query().Get("_state") != "x" || digest.FromBytes(data).String() != want {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[want] = data
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodPut && strings.HasPrefix(path, "manifests/"):
+		data, _ := io.ReadAll(req.Body)
+		r.manifests[strings.TrimPrefix(path, "manifests/")] = data
+		w.WriteHeader(http.StatusCreated)
+	case req.Method == http.MethodGet && strings.HasPrefix(path, "manifests/"):
+		data, ok := r.manifests[strings.TrimPrefix(path, "manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPushOCIFile(t *testing.T) {
+	oldPart := ociUploadPartSize
+	ociUploadPartSize = 8
+	defer func() { ociUploadPartSize = oldPart }()
+	reg := &fakeOCIRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}, failPatches: 1}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	file := filepath.Join(t.TempDir(), "win11.iso")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/isos/win11:cn_simplified"
+	opts := OCIPushOptions{
+		ChunkSize: 30,
+		SourceURL: "https://example.com/win11.iso",
+		PlainHTTP: true,
+		Username:  "bob",
+		Password:  "secret",
+	}
+	if _, err := PushOCIFile(context.Background(), file, ref, opts); err != nil {
+		t.Fatalf("PushOCIFile: %v", err)
+	}
+	if reg.uploads != 5 {
+		t.Fatalf("uploaded %d blobs, want 4 chunks and the config", reg.uploads)
+	}
+	if reg.failPatches != 0 || reg.patches < 14 {
+		t.Fatalf("sent %d parts, want the 30 byte chunks in 8 byte parts and a resumed failed part", reg.patches)
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(reg.manifests["cn_simplified"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.ArtifactType != ociArtifactType || manifest.Config.MediaType != ociConfigMediaType || len(manifest.Layers) != 4 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	if manifest.Annotations[ocispec.AnnotationSource] != opts.SourceURL || manifest.Annotations[ocispec.AnnotationTitle] != "win11.iso" {
+		t.Fatalf("unexpected annotations %v", manifest.Annotations)
+	}
+	if title := manifest.Layers[3].Annotations[ocispec.AnnotationTitle]; title != "win11.iso.part-00003" {
+		t.Fatalf("unexpected layer title %q", title)
+	}
+	var config blobDownloader.PackageConfig
+	if err := json.Unmarshal(reg.blobs[manifest.Config.Digest.String()], &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Files) != 1 || config.Files[0].TotalChunk != 4 || config.Files[0].Chunks[3].Size != 10 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	var joined []byte
+	for _, layer := range manifest.Layers {
+		joined = append(joined, reg.blobs[layer.Digest.String()]...)
+	}
+	out := filepath.Join(t.TempDir(), "win11.iso")
+	if err := os.WriteFile(out, joined, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyOCIEntry(out, config.Files[0]); err != nil {
+		t.Fatalf("pushed package does not verify: %v", err)
+	}
+
+	// The package pulls back over plain HTTP with anonymous pull access.
+	RegistryPlainHTTP = true
+	defer func() { RegistryPlainHTTP = false }()
+	targets, err := DownloadOCIFiles(context.Background(), ref, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("DownloadOCIFiles: %v", err)
+	}
+	if got, _ := os.ReadFile(targets[0]); !bytes.Equal(got, data) {
+		t.Fatal("pulled file differs from the pushed one")
+	}
+
+	// A second push finds every chunk in place; only the config, which records the push time, is new.
+	if _, err := PushOCIFile(context.Background(), file, ref, opts); err != nil {
+		t.Fatalf("second PushOCIFile: %v", err)
+	}
+	if reg.uploads != 6 {
+		t.Fatalf("second push uploaded %d blobs, want only the new config", reg.uploads-5)
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	got := parseAuthParams(`realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull"`)
+	if got["realm"] != "https://auth.example.com/token" || got["service"] != "registry.example.com" || got["scope"] != "repository:a/b:pull" {
+		t.Fatalf("unexpected params %v", got)
+	}
+}
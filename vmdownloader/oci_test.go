@@ -0,0 +1,89 @@
+package vmdownloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kspeeder/blobDownload/blobDownloader"
+)
+
+func TestSelectOCIFiles(t *testing.T) {
+	files := []blobDownloader.FileEntry{{Name: "a.iso"}, {Name: "a.iso.sha256"}, {Name: "autounattend.xml"}}
+	names := func(entries []blobDownloader.FileEntry) string {
+		var s []string
+		for _, e := range entries {
+			s = append(s, e.Name)
+		}
+		return strings.Join(s, ",")
+	}
+	tests := []struct {
+		patterns []string
+		want     string
+	}{
+		{nil, "a.iso"},
+		{[]string{"autounattend.xml"}, "autounattend.xml"},
+		{[]string{"a.iso*"}, "a.iso,a.iso.sha256"},
+		{[]string{"*.xml", "a.iso"}, "a.iso,autounattend.xml"},
+	}
+	for _, tt := range tests {
+		got, err := selectOCIFiles(files, tt.patterns)
+		if err != nil || names(got) != tt.want {
+			t.Fatalf("selectOCIFiles(%v) = %s, %v, want %s", tt.patterns, names(got), err, tt.want)
+		}
+	}
+	_, err := selectOCIFiles(files, []string{"*.img"})
+	if !errors.Is(err, errOCIFileNotFound) || !strings.Contains(err.Error(), "a.iso, a.iso.sha256") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestVerifyOCIEntry(t *testing.T) {
+	digest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}
+	data := []byte("hello blob world")
+	entry := blobDownloader.FileEntry{
+		Name: "blob.bin",
+		Size: int64(len(data)),
+		Chunks: []blobDownloader.FileChunk{
+			{Digest: "sha256:" + digest(data[10:]), Size: int64(len(data) - 10), Index: 1},
+			{Digest: "sha256:" + digest(data[:10]), Size: 10, Index: 0},
+		},
+		Hash: digest(data),
+	}
+	file := filepath.Join(t.TempDir(), entry.Name)
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyOCIEntry(file, entry); err != nil {
+		t.Fatalf("verifyOCIEntry: %v", err)
+	}
+
+	if err := os.WriteFile(file, []byte("hello blob World"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyOCIEntry(file, entry); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestOCIFileChecksum(t *testing.T) {
+	hex := strings.Repeat("AB", 32)
+	tests := map[string]string{
+		"":                "",
+		hex:               "sha256:" + strings.ToLower(hex),
+		"sha512:deadbeef": "sha512:deadbeef",
+		"not-a-digest":    "",
+	}
+	for in, want := range tests {
+		if got := ociFileChecksum(in); got != want {
+			t.Fatalf("ociFileChecksum(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package vmdownloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	peerDiscoveryPort   = 8687
+	peerDiscoveryQuery  = "FASTPVE-PEER?"
+	peerDiscoveryReply  = "FASTPVE-PEER "
+	peerManifestTimeout = 3 * time.Second
+)
+
+var (
+	// LANPeers lists other hosts running `fastpve-download serve`, as "host", "host:port" or a base URL.
+	// Files they already have are tried before any internet mirror.
+	LANPeers []string
+	// DiscoverLANPeers enables a one-off UDP broadcast to find serving peers on the local network.
+	DiscoverLANPeers bool
+
+	discoverOnce    sync.Once
+	discoveredPeers []string
+)
+
+var ErrPeerDigestMismatch = errors.New("digest mismatch for file from LAN peer")
+
+// SetLANPeers configures LANPeers from user input such as a flag or FASTPVE_PEERS.
+// Entries may be comma separated; the entry "auto" enables broadcast discovery instead.
+func SetLANPeers(values []string) {
+	LANPeers = nil
+	DiscoverLANPeers = false
+	for _, v := range values {
+		for _, peer := range strings.Split(v, ",") {
+			peer = strings.TrimSpace(peer)
+			switch {
+			case peer == "":
+			case strings.EqualFold(peer, "auto"):
+				DiscoverLANPeers = true
+			default:
+				LANPeers = append(LANPeers, peer)
+			}
+		}
+	}
+}
+
+func peerBaseURL(peer string) string {
+	peer = strings.TrimRight(strings.TrimSpace(peer), "/")
+	if strings.HasPrefix(peer, "http://") || strings.HasPrefix(peer, "https://") {
+		return peer
+	}
+	if _, _, err := net.SplitHostPort(peer); err != nil {
+		peer = net.JoinHostPort(peer, strconv.Itoa(DefaultServePort))
+	}
+	return "http://" + peer
+}
+
+// FetchPeerManifest reads the manifest published by a LAN peer.
+func FetchPeerManifest(ctx context.Context, client *http.Client, peer string) (*Manifest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peerBaseURL(peer)+manifestPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer %s manifest: %s", peer, resp.Status)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func lanPeers() []string {
+	peers := append([]string{}, LANPeers...)
+	if DiscoverLANPeers {
+		discoverOnce.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			discoveredPeers, _ = DiscoverPeers(ctx)
+		})
+		peers = append(peers, discoveredPeers...)
+	}
+	return peers
+}
+
+// peerURLs returns the download URLs of name on every peer that has it hashed. The
+// published digest travels in the URL query so it survives a resumed download; peers
+// still hashing the file are skipped, since their copy could not be verified.
+func peerURLs(ctx context.Context, d Downloader, name string) []string {
+	var urls []string
+	seen := make(map[string]struct{})
+	for _, peer := range lanPeers() {
+		base := peerBaseURL(peer)
+		if _, ok := seen[base]; ok {
+			continue
+		}
+		seen[base] = struct{}{}
+		ctx2, cancel := context.WithTimeout(ctx, peerManifestTimeout)
+		manifest, err := FetchPeerManifest(ctx2, d.DefaultClient(), base)
+		cancel()
+		if err != nil {
+			continue
+		}
+		for _, entry := range manifest.Files {
+			if entry.Name != name || entry.Digest == "" {
+				continue
+			}
+			urls = append(urls, base+filesPrefix+url.PathEscape(entry.Name)+"?digest="+url.QueryEscape(entry.Digest))
+			break
+		}
+	}
+	return urls
+}
+
+// withPeerURLs puts LAN peer candidates for name in front of the internet mirrors.
+func withPeerURLs(ctx context.Context, d Downloader, name string, urls []string) []string {
+	peers := peerURLs(ctx, d, name)
+	if len(peers) == 0 {
+		return urls
+	}
+	fmt.Println("局域网内发现", len(peers), "个已有该文件的节点，优先从局域网下载")
+	return append(peers, urls...)
+}
+
+// isPeerURL reports whether urlStr is a LAN peer candidate from peerURLs.
+func isPeerURL(urlStr string) bool {
+	u, err := url.Parse(urlStr)
+	return err == nil && isHTTPURL(urlStr) && strings.HasPrefix(u.Path, filesPrefix) && u.Query().Has("digest")
+}
+
+// peerFallback returns the candidates that are not LAN peers when urlStr is a peer, to be
+// kept as the status Fallback.
+func peerFallback(urlStr string, candidates []string) []string {
+	if !isPeerURL(urlStr) {
+		return nil
+	}
+	var rest []string
+	for _, c := range candidates {
+		if !isPeerURL(c) {
+			rest = append(rest, c)
+		}
+	}
+	return rest
+}
+
+// verifyPeerDigest checks a file downloaded from a LAN peer against the digest the peer published.
+// URLs that do not carry a digest are accepted as-is.
+func verifyPeerDigest(urlStr, filePath string) error {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil
+	}
+	digest := u.Query().Get("digest")
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil
+	}
+	sum, err := fileSHA256(filePath)
+	if err != nil {
+		return err
+	}
+	if sum != strings.TrimPrefix(digest, "sha256:") {
+		return fmt.Errorf("%w: %s", ErrPeerDigestMismatch, u.Host)
+	}
+	return nil
+}
+
+// AnnouncePeer answers LAN discovery broadcasts with the HTTP port of the local image server until ctx is done.
+func AnnouncePeer(ctx context.Context, httpPort int) error {
+	conn, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", peerDiscoveryPort))
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, 64)
+	reply := []byte(peerDiscoveryReply + strconv.Itoa(httpPort))
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if string(buf[:n]) == peerDiscoveryQuery {
+			conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+// DiscoverPeers broadcasts a discovery query and collects the peers that answer before ctx expires.
+func DiscoverPeers(ctx context.Context) ([]string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+	}
+	dst := &net.UDPAddr{IP: net.IPv4bcast, Port: peerDiscoveryPort}
+	if _, err := conn.WriteTo([]byte(peerDiscoveryQuery), dst); err != nil {
+		return nil, err
+	}
+
+	var peers []string
+	buf := make([]byte, 64)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			// Deadline reached: return whatever answered in time.
+			return peers, nil
+		}
+		msg := string(buf[:n])
+		if !strings.HasPrefix(msg, peerDiscoveryReply) {
+			continue
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		port := strings.TrimPrefix(msg, peerDiscoveryReply)
+		if _, err := strconv.Atoi(port); err != nil {
+			continue
+		}
+		peers = append(peers, net.JoinHostPort(udpAddr.IP.String(), port))
+	}
+}
@@ -0,0 +1,108 @@
+package vmdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/quickget"
+)
+
+// quickgetLookupTimeout bounds a quickget lookup; some OSes scrape several pages.
+const quickgetLookupTimeout = 2 * time.Minute
+
+// DownloadQuickgetImage asks the quickget script for the image of an OS release and
+// downloads it into isoPath through cachePath, verifying the checksum quickget reports.
+// A pending status is resumed when it is for the same file, or whenever osName is empty.
+// accept, when set, is given the file name before anything is downloaded and can refuse
+// files the caller has no use for.
+func DownloadQuickgetImage(ctx context.Context, d Downloader, isoPath, cachePath, statusPath string, status *downloader.DownloadStatus, osName, release, edition string, accept func(fileName string) error) (string, error) {
+	if status != nil && osName == "" {
+		baseFileName := filepath.Base(status.TargetFile)
+		if accept != nil {
+			if err := accept(baseFileName); err != nil {
+				return "", err
+			}
+		}
+		fmt.Println("downloading:", baseFileName, "url=\n", status.Url)
+		target, err := downloadAndMove(ctx, d, statusPath, status, filepath.Join(isoPath, baseFileName))
+		if err != nil {
+			return "", err
+		}
+		return target, verifyDownload(target, status, true)
+	}
+	if osName == "" || release == "" {
+		return "", errors.New("quickget os and release are required")
+	}
+	if err := quickget.EnsureDependencies(ctx); err != nil {
+		return "", err
+	}
+
+	fmt.Println("通过 quickget 获取", strings.TrimSpace(osName+" "+release+" "+edition), "的下载URL...")
+	ctx2, cancel := context.WithTimeout(ctx, quickgetLookupTimeout)
+	res, err := quickget.Lookup(ctx2, osName, release, edition)
+	cancel()
+	if err != nil {
+		return "", err
+	}
+	fileName := quickgetFileName(res)
+	if fileName == "" {
+		return "", fmt.Errorf("%w: no usable file name in %s", ErrInvalidFileName, res.URL)
+	}
+	if accept != nil {
+		if err := accept(fileName); err != nil {
+			return "", err
+		}
+	}
+	dest := filepath.Join(isoPath, fileName)
+	resumed := status != nil && filepath.Base(status.TargetFile) == fileName
+	if !resumed {
+		urls := withPeerURLs(ctx, d, fileName, []string{res.URL})
+		urlStr, totalSize, modTime, err := SelectFirstReachable(d, urls)
+		if err != nil {
+			return "", err
+		}
+		if existingImage(dest, totalSize) {
+			return dest, nil
+		}
+		status = &downloader.DownloadStatus{
+			Url:        urlStr,
+			TargetFile: filepath.Join(cachePath, fileName),
+			TotalSize:  totalSize,
+			ModTime:    modTime,
+			Checksum:   res.Checksum,
+			Fallback:   peerFallback(urlStr, urls),
+		}
+	} else if res.Checksum != "" {
+		status.Checksum = res.Checksum
+	}
+	fmt.Println("downloading:", fileName, "url=\n", status.Url)
+	target, err := downloadAndMove(ctx, d, statusPath, status, dest)
+	if err != nil {
+		return "", err
+	}
+	return target, verifyDownload(target, status, resumed)
+}
+
+// quickgetFileName is the file quickget would save the image as, or the last element
+// of the URL path; it is empty when the name has characters outside imageNamePattern.
+func quickgetFileName(res *quickget.Result) string {
+	name := filepath.Base(res.File)
+	if res.File == "" {
+		u, err := url.Parse(res.URL)
+		if err != nil {
+			return ""
+		}
+		name = path.Base(u.Path)
+	}
+	if !imageNamePattern.MatchString(name) {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,24 @@
+package vmdownloader
+
+import (
+	"testing"
+
+	"github.com/linkease/fastpve/quickget"
+)
+
+func TestQuickgetFileName(t *testing.T) {
+	tests := []struct {
+		res  quickget.Result
+		want string
+	}{
+		{quickget.Result{URL: "https://example.com/isos/a.iso", File: "b.iso"}, "b.iso"},
+		{quickget.Result{URL: "https://example.com/isos/a.iso?t=1", File: ""}, "a.iso"},
+		{quickget.Result{URL: "https://example.com/", File: ""}, ""},
+		{quickget.Result{URL: "https://example.com/a.iso", File: "Win 11.iso"}, ""},
+	}
+	for _, tt := range tests {
+		if got := quickgetFileName(&tt.res); got != tt.want {
+			t.Fatalf("quickgetFileName(%+v) = %q, want %q", tt.res, got, tt.want)
+		}
+	}
+}
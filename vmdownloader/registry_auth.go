@@ -0,0 +1,207 @@
+package vmdownloader
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kspeeder/docker-registry/lib"
+)
+
+// registryCredentials returns the credentials for one registry host, so every mirror
+// tried by buildGHCRReferences authenticates with its own account. GHCR_USERNAME /
+// GHCR_PASSWORD (or GITHUB_ACTOR / GITHUB_TOKEN) apply to ghcr.io only and are never
+// sent to a mirror; any other host, and ghcr.io without those variables, uses the auths
+// and credential helpers of the Docker config (~/.docker/config.json, or $DOCKER_CONFIG).
+func registryCredentials(host string) lib.RegistryCredentials {
+	if host == "ghcr.io" {
+		if user, pass := ghcrCredentials(); user != "" || pass != "" {
+			return lib.NewRegistryCredentials(user, pass)
+		}
+	}
+	creds := lib.NewRegistryCredentials("", "")
+	creds.LoadCredentialsFromDockerConfig(url.URL{Host: host})
+	return creds
+}
+
+// explainRegistryAuthError turns an authorization failure against the registry of
+// reference into a message saying which credentials were tried and how to supply them.
+func explainRegistryAuthError(reference string, err error) error {
+	var authErr lib.AutorizationError
+	if err == nil || !(errors.As(err, &authErr) || strings.Contains(err.Error(), "authentication against auth server failed")) {
+		return err
+	}
+	host, _, _, perr := parseRegistryReference(reference)
+	if perr != nil {
+		return err
+	}
+	creds := registryCredentials(host)
+	if creds.IsBlank() && creds.IdentityToken() == "" {
+		hint := "docker login " + host
+		if host == "ghcr.io" {
+			hint += " 或设置 GHCR_USERNAME/GHCR_PASSWORD"
+		}
+		return fmt.Errorf("匿名访问 %s 被拒绝（私有包或匿名令牌获取失败），请先 %s: %w", host, hint, err)
+	}
+	return fmt.Errorf("%s 拒绝了已配置的凭据，请检查 docker login %s 的账号或令牌权限: %w", host, host, err)
+}
+
+// registryHTTPClient bounds how long a registry may take to accept a connection and to
+// answer a request. Request bodies, such as blob uploads, are not limited.
+var registryHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// registryClient speaks the OCI distribution API for one repository, authenticating with
+// basic credentials or a bearer token for scope obtained from the registry's token service.
+// Unlike the lib client it does not log every response.
+type registryClient struct {
+	client *http.Client
+	base   url.URL
+	repo   string
+	scope  string // "pull" or "pull,push"
+	user   string
+	pass   string
+	auth   string
+}
+
+func (c *registryClient) url(path string) string {
+	u := c.base
+	u.Path = "/v2/" + c.repo + "/" + path
+	return u.String()
+}
+
+// do sends a request, authenticating and retrying once when the registry answers 401.
+func (c *registryClient) do(ctx context.Context, method, urlStr string, header http.Header, body func() (io.Reader, int64)) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		var r io.Reader
+		var size int64
+		if body != nil {
+			r, size = body()
+		}
+		req, err := http.NewRequestWithContext(ctx, method, urlStr, r)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if body != nil {
+			req.ContentLength = size
+		}
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		return c.client.Do(req)
+	}
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if err := c.authorize(ctx, challenge); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+func (c *registryClient) authorize(ctx context.Context, challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.user == "" && c.pass == "" {
+			return fmt.Errorf("%s 需要登录，请先 docker login %s 或使用 --username/--password", c.base.Host, c.base.Host)
+		}
+		c.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(c.user+":"+c.pass))
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+
+	attrs := parseAuthParams(params)
+	tokenURL, err := url.Parse(attrs["realm"])
+	if err != nil || attrs["realm"] == "" {
+		return fmt.Errorf("invalid registry auth realm in %q", challenge)
+	}
+	q := tokenURL.Query()
+	if attrs["service"] != "" {
+		q.Set("service", attrs["service"])
+	}
+	q.Set("scope", "repository:"+c.repo+":"+c.scope)
+	tokenURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.user != "" || c.pass != "" {
+		req.SetBasicAuth(c.user, c.pass)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if c.user == "" && c.pass == "" {
+			return fmt.Errorf("匿名获取 %s 的访问令牌失败（%s），请先 docker login %s 或使用 --username/--password", c.base.Host, resp.Status, c.base.Host)
+		}
+		return fmt.Errorf("registry token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("registry token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return errors.New("registry token: empty token")
+	}
+	c.auth = "Bearer " + token.Token
+	return nil
+}
+
+// parseAuthParams splits the comma separated key="value" pairs of a WWW-Authenticate challenge.
+func parseAuthParams(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		s = strings.TrimLeft(s, ", ")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				val, s = rest[1:], ""
+			} else {
+				val, s = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			val, s, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.ToLower(strings.TrimSpace(key))] = val
+	}
+	return attrs
+}
@@ -0,0 +1,46 @@
+package vmdownloader
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/cli/config"
+	"github.com/kspeeder/docker-registry/lib"
+)
+
+func TestRegistryCredentials(t *testing.T) {
+	dir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("alice:mirror-pass"))
+	cfg := `{"auths":{"mirror.example.com":{"auth":"` + auth + `"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The Docker config directory is resolved once per process, possibly by an earlier test.
+	oldDir := config.Dir()
+	config.SetDir(dir)
+	defer config.SetDir(oldDir)
+	t.Setenv("GHCR_USERNAME", "bob")
+	t.Setenv("GHCR_PASSWORD", "ghcr-token")
+
+	if c := registryCredentials("ghcr.io"); c.User() != "bob" || c.Password() != "ghcr-token" {
+		t.Fatalf("ghcr.io credentials = %s/%s", c.User(), c.Password())
+	}
+	if c := registryCredentials("mirror.example.com"); c.User() != "alice" || c.Password() != "mirror-pass" {
+		t.Fatalf("mirror credentials = %s/%s", c.User(), c.Password())
+	}
+	if c := registryCredentials("ghcr.1ms.run"); !c.IsBlank() {
+		t.Fatalf("GHCR credentials leaked to a mirror: %s", c.User())
+	}
+
+	err := explainRegistryAuthError("ghcr.1ms.run/kspeeder/win7x64:en_enterprise", lib.AutorizationError("denied"))
+	if !strings.Contains(err.Error(), "docker login ghcr.1ms.run") || !errors.Is(err, lib.AutorizationError("denied")) {
+		t.Fatalf("unexpected anonymous auth error %v", err)
+	}
+	if err := errors.New("dial tcp: timeout"); explainRegistryAuthError("ghcr.io/a/b:c", err) != err {
+		t.Fatal("non-auth error was rewrapped")
+	}
+}
@@ -0,0 +1,511 @@
+package vmdownloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linkease/fastpve/downloader"
+)
+
+const (
+	defaultS3Endpoint = "https://s3.amazonaws.com"
+	defaultS3Region   = "us-east-1"
+	unsignedPayload   = "UNSIGNED-PAYLOAD"
+)
+
+// s3PartSize is the multipart upload part size; 10000 parts cover 640 GB.
+var s3PartSize int64 = 64 << 20
+
+// S3Profile is the credentials profile used for s3:// locations; empty means the
+// environment, then AWS_PROFILE. See LoadS3Config.
+var S3Profile string
+
+// SetS3Profile configures S3Profile from user input such as a flag.
+func SetS3Profile(profile string) {
+	S3Profile = strings.TrimSpace(profile)
+}
+
+// S3Config locates S3-compatible storage (AWS, MinIO, Ceph RGW...) and its credentials.
+// Requests are unsigned when AccessKey is empty, for public buckets.
+type S3Config struct {
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// LoadS3Config reads the S3 settings of profile, or of AWS_PROFILE / "default" when
+// profile is empty. The AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN,
+// AWS_REGION and AWS_ENDPOINT_URL (or S3_ENDPOINT) environment variables take precedence
+// unless a profile is named explicitly; the profile comes from ~/.aws/credentials and
+// ~/.aws/config (AWS_SHARED_CREDENTIALS_FILE and AWS_CONFIG_FILE override the paths).
+func LoadS3Config(profile string) S3Config {
+	explicit := profile != ""
+	if !explicit {
+		profile = envDefault("AWS_PROFILE", "default")
+	}
+	var cfg S3Config
+	if !explicit {
+		cfg = S3Config{
+			Endpoint:     envDefault("AWS_ENDPOINT_URL", envDefault("S3_ENDPOINT", "")),
+			Region:       envDefault("AWS_REGION", envDefault("AWS_DEFAULT_REGION", "")),
+			AccessKey:    envDefault("AWS_ACCESS_KEY_ID", ""),
+			SecretKey:    envDefault("AWS_SECRET_ACCESS_KEY", ""),
+			SessionToken: envDefault("AWS_SESSION_TOKEN", ""),
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	creds := readINISection(envDefault("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(home, ".aws", "credentials")), profile)
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = "default"
+	}
+	config := readINISection(envDefault("AWS_CONFIG_FILE", filepath.Join(home, ".aws", "config")), configSection)
+	if cfg.AccessKey == "" {
+		cfg.AccessKey = creds["aws_access_key_id"]
+		cfg.SecretKey = creds["aws_secret_access_key"]
+		cfg.SessionToken = creds["aws_session_token"]
+	}
+	if cfg.Region == "" {
+		cfg.Region = config["region"]
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = config["endpoint_url"]
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = defaultS3Endpoint
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultS3Region
+	}
+	return cfg
+}
+
+// readINISection returns the "key = value" pairs of one [section] of an INI file.
+func readINISection(path, section string) map[string]string {
+	values := make(map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+	var current string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && current == section {
+			values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// S3Object is an entry of an S3 listing.
+type S3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// S3Client issues path-style requests, signed with AWS Signature Version 4.
+type S3Client struct {
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Client returns a client for cfg; a nil client uses http.DefaultClient.
+func NewS3Client(cfg S3Config, client *http.Client) (*S3Client, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if _, err := url.Parse(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("s3 endpoint: %w", err)
+	}
+	return &S3Client{cfg: cfg, client: client, now: time.Now}, nil
+}
+
+// newS3Client returns a client for S3Profile that goes through the HTTP client of d.
+func newS3Client(d Downloader) (*S3Client, error) {
+	return NewS3Client(LoadS3Config(S3Profile), d.DefaultClient())
+}
+
+func (c *S3Client) objectURL(bucket, key string, query url.Values) string {
+	u, _ := url.Parse(c.cfg.Endpoint)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = awsURIEscape(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	return u.String()
+}
+
+func (c *S3Client) do(ctx context.Context, method, urlStr string, header http.Header, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	c.sign(req, payloadHash)
+	return c.client.Do(req)
+}
+
+// sign adds the SigV4 Authorization header; payloadHash is the hex SHA-256 of the body,
+// or UNSIGNED-PAYLOAD.
+func (c *S3Client) sign(req *http.Request, payloadHash string) {
+	if c.cfg.AccessKey == "" {
+		return
+	}
+	if payloadHash == "" {
+		payloadHash = emptySHA256
+	}
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "range" || lk == "content-type" || lk == "content-md5" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + c.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), day)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEscape percent-encodes everything but the RFC 3986 unreserved characters,
+// and "/" unless encodeSlash is set.
+func awsURIEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' && !encodeSlash {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsURIEscape(k, true)+"="+awsURIEscape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Error(op string, resp *http.Response) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s: %s: %s %s", op, resp.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("%s: %s", op, resp.Status)
+}
+
+// Head returns the size and modification time of an object.
+func (c *S3Client) Head(ctx context.Context, bucket, key string) (int64, time.Time, error) {
+	resp, err := c.do(ctx, http.MethodHead, c.objectURL(bucket, key, nil), nil, nil, 0, "")
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, time.Time{}, fmt.Errorf("HEAD s3://%s/%s: %s", bucket, key, resp.Status)
+	}
+	modTime, _ := time.Parse(time.RFC1123, resp.Header.Get("Last-Modified"))
+	return resp.ContentLength, modTime, nil
+}
+
+// Get streams an object starting at offset.
+func (c *S3Client) Get(ctx context.Context, bucket, key string, offset int64) (io.ReadCloser, error) {
+	return rangedGet(ctx, c.client, c.objectURL(bucket, key, nil), offset, func(req *http.Request) error {
+		c.sign(req, "")
+		return nil
+	})
+}
+
+// List returns the objects under prefix. With delimiter "/", "sub directories" are
+// returned as keys ending in "/" and their content is not listed.
+func (c *S3Client) List(ctx context.Context, bucket, prefix, delimiter string) ([]S3Object, error) {
+	var objects []S3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, http.MethodGet, c.objectURL(bucket, "", query), nil, nil, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error("list s3://"+bucket+"/"+prefix, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			CommonPrefixes []struct {
+				Prefix string `xml:"Prefix"`
+			} `xml:"CommonPrefixes"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("list s3://%s/%s: %w", bucket, prefix, err)
+		}
+		for _, p := range result.CommonPrefixes {
+			objects = append(objects, S3Object{Key: p.Prefix})
+		}
+		for _, o := range result.Contents {
+			objects = append(objects, S3Object{Key: o.Key, Size: o.Size, LastModified: o.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Put uploads a local file, in parts of s3PartSize when it is larger than one part.
+func (c *S3Client) Put(ctx context.Context, bucket, key, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	if info.Size() <= s3PartSize {
+		resp, err := c.do(ctx, http.MethodPut, c.objectURL(bucket, key, nil), header, f, info.Size(), unsignedPayload)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return s3Error("put s3://"+bucket+"/"+key, resp)
+		}
+		return nil
+	}
+	return c.putMultipart(ctx, bucket, key, f, info.Size(), header)
+}
+
+func (c *S3Client) putMultipart(ctx context.Context, bucket, key string, f io.ReaderAt, size int64, header http.Header) error {
+	resp, err := c.do(ctx, http.MethodPost, c.objectURL(bucket, key, url.Values{"uploads": {""}}), header, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return s3Error("start multipart upload", resp)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("start multipart upload: invalid response: %v", err)
+	}
+
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []part
+	abort := func(cause error) error {
+		query := url.Values{"uploadId": {initiated.UploadID}}
+		if resp, err := c.do(context.Background(), http.MethodDelete, c.objectURL(bucket, key, query), nil, nil, 0, ""); err == nil {
+			resp.Body.Close()
+		}
+		return cause
+	}
+	total := (size + s3PartSize - 1) / s3PartSize
+	for n, offset := 1, int64(0); offset < size; n, offset = n+1, offset+s3PartSize {
+		partSize := min(s3PartSize, size-offset)
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {initiated.UploadID}}
+		resp, err := c.do(ctx, http.MethodPut, c.objectURL(bucket, key, query), nil, io.NewSectionReader(f, offset, partSize), partSize, unsignedPayload)
+		if err != nil {
+			return abort(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return abort(fmt.Errorf("upload part %d: %s", n, resp.Status))
+		}
+		parts = append(parts, part{PartNumber: n, ETag: resp.Header.Get("ETag")})
+		fmt.Printf("s3://%s/%s 分块 %d/%d 已上传\n", bucket, key, n, total)
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return abort(err)
+	}
+	query := url.Values{"uploadId": {initiated.UploadID}}
+	resp, err = c.do(ctx, http.MethodPost, c.objectURL(bucket, key, query), nil, bytes.NewReader(body), int64(len(body)), sha256Hex(body))
+	if err != nil {
+		return abort(err)
+	}
+	defer resp.Body.Close()
+	// A completion can fail with 200 OK and an <Error> document.
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK || bytes.Contains(data, []byte("<Error>")) {
+		return abort(errors.New("complete multipart upload: " + resp.Status + " " + strings.TrimSpace(string(data))))
+	}
+	return nil
+}
+
+// DownloadS3Object downloads s3://bucket/key into isoPath through cachePath, resuming
+// status when it is a pending download of the same object.
+func DownloadS3Object(ctx context.Context, d Downloader, isoPath, cachePath, statusPath string, status *downloader.DownloadStatus, location string) (string, error) {
+	bucket, key, err := parseS3URL(location)
+	if err != nil {
+		return "", err
+	}
+	fileName := path.Base(key)
+	if key == "" || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("s3 url %q does not name an object", location)
+	}
+	dest := filepath.Join(isoPath, fileName)
+	if status == nil || status.Url != location {
+		totalSize, modTime, err := probeLocation(ctx, d, location)
+		if err != nil {
+			return "", err
+		}
+		if existingImage(dest, totalSize) {
+			return dest, nil
+		}
+		status = &downloader.DownloadStatus{Url: location, TargetFile: filepath.Join(cachePath, fileName), TotalSize: totalSize, ModTime: modTime}
+	}
+	fmt.Println("downloading:", fileName, "url=\n", "s3://"+bucket+"/"+key)
+	return downloadAndMove(ctx, d, statusPath, status, dest)
+}
+
+// PushS3File uploads a local file to s3://bucket/key; a key that is empty or ends in "/"
+// gets the file name appended. It returns the location of the object.
+func PushS3File(ctx context.Context, d Downloader, filePath, location string) (string, error) {
+	bucket, key, err := parseS3URL(location)
+	if err != nil {
+		return "", err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += filepath.Base(filePath)
+	}
+	client, err := newS3Client(d)
+	if err != nil {
+		return "", err
+	}
+	if err := client.Put(ctx, bucket, key, filePath); err != nil {
+		return "", err
+	}
+	return "s3://" + bucket + "/" + key, nil
+}
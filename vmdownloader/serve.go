@@ -0,0 +1,182 @@
+package vmdownloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultServePort is the port used by `fastpve-download serve` and assumed for peers without an explicit port.
+	DefaultServePort = 8686
+
+	manifestPath = "/manifest.json"
+	filesPrefix  = "/files/"
+)
+
+// ManifestEntry describes a single image exposed by an ImageServer.
+type ManifestEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Digest is "sha256:<hex>" once the server has hashed the file, empty while hashing is still in progress.
+	Digest string `json:"digest,omitempty"`
+}
+
+// Manifest is the document served at /manifest.json.
+type Manifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+type cachedDigest struct {
+	size    int64
+	modTime time.Time
+	digest  string
+}
+
+// ImageServer exposes the images of a directory to other hosts on the LAN.
+// Files are served under /files/<name> with Range support, the listing under /manifest.json.
+type ImageServer struct {
+	dir string
+
+	mu      sync.Mutex
+	digests map[string]cachedDigest
+	hashing map[string]struct{}
+}
+
+func NewImageServer(dir string) *ImageServer {
+	return &ImageServer{
+		dir:     dir,
+		digests: make(map[string]cachedDigest),
+		hashing: make(map[string]struct{}),
+	}
+}
+
+func (s *ImageServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == manifestPath:
+		s.serveManifest(w)
+	case strings.HasPrefix(r.URL.Path, filesPrefix):
+		s.serveFile(w, r, strings.TrimPrefix(r.URL.Path, filesPrefix))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Manifest lists the servable images; digests of files not hashed yet are computed in the background.
+func (s *ImageServer) Manifest() (*Manifest, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{Files: []ManifestEntry{}}
+	for _, dir := range dirs {
+		if !isServableImage(dir) {
+			continue
+		}
+		info, err := dir.Info()
+		if err != nil {
+			continue
+		}
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			Name:    dir.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+			Digest:  s.digest(dir.Name(), info),
+		})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Name < manifest.Files[j].Name
+	})
+	return manifest, nil
+}
+
+func (s *ImageServer) serveManifest(w http.ResponseWriter) {
+	manifest, err := s.Manifest()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+func (s *ImageServer) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || isPartialDownload(name) {
+		http.NotFound(w, r)
+		return
+	}
+	// ServeContent handles Range, If-Range and Last-Modified for resumable downloads.
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+func (s *ImageServer) digest(name string, info os.FileInfo) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.digests[name]; ok && c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+		return c.digest
+	}
+	if _, ok := s.hashing[name]; !ok {
+		s.hashing[name] = struct{}{}
+		go s.hashFile(name, info.Size(), info.ModTime())
+	}
+	return ""
+}
+
+func (s *ImageServer) hashFile(name string, size int64, modTime time.Time) {
+	digest, err := fileSHA256(filepath.Join(s.dir, name))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.hashing, name)
+	if err != nil {
+		log.Println("hash", name, "failed:", err)
+		return
+	}
+	s.digests[name] = cachedDigest{size: size, modTime: modTime, digest: "sha256:" + digest}
+}
+
+func fileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isServableImage(dir os.DirEntry) bool {
+	name := dir.Name()
+	return dir.Type().IsRegular() && !strings.HasPrefix(name, ".") && !isPartialDownload(name)
+}
+
+func isPartialDownload(name string) bool {
+	return strings.HasSuffix(name, ".syn")
+}
@@ -0,0 +1,160 @@
+package vmdownloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkease/fastpve/downloader"
+)
+
+func TestImageServerManifestAndRange(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ubuntu-test.iso"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "windows-11.iso.syn"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewImageServer(dir))
+	defer srv.Close()
+
+	client := srv.Client()
+	var manifest *Manifest
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m, err := FetchPeerManifest(context.Background(), client, srv.URL)
+		if err != nil {
+			t.Fatalf("fetch manifest: %v", err)
+		}
+		manifest = m
+		if len(m.Files) == 1 && m.Files[0].Digest != "" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Name != "ubuntu-test.iso" || manifest.Files[0].Size != 10 {
+		t.Fatalf("unexpected manifest: %+v", manifest.Files)
+	}
+	if !strings.HasPrefix(manifest.Files[0].Digest, "sha256:") {
+		t.Fatalf("digest not computed: %+v", manifest.Files[0])
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/files/ubuntu-test.iso", nil)
+	req.Header.Set("Range", "bytes=4-")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "456789" {
+		t.Fatalf("unexpected range response: %d %q", resp.StatusCode, body)
+	}
+
+	resp, err = client.Get(srv.URL + "/files/windows-11.iso.syn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("partial download must not be served, got %d", resp.StatusCode)
+	}
+}
+
+func TestPeerURLsAndDigest(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("peer image")
+	if err := os.WriteFile(filepath.Join(dir, "virtio-win-test.iso"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	image := NewImageServer(dir)
+	srv := httptest.NewServer(image)
+	defer srv.Close()
+	image.hashFile("virtio-win-test.iso", int64(len(content)), mustModTime(t, filepath.Join(dir, "virtio-win-test.iso")))
+
+	oldPeers, oldDiscover := LANPeers, DiscoverLANPeers
+	defer func() { LANPeers, DiscoverLANPeers = oldPeers, oldDiscover }()
+	SetLANPeers([]string{srv.URL + ", "})
+
+	urls := peerURLs(context.Background(), downloader.NewDownloader(), "virtio-win-test.iso")
+	if len(urls) != 1 || !strings.Contains(urls[0], "digest=sha256") {
+		t.Fatalf("unexpected peer urls: %v", urls)
+	}
+	if got := peerURLs(context.Background(), downloader.NewDownloader(), "missing.iso"); len(got) != 0 {
+		t.Fatalf("expected no peer for missing file, got %v", got)
+	}
+
+	local := filepath.Join(t.TempDir(), "copy.iso")
+	if err := os.WriteFile(local, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPeerDigest(urls[0], local); err != nil {
+		t.Fatalf("digest should match: %v", err)
+	}
+	if err := os.WriteFile(local, []byte("tampered"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPeerDigest(urls[0], local); err == nil {
+		t.Fatal("expected digest mismatch")
+	}
+}
+
+func TestPeerFallback(t *testing.T) {
+	content := []byte("mirror image")
+	mux := http.NewServeMux()
+	mux.HandleFunc(manifestPath, func(w http.ResponseWriter, r *http.Request) {
+		// Still hashing: the entry has no digest yet.
+		fmt.Fprintf(w, `{"files":[{"name":"test.iso","size":%d}]}`, len(content))
+	})
+	mux.HandleFunc(filesPrefix, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "test.iso", time.Time{}, strings.NewReader("tampered"))
+	})
+	mux.HandleFunc("/mirror/test.iso", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "test.iso", time.Time{}, bytes.NewReader(content))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	oldPeers, oldDiscover := LANPeers, DiscoverLANPeers
+	defer func() { LANPeers, DiscoverLANPeers = oldPeers, oldDiscover }()
+	SetLANPeers([]string{srv.URL})
+	d := downloader.NewDownloader()
+	if urls := peerURLs(context.Background(), d, "test.iso"); len(urls) != 0 {
+		t.Fatalf("peer without a digest offered: %v", urls)
+	}
+
+	dir := t.TempDir()
+	peer := srv.URL + filesPrefix + "test.iso?digest=sha256:" + strings.Repeat("0", 64)
+	mirror := srv.URL + "/mirror/test.iso"
+	status := &downloader.DownloadStatus{
+		Url:        peer,
+		TargetFile: filepath.Join(dir, "test.iso.syn"),
+		TotalSize:  int64(len("tampered")),
+		Fallback:   peerFallback(peer, []string{peer, mirror}),
+	}
+	target, err := downloadAndMove(context.Background(), d, filepath.Join(dir, "status.ops"), status, filepath.Join(dir, "test.iso"))
+	if err != nil {
+		t.Fatalf("downloadAndMove: %v", err)
+	}
+	if got, _ := os.ReadFile(target); !bytes.Equal(got, content) || status.Url != mirror {
+		t.Fatalf("got %q from %s, want the mirror copy", got, status.Url)
+	}
+}
+
+func mustModTime(t *testing.T, p string) time.Time {
+	t.Helper()
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,333 @@
+package vmdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kspeeder/blobDownload/blobDownloader"
+	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/utils"
+)
+
+// Source is a location an image can be downloaded from. Mirror lists may mix every kind
+// of source; see NewSource for the accepted forms.
+type Source interface {
+	// ID identifies the source; a partial download only resumes from the same ID.
+	ID() string
+	// Stat returns the size and modification time; the time is zero when unknown.
+	Stat(ctx context.Context) (int64, time.Time, error)
+	// Open streams the content starting at offset.
+	Open(ctx context.Context, offset int64) (io.ReadCloser, error)
+}
+
+// sourceVerifier is implemented by sources that can check a finished download themselves.
+type sourceVerifier interface {
+	Verify(filePath string) error
+}
+
+// NewSource parses a download location:
+//
+//	http(s)://host/path             HTTP download through d
+//	file:///path, /path             local file, or a mounted NFS/CIFS share
+//	oci://registry/repo:tag[#name]  file of an OCI package, the first one by default
+//	s3://bucket/key                 object on S3-compatible storage
+func NewSource(d Downloader, location string) (Source, error) {
+	switch {
+	case isHTTPURL(location):
+		return &httpSource{d: d, url: location}, nil
+	case strings.HasPrefix(location, "/"):
+		return &fileSource{path: location}, nil
+	case strings.HasPrefix(location, "file://"):
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("file url %s must name a local path", location)
+		}
+		return &fileSource{path: u.Path}, nil
+	case strings.HasPrefix(location, "oci://"):
+		ref, file, _ := strings.Cut(strings.TrimPrefix(location, "oci://"), "#")
+		if _, _, _, err := parseRegistryReference(ref); err != nil {
+			return nil, err
+		}
+		return cachedOCISource(ref, file), nil
+	case strings.HasPrefix(location, "s3://"):
+		return newS3Source(d, location)
+	}
+	return nil, fmt.Errorf("unsupported download location %q", location)
+}
+
+func isHTTPURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// probeLocation returns the size and modification time of a download location.
+func probeLocation(ctx context.Context, d Downloader, location string) (int64, time.Time, error) {
+	if isHTTPURL(location) {
+		return d.HeadInfo(location)
+	}
+	src, err := NewSource(d, location)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return src.Stat(ctx)
+}
+
+// downloadStallTimeout aborts a download that has received nothing for this long, so a
+// dead connection fails instead of hanging the install.
+var downloadStallTimeout = 60 * time.Second
+
+// copySource copies src into status.TargetFile, resuming from status.Curr when the
+// source is unchanged, and keeps the status file current so an interrupted run resumes
+// too. Sources that can check their content verify the finished file.
+func copySource(ctx context.Context, src Source, statusPath string, status *downloader.DownloadStatus) error {
+	size, modTime, err := src.Stat(ctx)
+	if err != nil {
+		return err
+	}
+	if status.TotalSize != size || !status.ModTime.Equal(modTime) {
+		status.TotalSize, status.ModTime, status.Curr = size, modTime, 0
+	}
+	if info, err := os.Stat(status.TargetFile); err != nil || info.Size() < status.Curr {
+		status.Curr = 0
+	}
+
+	file, err := os.OpenFile(status.TargetFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Truncate(status.Curr); err != nil {
+		return err
+	}
+	if _, err := file.Seek(status.Curr, io.SeekStart); err != nil {
+		return err
+	}
+	dlCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stall := time.AfterFunc(downloadStallTimeout, cancel)
+	defer stall.Stop()
+	reader, err := src.Open(dlCtx, status.Curr)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	const step = 64 * 1024 * 1024
+	for {
+		now := time.Now()
+		n, err := io.CopyN(file, &stallReader{r: reader, timer: stall}, step)
+		status.Curr += n
+		downloader.UpdateDownloadStatus(status, statusPath)
+		var progress int64
+		if status.TotalSize > 0 {
+			progress = status.Curr * 100 / status.TotalSize
+		}
+		speed := 1000 * n / (time.Since(now).Milliseconds() + 1)
+		log.Println("speed=", utils.ByteCountDecimal(uint64(speed)), "progress=", progress)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if dlCtx.Err() != nil && ctx.Err() == nil {
+				return fmt.Errorf("%s: no data for %s", src.ID(), downloadStallTimeout)
+			}
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if status.TotalSize > 0 && status.Curr != status.TotalSize {
+		return fmt.Errorf("%s: got %d of %d bytes", src.ID(), status.Curr, status.TotalSize)
+	}
+	if v, ok := src.(sourceVerifier); ok {
+		if err := v.Verify(status.TargetFile); err != nil {
+			os.Remove(status.TargetFile)
+			return err
+		}
+	}
+	os.Remove(statusPath)
+	return nil
+}
+
+// stallReader restarts the stall timer on every read that returns data.
+type stallReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.timer.Reset(downloadStallTimeout)
+	}
+	return n, err
+}
+
+type httpSource struct {
+	d   Downloader
+	url string
+}
+
+func (s *httpSource) ID() string { return s.url }
+
+func (s *httpSource) Stat(ctx context.Context) (int64, time.Time, error) {
+	return s.d.HeadInfo(s.url)
+}
+
+func (s *httpSource) Open(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	return rangedGet(ctx, s.d.DefaultClient(), s.url, offset, nil)
+}
+
+// rangedGet GETs urlStr from offset; sign, when set, authenticates the request.
+func rangedGet(ctx context.Context, client *http.Client, urlStr string, offset int64, sign func(*http.Request) error) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if sign != nil {
+		if err := sign(req); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	want := http.StatusOK
+	if offset > 0 {
+		want = http.StatusPartialContent
+	}
+	if resp.StatusCode != want {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", urlStr, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+type fileSource struct {
+	path string
+}
+
+func (s *fileSource) ID() string { return "file://" + s.path }
+
+func (s *fileSource) Stat(ctx context.Context) (int64, time.Time, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, time.Time{}, fmt.Errorf("%s is not a regular file", s.path)
+	}
+	return info.Size(), info.ModTime().UTC().Truncate(time.Second), nil
+}
+
+func (s *fileSource) Open(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// ociSource reads one file of an OCI package, through the registry mirrors like
+// DownloadOCIFiles, and verifies the result against the package blob digests.
+type ociSource struct {
+	reference string
+	file      string
+
+	mu    sync.Mutex
+	dl    *blobDownloader.Downloader
+	entry blobDownloader.FileEntry
+}
+
+var (
+	ociSourcesMu sync.Mutex
+	ociSources   = make(map[string]*ociSource)
+)
+
+// cachedOCISource returns the source of a package file, shared for the process so that
+// probing and then downloading it reads the package manifest once.
+func cachedOCISource(reference, file string) *ociSource {
+	s := &ociSource{reference: reference, file: file}
+	ociSourcesMu.Lock()
+	defer ociSourcesMu.Unlock()
+	if cached, ok := ociSources[s.ID()]; ok {
+		return cached
+	}
+	ociSources[s.ID()] = s
+	return s
+}
+
+func (s *ociSource) ID() string {
+	if s.file == "" {
+		return "oci://" + s.reference
+	}
+	return "oci://" + s.reference + "#" + s.file
+}
+
+func (s *ociSource) resolve(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dl != nil {
+		return nil
+	}
+	dl, err := openOCIPackage(ctx, s.reference)
+	if err != nil {
+		return err
+	}
+	var patterns []string
+	if s.file != "" {
+		patterns = []string{s.file}
+	}
+	entries, err := selectOCIFiles(dl.Files(), patterns)
+	if err != nil {
+		return err
+	}
+	s.dl, s.entry = dl, entries[0]
+	return nil
+}
+
+// Name returns the name the package stores the file under.
+func (s *ociSource) Name(ctx context.Context) (string, error) {
+	if err := s.resolve(ctx); err != nil {
+		return "", err
+	}
+	return s.entry.Name, nil
+}
+
+func (s *ociSource) Stat(ctx context.Context) (int64, time.Time, error) {
+	if err := s.resolve(ctx); err != nil {
+		return 0, time.Time{}, err
+	}
+	return s.entry.Size, time.Time{}, nil
+}
+
+func (s *ociSource) Open(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	if err := s.resolve(ctx); err != nil {
+		return nil, err
+	}
+	return s.dl.ReaderAt(ctx, s.entry.Name, offset)
+}
+
+func (s *ociSource) Verify(filePath string) error {
+	return verifyOCIEntry(filePath, s.entry)
+}
@@ -0,0 +1,52 @@
+package vmdownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// s3Source reads an object of S3-compatible storage, with the endpoint and credentials
+// of LoadS3Config.
+type s3Source struct {
+	client *S3Client
+	bucket string
+	key    string
+}
+
+func newS3Source(d Downloader, location string) (*s3Source, error) {
+	bucket, key, err := parseS3URL(location)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newS3Client(d)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Source{client: client, bucket: bucket, key: key}, nil
+}
+
+// parseS3URL splits "s3://bucket/key" into its bucket and object key.
+func parseS3URL(location string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("%q is not an s3:// url", location)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("s3 url %q has no bucket", location)
+	}
+	return bucket, key, nil
+}
+
+func (s *s3Source) ID() string { return "s3://" + s.bucket + "/" + s.key }
+
+func (s *s3Source) Stat(ctx context.Context) (int64, time.Time, error) {
+	return s.client.Head(ctx, s.bucket, s.key)
+}
+
+func (s *s3Source) Open(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	return s.client.Get(ctx, s.bucket, s.key, offset)
+}
@@ -0,0 +1,111 @@
+package vmdownloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkease/fastpve/downloader"
+)
+
+func TestNewSource(t *testing.T) {
+	tests := []struct {
+		location, id string
+	}{
+		{"https://example.com/a.iso", "https://example.com/a.iso"},
+		{"/mnt/nfs/isos/a.iso", "file:///mnt/nfs/isos/a.iso"},
+		{"file:///mnt/nfs/isos/a.iso", "file:///mnt/nfs/isos/a.iso"},
+		{"oci://ghcr.io/kspeeder/haos:16.0#haos.qcow2.xz", "oci://ghcr.io/kspeeder/haos:16.0#haos.qcow2.xz"},
+		{"s3://golden/isos/a.iso", "s3://golden/isos/a.iso"},
+	}
+	for _, tt := range tests {
+		src, err := NewSource(downloader.NewDownloader(), tt.location)
+		if err != nil {
+			t.Fatalf("NewSource(%s): %v", tt.location, err)
+		}
+		if src.ID() != tt.id {
+			t.Fatalf("NewSource(%s).ID() = %s, want %s", tt.location, src.ID(), tt.id)
+		}
+	}
+	for _, bad := range []string{"ftp://example.com/a.iso", "file://nas/a.iso", "oci://no-tag", "s3:///key"} {
+		if _, err := NewSource(downloader.NewDownloader(), bad); err == nil {
+			t.Fatalf("NewSource(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestDownloadFileSource(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("fastpve-"), 1000)
+	srcPath := filepath.Join(dir, "golden.iso")
+	if err := os.WriteFile(srcPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	urlStr, size, modTime, err := SelectFirstReachable(downloader.NewDownloader(), []string{filepath.Join(dir, "missing.iso"), "file://" + srcPath})
+	if err != nil || urlStr != "file://"+srcPath || size != int64(len(data)) {
+		t.Fatalf("SelectFirstReachable = %s %d, %v", urlStr, size, err)
+	}
+
+	// Resume from a partial copy of the same source.
+	target := filepath.Join(dir, "cache.iso")
+	if err := os.WriteFile(target, data[:3000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	statusPath := filepath.Join(dir, "status.ops")
+	status := &downloader.DownloadStatus{Url: urlStr, TargetFile: target, TotalSize: size, ModTime: modTime, Curr: 3000}
+	if err := DownloadFile(context.Background(), downloader.NewDownloader(), statusPath, status); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	if got, _ := os.ReadFile(target); !bytes.Equal(got, data) {
+		t.Fatal("resumed download differs from the source")
+	}
+	if _, err := os.Stat(statusPath); !os.IsNotExist(err) {
+		t.Fatal("status file kept after a finished download")
+	}
+
+	// A partial file from a different version of the source starts over.
+	if err := os.WriteFile(target, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	status = &downloader.DownloadStatus{Url: urlStr, TargetFile: target, TotalSize: 5, Curr: 5}
+	if err := DownloadFile(context.Background(), downloader.NewDownloader(), statusPath, status); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	if got, _ := os.ReadFile(target); !bytes.Equal(got, data) {
+		t.Fatal("restarted download differs from the source")
+	}
+}
+
+func TestDownloadFileStalled(t *testing.T) {
+	old := downloadStallTimeout
+	downloadStallTimeout = 100 * time.Millisecond
+	defer func() { downloadStallTimeout = old }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10000")
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	status := &downloader.DownloadStatus{Url: srv.URL + "/stalled.iso", TargetFile: filepath.Join(dir, "stalled.iso")}
+	err := DownloadFile(context.Background(), downloader.NewDownloader(), filepath.Join(dir, "status.ops"), status)
+	if err == nil || !strings.Contains(err.Error(), "no data") {
+		t.Fatalf("expected a stall error, got %v", err)
+	}
+	if status.Curr != int64(len("partial")) {
+		t.Fatalf("status.Curr = %d, want the bytes received before the stall", status.Curr)
+	}
+}
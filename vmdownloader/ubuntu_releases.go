@@ -0,0 +1,266 @@
+package vmdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/linkease/fastpve/catalog"
+)
+
+// UbuntuMetaReleaseURL is the release list Ubuntu's own upgrade tool reads.
+var UbuntuMetaReleaseURL = "https://changelogs.ubuntu.com/meta-release"
+
+var (
+	ubuntuSeriesPattern = regexp.MustCompile(`^(\d{2}\.\d{2})/$`)
+	ubuntuISOPattern    = regexp.MustCompile(`^ubuntu-(\d{2}\.\d{2}(?:\.\d+)?)-(?:desktop|live-server)-amd64\.iso$`)
+	ubuntuVersionRegexp = regexp.MustCompile(`^(\d{2}\.\d{2})(\.\d+)?$`)
+
+	ubuntuReleasesMu sync.Mutex
+	ubuntuReleases   []UbuntuRelease
+)
+
+// UbuntuRelease is a release series as published by Ubuntu, e.g. 24.04 "noble".
+type UbuntuRelease struct {
+	Series   string // "24.04"
+	Version  string // latest point release, "24.04.2"
+	Codename string // "noble", empty when discovered from a mirror index
+	Name     string // "Noble Numbat"
+	LTS      bool
+	EOL      bool
+}
+
+// DiscoverUbuntuReleases lists the current Ubuntu releases, newest first, from Ubuntu's
+// meta-release file, falling back to the ubuntu-releases index of the catalog mirrors.
+// End-of-life releases are kept only when newer than the oldest supported release.
+// A successful result is cached for the life of the process.
+func DiscoverUbuntuReleases(ctx context.Context, d Downloader) ([]UbuntuRelease, error) {
+	ubuntuReleasesMu.Lock()
+	defer ubuntuReleasesMu.Unlock()
+	if ubuntuReleases != nil {
+		return ubuntuReleases, nil
+	}
+	var releases []UbuntuRelease
+	data, err := fetchText(ctx, d, UbuntuMetaReleaseURL, maxIndexSize)
+	if err == nil {
+		releases = parseMetaRelease(data)
+	}
+	if len(releases) == 0 {
+		releases, err = scanUbuntuMirrors(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+	releases = trimUbuntuReleases(releases)
+	if len(releases) == 0 {
+		return nil, errors.New("no ubuntu releases found")
+	}
+	ubuntuReleases = releases
+	return releases, nil
+}
+
+// parseMetaRelease reads the "Dist:/Name:/Version:/Supported:" stanzas of a meta-release file.
+func parseMetaRelease(data string) []UbuntuRelease {
+	var releases []UbuntuRelease
+	for _, stanza := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n\n") {
+		var u UbuntuRelease
+		supported := false
+		for _, line := range strings.Split(stanza, "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch key {
+			case "Dist":
+				u.Codename = value
+			case "Name":
+				u.Name = value
+			case "Version":
+				fields := strings.Fields(value)
+				if len(fields) > 0 {
+					u.Version = fields[0]
+				}
+				u.LTS = strings.Contains(value, "LTS")
+			case "Supported":
+				supported = value == "1"
+			}
+		}
+		m := ubuntuVersionRegexp.FindStringSubmatch(u.Version)
+		if m == nil {
+			continue
+		}
+		u.Series = m[1]
+		u.EOL = !supported
+		releases = append(releases, u)
+	}
+	return releases
+}
+
+// scanUbuntuMirrors walks the "<series>/" directories of the first catalog mirror that answers.
+// Mirrors only carry supported releases, so none of the results is marked EOL.
+func scanUbuntuMirrors(ctx context.Context, d Downloader) ([]UbuntuRelease, error) {
+	o, err := catalog.Current().FindOS("ubuntu")
+	if err != nil {
+		return nil, err
+	}
+	lastErr := errors.New("no ubuntu mirror with a release index")
+	for _, tmpl := range o.Mirrors {
+		idx := strings.Index(tmpl, "{series}/")
+		if idx < 0 {
+			continue
+		}
+		base := tmpl[:idx]
+		entries, err := ListIndex(ctx, d, base)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var releases []UbuntuRelease
+		for _, entry := range entries {
+			m := ubuntuSeriesPattern.FindStringSubmatch(entry)
+			if m == nil {
+				continue
+			}
+			version := latestUbuntuISO(ctx, d, base+entry)
+			if version == "" {
+				continue
+			}
+			releases = append(releases, UbuntuRelease{
+				Series:  m[1],
+				Version: version,
+				LTS:     isLTSSeries(m[1]),
+			})
+		}
+		if len(releases) > 0 {
+			return releases, nil
+		}
+	}
+	return nil, lastErr
+}
+
+func latestUbuntuISO(ctx context.Context, d Downloader, dirURL string) string {
+	entries, err := ListIndex(ctx, d, dirURL)
+	if err != nil {
+		return ""
+	}
+	var latest string
+	for _, entry := range entries {
+		m := ubuntuISOPattern.FindStringSubmatch(entry)
+		if m != nil && compareVersions(m[1], latest) > 0 {
+			latest = m[1]
+		}
+	}
+	return latest
+}
+
+// isLTSSeries reports whether a series is an LTS release: April of even years.
+func isLTSSeries(series string) bool {
+	var year, month int
+	if _, err := fmt.Sscanf(series, "%d.%d", &year, &month); err != nil {
+		return false
+	}
+	return month == 4 && year%2 == 0
+}
+
+func trimUbuntuReleases(releases []UbuntuRelease) []UbuntuRelease {
+	sort.SliceStable(releases, func(i, j int) bool {
+		return compareVersions(releases[i].Series, releases[j].Series) > 0
+	})
+	oldest := ""
+	for _, u := range releases {
+		if !u.EOL {
+			oldest = u.Series
+		}
+	}
+	var kept []UbuntuRelease
+	for _, u := range releases {
+		if u.EOL && (oldest == "" || compareVersions(u.Series, oldest) < 0) {
+			continue
+		}
+		kept = append(kept, u)
+	}
+	return kept
+}
+
+// Title is the menu label of the release, e.g. "Ubuntu 24.04.2 LTS (Noble Numbat)".
+func (u UbuntuRelease) Title() string {
+	title := "Ubuntu " + u.Version
+	if u.LTS {
+		title += " LTS"
+	}
+	if u.Name != "" {
+		title += " (" + u.Name + ")"
+	}
+	return title
+}
+
+// CatalogRelease describes one flavor ("desktop" or "server") of u as a release of the
+// catalog "ubuntu" OS, so it downloads from the catalog mirrors.
+func (u UbuntuRelease) CatalogRelease(flavor string) (*catalog.Release, error) {
+	o, err := catalog.Current().FindOS("ubuntu")
+	if err != nil {
+		return nil, err
+	}
+	isoFlavor := "desktop"
+	if flavor == "server" || flavor == "live-server" {
+		flavor, isoFlavor = "server", "live-server"
+	} else {
+		flavor = "desktop"
+	}
+	return o.Bind(&catalog.Release{
+		ID:      u.Series + "-" + flavor,
+		Name:    u.Title() + " " + isoFlavor,
+		Version: u.Version,
+		Vars:    map[string]string{"series": u.Series},
+		File:    "ubuntu-{version}-" + isoFlavor + "-amd64.iso",
+		LTS:     u.LTS,
+		EOL:     u.EOL,
+	}), nil
+}
+
+// splitUbuntuSpec splits "24.04.2-live-server" into version and flavor; the flavor defaults to desktop.
+func splitUbuntuSpec(spec string) (string, string) {
+	for _, suffix := range []string{"-live-server", "-server", "-desktop"} {
+		if strings.HasSuffix(spec, suffix) {
+			return strings.TrimSuffix(spec, suffix), strings.TrimPrefix(suffix, "-")
+		}
+	}
+	return spec, "desktop"
+}
+
+// FindUbuntuRelease resolves versions such as "24.04", "24.04.2-live-server", "noble-server"
+// or a catalog release id. Without a flavor suffix the desktop image is used; an empty
+// version selects the newest supported LTS release.
+func FindUbuntuRelease(ctx context.Context, d Downloader, spec string) (*catalog.Release, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	version, flavor := splitUbuntuSpec(spec)
+	releases, discoverErr := DiscoverUbuntuReleases(ctx, d)
+	for _, u := range releases {
+		switch {
+		case version == "" && u.LTS && !u.EOL,
+			version == u.Series, version == u.Version, version == strings.ToLower(u.Codename):
+			return u.CatalogRelease(flavor)
+		case strings.HasPrefix(version, u.Series+".") && ubuntuVersionRegexp.MatchString(version):
+			// An older point release of a known series.
+			u.Version = version
+			return u.CatalogRelease(flavor)
+		}
+	}
+	if rel, err := catalog.Current().FindRelease("ubuntu", spec); err == nil {
+		return rel, nil
+	}
+	if m := ubuntuVersionRegexp.FindStringSubmatch(version); m != nil {
+		// Not listed (offline, or too new for the index): try the mirrors anyway.
+		u := UbuntuRelease{Series: m[1], Version: version, LTS: isLTSSeries(m[1])}
+		return u.CatalogRelease(flavor)
+	}
+	if discoverErr != nil {
+		return nil, fmt.Errorf("%w: ubuntu %s (%v)", catalog.ErrUnknownRelease, spec, discoverErr)
+	}
+	return nil, fmt.Errorf("%w: ubuntu %s", catalog.ErrUnknownRelease, spec)
+}
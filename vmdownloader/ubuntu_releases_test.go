@@ -0,0 +1,152 @@
+package vmdownloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+)
+
+const testMetaRelease = `Dist: jammy
+Name: Jammy Jellyfish
+Version: 22.04.5 LTS
+Date: Thu, 21 April 2022 22:04:00 UTC
+Supported: 1
+
+Dist: mantic
+Name: Mantic Minotaur
+Version: 23.10
+Supported: 0
+
+Dist: focal
+Name: Focal Fossa
+Version: 20.04.6 LTS
+Supported: 0
+
+Dist: noble
+Name: Noble Numbat
+Version: 24.04.2 LTS
+Supported: 1
+
+Dist: oracular
+Name: Oracular Oriole
+Version: 24.10
+Supported: 0
+
+Dist: plucky
+Name: Plucky Puffin
+Version: 25.04
+Supported: 1
+`
+
+func resetUbuntuReleases(t *testing.T) {
+	t.Helper()
+	ubuntuReleasesMu.Lock()
+	ubuntuReleases = nil
+	ubuntuReleasesMu.Unlock()
+	t.Cleanup(func() {
+		ubuntuReleasesMu.Lock()
+		ubuntuReleases = nil
+		ubuntuReleasesMu.Unlock()
+	})
+}
+
+func TestParseMetaRelease(t *testing.T) {
+	releases := trimUbuntuReleases(parseMetaRelease(testMetaRelease))
+	var got []string
+	for _, u := range releases {
+		got = append(got, fmt.Sprintf("%s/%s/%v/%v", u.Series, u.Version, u.LTS, u.EOL))
+	}
+	want := []string{
+		"25.04/25.04/false/false",
+		"24.10/24.10/false/true",
+		"24.04/24.04.2/true/false",
+		"23.10/23.10/false/true",
+		"22.04/22.04.5/true/false",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestFindUbuntuRelease(t *testing.T) {
+	resetUbuntuReleases(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testMetaRelease)
+	}))
+	defer srv.Close()
+	oldURL := UbuntuMetaReleaseURL
+	UbuntuMetaReleaseURL = srv.URL
+	defer func() { UbuntuMetaReleaseURL = oldURL }()
+
+	tests := []struct {
+		spec, id, file string
+	}{
+		{"", "24.04-desktop", "ubuntu-24.04.2-desktop-amd64.iso"},
+		{"24.04", "24.04-desktop", "ubuntu-24.04.2-desktop-amd64.iso"},
+		{"24.04.1-live-server", "24.04-server", "ubuntu-24.04.1-live-server-amd64.iso"},
+		{"noble-server", "24.04-server", "ubuntu-24.04.2-live-server-amd64.iso"},
+		{"24.10-desktop", "24.10-desktop", "ubuntu-24.10-desktop-amd64.iso"},
+		{"2204s", "22.04-server", "ubuntu-22.04.5-live-server-amd64.iso"},
+		{"26.04", "26.04-desktop", "ubuntu-26.04-desktop-amd64.iso"},
+	}
+	d := downloader.NewDownloader()
+	for _, tt := range tests {
+		rel, err := FindUbuntuRelease(context.Background(), d, tt.spec)
+		if err != nil {
+			t.Fatalf("FindUbuntuRelease(%q): %v", tt.spec, err)
+		}
+		file, urls := rel.Expand("")
+		if rel.ID != tt.id || file != tt.file {
+			t.Fatalf("FindUbuntuRelease(%q) = %s %s, want %s %s", tt.spec, rel.ID, file, tt.id, tt.file)
+		}
+		if len(urls) == 0 {
+			t.Fatalf("FindUbuntuRelease(%q) has no mirrors", tt.spec)
+		}
+	}
+	rel, _ := FindUbuntuRelease(context.Background(), d, "24.10")
+	if !rel.EOL {
+		t.Fatal("24.10 should be marked EOL")
+	}
+	if _, err := FindUbuntuRelease(context.Background(), d, "warty"); err == nil {
+		t.Fatal("expected error for unknown release")
+	}
+}
+
+func TestScanUbuntuMirrors(t *testing.T) {
+	resetUbuntuReleases(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ubuntu-releases/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="../">../</a><a href="22.04/">22.04/</a><a href="24.04/">24.04/</a><a href="noble/">noble/</a><a href="/other/">x</a>`)
+	})
+	mux.HandleFunc("/ubuntu-releases/24.04/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="ubuntu-24.04.1-desktop-amd64.iso">a</a><a href="ubuntu-24.04.2-live-server-amd64.iso">b</a><a href="SHA256SUMS">c</a>`)
+	})
+	mux.HandleFunc("/ubuntu-releases/22.04/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href='ubuntu-22.04.5-desktop-amd64.iso'>a</a>`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := catalog.Parse([]byte(`{"os":[{"id":"ubuntu","mirrors":["` + srv.URL + `/ubuntu-releases/{series}/{file}"],"releases":[]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog.SetCurrent(c)
+	defer catalog.SetCurrent(nil)
+	oldURL := UbuntuMetaReleaseURL
+	UbuntuMetaReleaseURL = srv.URL + "/missing"
+	defer func() { UbuntuMetaReleaseURL = oldURL }()
+
+	releases, err := DiscoverUbuntuReleases(context.Background(), downloader.NewDownloader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 2 || releases[0].Version != "24.04.2" || !releases[0].LTS || releases[1].Version != "22.04.5" {
+		t.Fatalf("unexpected releases %+v", releases)
+	}
+}
@@ -0,0 +1,185 @@
+package vmdownloader
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+)
+
+// VirtIO driver channels, the release ids of the "virtio" catalog entry: the stable
+// release of the virtio-win project, or its newest build.
+const (
+	VirtIOStable = "stable"
+	VirtIOLatest = "latest"
+)
+
+// virtioBuildPattern matches the directories of the archive-virtio index, "virtio-win-0.1.271-1/".
+var virtioBuildPattern = regexp.MustCompile(`^virtio-win-(\d+\.\d+\.\d+)-(\d+)/$`)
+
+// WindowsVirtIOVersion returns the newest VirtIO driver version supporting a Windows
+// version, or "" when the current drivers do.
+func WindowsVirtIOVersion(version int) string {
+	rel, err := WindowsRelease(version)
+	if err != nil {
+		return ""
+	}
+	return rel.VirtIO
+}
+
+// VirtIORelease resolves the driver release of channel (VirtIOStable when empty) against
+// the virtio-win archive. maxVersion caps the version for older guests: the newest
+// archived build not above it is used instead. On discovery failures the catalog
+// defaults are kept.
+func VirtIORelease(ctx context.Context, d Downloader, channel, maxVersion string) (*catalog.Release, error) {
+	if channel == "" {
+		channel = VirtIOStable
+	}
+	rel, err := catalog.Current().FindRelease("virtio", channel)
+	if err != nil {
+		return nil, err
+	}
+	builds, err := listVirtIOBuilds(ctx, d, rel)
+	if err != nil {
+		fmt.Println("获取 VirtIO 驱动版本列表失败:", err)
+	}
+
+	r := DiscoverRelease(ctx, d, rel).Clone()
+	if channel == VirtIOLatest {
+		if latest := highestVirtIOVersion(builds, ""); latest != "" {
+			r.Version = latest
+		}
+	}
+	if maxVersion != "" && compareVersions(r.Version, maxVersion) > 0 {
+		r.Version = maxVersion
+		if v := highestVirtIOVersion(builds, maxVersion); v != "" {
+			r.Version = v
+		}
+	}
+	if build, ok := builds[r.Version]; ok {
+		if r.Vars == nil {
+			r.Vars = make(map[string]string)
+		}
+		r.Vars["build"] = build
+	}
+	return r, nil
+}
+
+// listVirtIOBuilds lists the archive directory holding "{version}" on the mirrors of rel
+// and returns the newest build of each version.
+func listVirtIOBuilds(ctx context.Context, d Downloader, rel *catalog.Release) (map[string]string, error) {
+	mirrors := rel.Mirrors
+	if len(mirrors) == 0 && rel.OS() != nil {
+		mirrors = rel.OS().Mirrors
+	}
+	lastErr := fmt.Errorf("no mirror of virtio %s lists its builds", rel.ID)
+	for _, tmpl := range mirrors {
+		idx := strings.Index(tmpl, "{version}")
+		if idx < 0 {
+			continue
+		}
+		entries, err := ListIndex(ctx, d, tmpl[:strings.LastIndex(tmpl[:idx], "/")+1])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		builds := make(map[string]string)
+		for _, entry := range entries {
+			m := virtioBuildPattern.FindStringSubmatch(entry)
+			if m != nil && compareVersions(m[2], builds[m[1]]) > 0 {
+				builds[m[1]] = m[2]
+			}
+		}
+		if len(builds) > 0 {
+			return builds, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// highestVirtIOVersion returns the newest version of builds, not above maxVersion when set.
+func highestVirtIOVersion(builds map[string]string, maxVersion string) string {
+	var latest string
+	for v := range builds {
+		if maxVersion != "" && compareVersions(v, maxVersion) > 0 {
+			continue
+		}
+		if compareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// DownloadVirtIO resumes a pending driver download when status is provided and is for
+// the file of rel, or downloads rel (see VirtIORelease) into isoPath. A failed resume is
+// returned, keeping the partial file for the next attempt.
+func DownloadVirtIO(ctx context.Context, d Downloader, isoPath, statusPath string, status *downloader.DownloadStatus, rel *catalog.Release) (string, error) {
+	if rel == nil {
+		return "", fmt.Errorf("%w: virtio", catalog.ErrUnknownRelease)
+	}
+	fileName, _ := rel.Expand("")
+	if status != nil {
+		realPath := strings.TrimSuffix(status.TargetFile, ".syn")
+		if filepath.Base(realPath) == fileName {
+			if status.Checksum == "" {
+				checksum, err := releaseChecksum(ctx, d, rel, status.Url, fileName)
+				if err != nil {
+					return "", err
+				}
+				status.Checksum = checksum
+			}
+			fmt.Println("downloading:", filepath.Base(realPath), "url=\n", status.Url)
+			if _, err := downloadAndMove(ctx, d, statusPath, status, realPath); err != nil {
+				return "", err
+			}
+			return realPath, verifyDownload(realPath, status, true)
+		}
+	}
+
+	existing, status, err := resolveRelease(ctx, d, rel, isoPath, isoPath, sameName)
+	if err != nil || existing != "" {
+		return existing, err
+	}
+	realPath := status.TargetFile
+	status.TargetFile += ".syn"
+	status.Checksum, err = releaseChecksum(ctx, d, rel, status.Url, fileName)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("downloading:", filepath.Base(realPath), "url=\n", status.Url)
+	if _, err := downloadAndMove(ctx, d, statusPath, status, realPath); err != nil {
+		return "", err
+	}
+	return realPath, verifyDownload(realPath, status, false)
+}
+
+// SortVirtIOFiles orders "virtio-win-<version>.iso" file names newest first, keeping
+// the versions above maxVersion, which an older Windows may not support, last.
+func SortVirtIOFiles(names []string, maxVersion string) {
+	supported := func(v string) bool {
+		return maxVersion == "" || v != "" && compareVersions(v, maxVersion) <= 0
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		vi, vj := virtioFileVersion(names[i]), virtioFileVersion(names[j])
+		if si, sj := supported(vi), supported(vj); si != sj {
+			return si
+		}
+		return compareVersions(vi, vj) > 0
+	})
+}
+
+// virtioFileVersion returns the driver version of a "virtio-win-<version>.iso" file
+// name, or "" for other names such as "virtio-win.iso".
+func virtioFileVersion(name string) string {
+	v := strings.TrimSuffix(strings.TrimPrefix(name, "virtio-win-"), ".iso")
+	if v == name || v == "" || v[0] < '0' || v[0] > '9' {
+		return ""
+	}
+	return v
+}
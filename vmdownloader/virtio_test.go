@@ -0,0 +1,78 @@
+package vmdownloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linkease/fastpve/catalog"
+	"github.com/linkease/fastpve/downloader"
+)
+
+func TestVirtIORelease(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/archive-virtio/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="../">../</a><a href="virtio-win-0.1.171-1/">a</a>
+<a href="virtio-win-0.1.173-2/">b</a><a href="virtio-win-0.1.173-9/">c</a>
+<a href="virtio-win-0.1.185-2/">d</a><a href="virtio-win-0.1.285-1/">e</a>`)
+	})
+	mux.HandleFunc("/stable-virtio/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="virtio-win.iso">a</a><a href="virtio-win-0.1.185.iso">b</a>`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := catalog.Parse([]byte(`{"os":[{"id":"virtio",
+		"mirrors":["` + srv.URL + `/archive-virtio/virtio-win-{version}-{build}/{file}"],
+		"releases":[
+			{"id":"stable","version":"0.1.271","version_index":"` + srv.URL + `/stable-virtio/",
+			 "version_match":"^virtio-win-(\\d+\\.\\d+\\.\\d+)\\.iso$","vars":{"build":"1"},"file":"virtio-win-{version}.iso"},
+			{"id":"latest","version":"0.1.271","vars":{"build":"1"},"file":"virtio-win-{version}.iso"}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog.SetCurrent(c)
+	defer catalog.SetCurrent(catalog.Default())
+
+	tests := []struct {
+		channel, maxVersion, url string
+	}{
+		{VirtIOStable, "", "/archive-virtio/virtio-win-0.1.185-2/virtio-win-0.1.185.iso"},
+		{VirtIOLatest, "", "/archive-virtio/virtio-win-0.1.285-1/virtio-win-0.1.285.iso"},
+		{VirtIOStable, "0.1.173", "/archive-virtio/virtio-win-0.1.173-9/virtio-win-0.1.173.iso"},
+		{VirtIOLatest, "0.1.180", "/archive-virtio/virtio-win-0.1.173-9/virtio-win-0.1.173.iso"},
+	}
+	for _, tt := range tests {
+		rel, err := VirtIORelease(context.Background(), downloader.NewDownloader(), tt.channel, tt.maxVersion)
+		if err != nil {
+			t.Fatalf("VirtIORelease(%s, %s): %v", tt.channel, tt.maxVersion, err)
+		}
+		if _, urls := rel.Expand(""); urls[0] != srv.URL+tt.url {
+			t.Errorf("VirtIORelease(%s, %s) = %s, want %s", tt.channel, tt.maxVersion, urls[0], tt.url)
+		}
+	}
+}
+
+func TestSortVirtIOFiles(t *testing.T) {
+	names := []string{"virtio-win-0.1.173.iso", "virtio-win.iso", "virtio-win-0.1.271.iso", "virtio-win-0.1.160.iso"}
+	SortVirtIOFiles(names, "")
+	if got := strings.Join(names, ","); got != "virtio-win-0.1.271.iso,virtio-win-0.1.173.iso,virtio-win-0.1.160.iso,virtio-win.iso" {
+		t.Fatalf("SortVirtIOFiles = %s", got)
+	}
+	SortVirtIOFiles(names, "0.1.173")
+	if got := strings.Join(names, ","); got != "virtio-win-0.1.173.iso,virtio-win-0.1.160.iso,virtio-win-0.1.271.iso,virtio-win.iso" {
+		t.Fatalf("SortVirtIOFiles(0.1.173) = %s", got)
+	}
+}
+
+func TestWindowsVirtIOVersion(t *testing.T) {
+	if v := WindowsVirtIOVersion(Win7); v != "0.1.173" {
+		t.Fatalf("WindowsVirtIOVersion(Win7) = %q", v)
+	}
+	if v := WindowsVirtIOVersion(Win11); v != "" {
+		t.Fatalf("WindowsVirtIOVersion(Win11) = %q", v)
+	}
+}
@@ -3,13 +3,15 @@ package vmdownloader
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/linkease/fastpve/downloader"
-	"github.com/linkease/fastpve/utils"
 )
 
 var ErrNoReachableURL = errors.New("no reachable download URL")
@@ -17,7 +19,6 @@ var ErrNoReachableURL = errors.New("no reachable download URL")
 // Downloader captures the download behaviours needed by the vm downloader.
 type Downloader interface {
 	HeadInfo(urlStr string) (int64, time.Time, error)
-	ResumableDownloader(ctx context.Context, urlStr, targetFile string, status *downloader.DownloadStatus, progressCh chan *downloader.ProgressInfo) error
 	DownloadStatusVerify(status *downloader.DownloadStatus, remoteSize int64, remoteModTime time.Time) bool
 	DefaultClient() *http.Client
 	RemoteURLCacheEnabled() bool
@@ -30,7 +31,7 @@ func IsStatusValid(d Downloader, statusPath string) (*downloader.DownloadStatus,
 	var statusValid bool
 	status, err := downloader.ReadUpdateDownload(statusPath)
 	if err == nil {
-		remoteSize, remoteModTime, err := d.HeadInfo(status.Url)
+		remoteSize, remoteModTime, err := probeLocation(context.TODO(), d, status.Url)
 		if err != nil {
 			return nil, err
 		}
@@ -43,28 +44,21 @@ func IsStatusValid(d Downloader, statusPath string) (*downloader.DownloadStatus,
 }
 
 // DownloadFile downloads a file with progress reporting and persists status updates.
+// status.Url may be any location accepted by NewSource.
 func DownloadFile(ctx context.Context, d Downloader, statusPath string, status *downloader.DownloadStatus) error {
-	progressCh := make(chan *downloader.ProgressInfo, 8)
-	go func() {
-		for progress := range progressCh {
-			downloader.UpdateDownloadStatus(progress.Status, statusPath)
-			log.Println("speed=", utils.ByteCountDecimal(uint64(progress.Speed)), "progress=", progress.Progress)
-		}
-	}()
-	err := d.ResumableDownloader(ctx, status.Url, status.TargetFile, status, progressCh)
-	close(progressCh)
-	if err == nil {
-		time.Sleep(time.Second)
-		os.Remove(statusPath)
+	src, err := NewSource(d, status.Url)
+	if err != nil {
+		return err
 	}
-	return err
+	return copySource(ctx, src, statusPath, status)
 }
 
-// SelectFirstReachable returns the first URL that responds with a valid HEAD response.
+// SelectFirstReachable returns the first candidate that responds to a probe: a HEAD
+// request for URLs, Source.Stat for the other locations accepted by NewSource.
 func SelectFirstReachable(d Downloader, urls []string) (string, int64, time.Time, error) {
 	var lastErr error
 	for _, u := range urls {
-		totalSize, modTime, err := d.HeadInfo(u)
+		totalSize, modTime, err := probeLocation(context.TODO(), d, u)
 		if err != nil {
 			lastErr = err
 			continue
@@ -77,12 +71,92 @@ func SelectFirstReachable(d Downloader, urls []string) (string, int64, time.Time
 	return "", 0, time.Time{}, lastErr
 }
 
+// existingImage reports whether a complete image is already present at destPath,
+// e.g. on a shared storage another cluster node downloaded to. A positive size is the
+// expected size of the image; files of another size are incomplete copies.
+func existingImage(destPath string, size int64) bool {
+	info, err := os.Stat(destPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return false
+	}
+	if size > 0 && info.Size() != size {
+		fmt.Println("已有镜像大小不符，重新下载:", destPath, info.Size(), "!=", size)
+		return false
+	}
+	fmt.Println("镜像已存在，跳过下载:", destPath)
+	return true
+}
+
 func downloadAndMove(ctx context.Context, d Downloader, statusPath string, status *downloader.DownloadStatus, destPath string) (string, error) {
-	if err := DownloadFile(ctx, d, statusPath, status); err != nil {
+	if err := downloadVerified(ctx, d, statusPath, status); err != nil {
 		return "", err
 	}
-	if err := os.Rename(status.TargetFile, destPath); err != nil {
+	if err := moveFile(status.TargetFile, destPath); err != nil {
 		return "", err
 	}
 	return destPath, nil
 }
+
+// downloadVerified downloads status and checks a file from a LAN peer against the digest
+// the peer published. A copy that does not match is dropped and the download starts over
+// from the first reachable location of status.Fallback.
+func downloadVerified(ctx context.Context, d Downloader, statusPath string, status *downloader.DownloadStatus) error {
+	if err := DownloadFile(ctx, d, statusPath, status); err != nil {
+		return err
+	}
+	err := verifyPeerDigest(status.Url, status.TargetFile)
+	if err == nil {
+		return nil
+	}
+	os.Remove(status.TargetFile)
+	if !errors.Is(err, ErrPeerDigestMismatch) || len(status.Fallback) == 0 {
+		return err
+	}
+	fmt.Println("局域网节点的文件校验失败，改用其他下载源:", err)
+	urlStr, totalSize, modTime, err2 := SelectFirstReachable(d, status.Fallback)
+	if err2 != nil {
+		return fmt.Errorf("%w; %v", err, err2)
+	}
+	status.Url, status.TotalSize, status.ModTime, status.Curr, status.Fallback = urlStr, totalSize, modTime, 0, nil
+	fmt.Println("downloading:", filepath.Base(status.TargetFile), "url=\n", status.Url)
+	return downloadVerified(ctx, d, statusPath, status)
+}
+
+// moveFile renames src to dest, copying across filesystems when the cache and image
+// directories are on different mounts. The copy goes through a ".syn" file next to dest,
+// so dest never appears incomplete.
+func moveFile(src, dest string) error {
+	err := os.Rename(src, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	temp := dest + ".syn"
+	out, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	fmt.Println("复制到镜像目录:", dest)
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(temp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(temp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err := os.Rename(temp, dest); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
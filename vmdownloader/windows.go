@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/linkease/fastpve/catalog"
 	"github.com/linkease/fastpve/downloader"
+	"github.com/linkease/fastpve/msdownload"
 	"github.com/linkease/fastpve/quickget"
 	"github.com/linkease/fastpve/utils"
 )
@@ -19,11 +22,73 @@ const (
 	Win11 = iota
 	Win10
 	Win7
+	WinServer2025
+	WinServer2022
+	WinServer2019
 )
 
+// windowsReleaseIDs maps the Windows version constants to catalog release ids.
+var windowsReleaseIDs = map[int]string{
+	Win11:         "11",
+	Win10:         "10",
+	Win7:          "7",
+	WinServer2025: "server2025",
+	WinServer2022: "server2022",
+	WinServer2019: "server2019",
+}
+
+// WindowsVersion returns the version constant of a catalog release id.
+func WindowsVersion(releaseID string) (int, bool) {
+	for version, id := range windowsReleaseIDs {
+		if id == releaseID {
+			return version, true
+		}
+	}
+	return -1, false
+}
+
+// LTSC editions are named "LTSC <language>" or "IoT LTSC <language>" in the catalog.
+const (
+	ltscEditionPrefix    = "LTSC "
+	iotLTSCEditionPrefix = "IoT LTSC "
+)
+
+// windowsEditionRelease maps an edition to the quickget release and language: LTSC editions
+// come from the evaluation center under "<version>-ltsc" and "<version>-iot-ltsc". ok is false
+// for editions quickget cannot fetch, which are only available from GHCR.
+func windowsEditionRelease(version int, edition string) (release, language string, ok bool) {
+	_, release = windowsQuickgetTarget(version)
+	switch {
+	case strings.HasPrefix(edition, iotLTSCEditionPrefix):
+		// Microsoft only offers an IoT Enterprise LTSC evaluation for Windows 11.
+		return release + "-iot-ltsc", strings.TrimPrefix(edition, iotLTSCEditionPrefix), version == Win11
+	case strings.HasPrefix(edition, ltscEditionPrefix):
+		return release + "-ltsc", strings.TrimPrefix(edition, ltscEditionPrefix), version == Win11 || version == Win10
+	}
+	return release, edition, true
+}
+
+// windowsQuickgetTarget returns the quickget OS and release names of a Windows version.
+func windowsQuickgetTarget(version int) (string, string) {
+	id := windowsReleaseIDs[version]
+	if server, ok := strings.CutPrefix(id, "server"); ok {
+		return "windows-server", server
+	}
+	return "windows", id
+}
+
+// WindowsRelease returns the catalog entry of a Windows version constant.
+func WindowsRelease(version int) (*catalog.Release, error) {
+	id, ok := windowsReleaseIDs[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: windows %d", catalog.ErrUnknownRelease, version)
+	}
+	return catalog.Current().FindRelease("windows", id)
+}
+
 // DownloadWindowsISO resumes a pending download when status is provided, or starts a new download for the given version/edition.
 // version should match the quickget expectation (e.g. 0 for Win11, 1 for Win10).
-func DownloadWindowsISO(ctx context.Context, d Downloader, quickGetPath, isoPath, statusPath string, status *downloader.DownloadStatus, version int, editionName string) (string, error) {
+func DownloadWindowsISO(ctx context.Context, d Downloader, isoPath, statusPath string, status *downloader.DownloadStatus, version int, editionName string) (string, error) {
 	if status != nil && version < 0 {
 		realPath := strings.TrimSuffix(status.TargetFile, ".syn")
 		fmt.Println("downloading:", filepath.Base(realPath))
@@ -34,11 +99,7 @@ func DownloadWindowsISO(ctx context.Context, d Downloader, quickGetPath, isoPath
 		return "", errors.New("windows version missing")
 	}
 
-	if version == Win7 {
-		return downloadWindowsFromGHCR(ctx, isoPath, version, editionName)
-	}
-
-	if editionName == "" {
+	if editionName == "" && version != Win7 {
 		return "", errors.New("windows edition missing")
 	}
 
@@ -46,68 +107,191 @@ func DownloadWindowsISO(ctx context.Context, d Downloader, quickGetPath, isoPath
 	if status != nil {
 		_ = os.Remove(status.TargetFile)
 		_ = os.Remove(statusPath)
-		status = nil
 	}
-
-	var winVer string
-	if version == 0 {
-		winVer = "11"
-	} else {
-		winVer = "10"
+	target, err := downloadWindows(ctx, d, isoPath, statusPath, version, editionName, true)
+	if errors.Is(err, ErrPeerDigestMismatch) {
+		fmt.Println("局域网节点的文件校验失败，改用其他下载源:", err)
+		return downloadWindows(ctx, d, isoPath, statusPath, version, editionName, false)
 	}
+	return target, err
+}
+
+// downloadWindows downloads an edition from the first reachable candidate: LAN peers
+// when usePeers is set, the official download, which is only resolved when no peer has
+// the image, and the GHCR package.
+func downloadWindows(ctx context.Context, d Downloader, isoPath, statusPath string, version int, editionName string, usePeers bool) (string, error) {
+	osName, winVer := windowsQuickgetTarget(version)
 	tag := strings.Join([]string{
-		"windows",
+		osName,
 		winVer,
 		utils.CleanString(editionName),
 	}, "-")
 
-	urlStr, totalSize, modTime, err := resolveWindowsURL(ctx, d, quickGetPath, tag, winVer, editionName)
-	if err != nil {
-		fmt.Println("Resolve Windows download URL failed:", err, "\n尝试使用 GHCR 作为备用下载源...")
-		target, ghcrErr := downloadWindowsFromGHCR(ctx, isoPath, version, editionName)
-		if ghcrErr == nil {
-			return target, nil
+	release, language, viaQuickget := windowsEditionRelease(version, editionName)
+	var locations []string
+	if usePeers {
+		locations = peerURLs(ctx, d, tag+".iso")
+	}
+	var officialSize int64
+	if len(locations) == 0 && viaQuickget && version != Win7 {
+		urls, size, err := windowsOfficialURLs(ctx, d, tag, osName, release, language)
+		if err != nil {
+			return "", err
+		}
+		locations, officialSize = urls, size
+	}
+	ref, ghcrErr := ghcrWindowsReference(version, editionName)
+	if ghcrErr == nil {
+		ref = ghcrNamespaced(ref)
+		if ghcrPublished(ctx, ref) {
+			locations = append(locations, "oci://"+ref)
+		} else {
+			ghcrErr = fmt.Errorf("GHCR 包 %s 尚未发布", ref)
+		}
+	}
+	var urlStr string
+	var totalSize int64
+	var modTime time.Time
+	if officialSize > 0 {
+		// quickget has just checked the official download; the modification time is
+		// filled in when the download starts.
+		urlStr, totalSize = locations[0], officialSize
+	} else {
+		var err error
+		urlStr, totalSize, modTime, err = SelectFirstReachable(d, locations)
+		if err != nil {
+			if ghcrErr != nil {
+				return "", fmt.Errorf("%s 无可用下载地址: %w; %v", tag, err, ghcrErr)
+			}
+			return "", fmt.Errorf("%s 无可用下载地址: %w", tag, err)
 		}
-		return "", fmt.Errorf("resolve windows url: %w; GHCR fallback: %v", err, ghcrErr)
+	}
+	if dest := filepath.Join(isoPath, tag+".iso"); existingImage(dest, totalSize) {
+		return dest, nil
 	}
 
-	status = &downloader.DownloadStatus{
+	status := &downloader.DownloadStatus{
 		Url:        urlStr,
 		TargetFile: filepath.Join(isoPath, tag+".iso.syn"),
 		TotalSize:  totalSize,
 		ModTime:    modTime,
 	}
 	realPath := strings.TrimSuffix(status.TargetFile, ".syn")
-	fmt.Println("downloading:", filepath.Base(realPath))
+	fmt.Println("downloading:", filepath.Base(realPath), "url=\n", status.Url)
 	return downloadAndMove(ctx, d, statusPath, status, realPath)
 }
 
-func resolveWindowsURL(ctx context.Context, d Downloader, quickGetPath, tag, winVer, editionName string) (string, int64, time.Time, error) {
-	args := []string{"--url", "windows", winVer, editionName}
+// WindowsLanguages lists the languages Microsoft offers a Windows version in; editionPrefix
+// is "", or ltscEditionPrefix/iotLTSCEditionPrefix ("LTSC ", "IoT LTSC ") for the LTSC
+// evaluation images.
+func WindowsLanguages(ctx context.Context, d Downloader, version int, editionPrefix string) ([]string, error) {
+	if _, ok := windowsReleaseIDs[version]; !ok || version == Win7 {
+		return nil, fmt.Errorf("%w: windows %d has no official download", msdownload.ErrEditionUnavailable, version)
+	}
+	osName, _ := windowsQuickgetTarget(version)
+	release, _, ok := windowsEditionRelease(version, editionPrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s%s", msdownload.ErrEditionUnavailable, editionPrefix, windowsReleaseIDs[version])
+	}
+	ctx, cancel := context.WithTimeout(ctx, windowsURLTimeout)
+	defer cancel()
+	return msdownload.NewClient(d.DefaultClient()).Languages(ctx, osName, release)
+}
+
+// windowsURLTimeout bounds each attempt at resolving an official download URL.
+const windowsURLTimeout = 30 * time.Second
+
+// windowsURL asks Microsoft for the download URL of a release, falling back to the
+// quickget script when the native resolver fails. The size is the one quickget measured,
+// 0 when unknown.
+func windowsURL(ctx context.Context, d Downloader, osName, winVer, editionName string) (string, int64) {
 	fmt.Println("获取下载URL，30s 超时...")
-	ctx2, cancel := context.WithTimeout(ctx, 30*time.Second)
+	ctx2, cancel := context.WithTimeout(ctx, windowsURLTimeout)
+	urlStr, err := msdownload.NewClient(d.DefaultClient()).URL(ctx2, osName, winVer, editionName)
+	cancel()
+	if err == nil {
+		return urlStr, 0
+	}
+	switch {
+	case errors.Is(err, msdownload.ErrBlocked):
+		fmt.Println("微软拒绝了自动下载请求（地区或 IP 受限）:", err)
+	case errors.Is(err, msdownload.ErrRateLimited):
+		fmt.Println("微软下载接口请求过于频繁:", err)
+	default:
+		fmt.Println("获取官方下载URL失败:", err)
+	}
+
+	if err := quickget.EnsureDependencies(ctx); err != nil {
+		return "", 0
+	}
+	fmt.Println("改用 quickget 获取下载URL，30s 超时...")
+	ctx2, cancel = context.WithTimeout(ctx, windowsURLTimeout)
 	defer cancel()
-	urlStr, _ := quickget.GetSystemURL(ctx2, quickGetPath, args)
+	res, err := quickget.Lookup(ctx2, osName, winVer, editionName)
+	if err != nil {
+		fmt.Println("quickget 获取下载URL失败:", err)
+		return "", 0
+	}
+	return res.URL, res.Size
+}
+
+var (
+	windowsEditionsMu    sync.Mutex
+	windowsEditionsCache = make(map[int][]string)
+)
+
+// WindowsEditions lists the editions of a Windows version for menus: the catalog editions
+// first, then the other languages quickget can download. The list is cached for the
+// process, including the catalog-only fallback used when quickget cannot be listed, so
+// that menu indexes stay stable.
+func WindowsEditions(ctx context.Context, version int) ([]string, error) {
+	rel, err := WindowsRelease(version)
+	if err != nil {
+		return nil, err
+	}
+	if version == Win7 {
+		return rel.Editions, nil
+	}
+	windowsEditionsMu.Lock()
+	defer windowsEditionsMu.Unlock()
+	if editions, ok := windowsEditionsCache[version]; ok {
+		return editions, nil
+	}
+
+	editions := append([]string(nil), rel.Editions...)
+	osName, release := windowsQuickgetTarget(version)
+	entries, err := quickget.List(ctx, osName)
+	for _, e := range entries {
+		if e.Release == release && e.Option != "" && !slices.Contains(editions, e.Option) {
+			editions = append(editions, e.Option)
+		}
+	}
+	windowsEditionsCache[version] = editions
+	return editions, err
+}
+
+// windowsOfficialURLs returns the official download URL of a Windows edition with its
+// size when already known, or the URLs other hosts saved for tag in the remote URL cache
+// when it cannot be resolved here.
+func windowsOfficialURLs(ctx context.Context, d Downloader, tag, osName, winVer, editionName string) ([]string, int64, error) {
+	urlStr, size := windowsURL(ctx, d, osName, winVer, editionName)
 	if urlStr != "" {
 		if err := d.PutRemoteURL(ctx, tag, urlStr); err != nil && !errors.Is(err, downloader.ErrRemoteURLCacheDisabled) {
-			return "", 0, time.Time{}, err
+			return nil, 0, err
 		}
-		totalSize, modTime, err := d.HeadInfo(urlStr)
-		if err != nil {
-			return "", 0, time.Time{}, err
-		}
-		fmt.Println("获取下载URL成功，开始下载:", urlStr)
-		return urlStr, totalSize, modTime, nil
+		return []string{urlStr}, size, nil
 	}
 
 	if !d.RemoteURLCacheEnabled() {
-		return "", 0, time.Time{}, errors.New("获取下载URL失败，且未启用远程缓存")
+		fmt.Println("获取下载URL失败，且未启用远程缓存")
+		return nil, 0, nil
 	}
 
-	fmt.Println("获取下载URL失败，重新获取...")
+	fmt.Println("获取下载URL失败，从远程缓存获取...")
 	urls, err := d.GetRemoteURLs(ctx, tag)
 	if err != nil {
-		return "", 0, time.Time{}, err
+		fmt.Println("读取远程缓存失败:", err)
+		return nil, 0, nil
 	}
 	var candidates []string
 	for _, u := range urls {
@@ -116,36 +300,5 @@ func resolveWindowsURL(ctx context.Context, d Downloader, quickGetPath, tag, win
 		}
 		candidates = append(candidates, u)
 	}
-	return SelectFirstReachable(d, candidates)
-}
-
-func DownloadVirtIO(ctx context.Context, d Downloader, isoPath, statusPath string, status *downloader.DownloadStatus) (string, error) {
-	if status != nil {
-		realPath := strings.TrimSuffix(status.TargetFile, ".syn")
-		fmt.Println("downloading:", filepath.Base(realPath), "url=\n", status.Url)
-		if _, err := downloadAndMove(ctx, d, statusPath, status, realPath); err == nil {
-			return realPath, nil
-		}
-	}
-
-	urls := []string{
-		"https://dl.istoreos.com/iStoreOS/Virtual/virtio-win-0.1.271.iso",
-		"https://fw0.koolcenter.com/iStoreOS/Virtual/virtio-win-0.1.271.iso",
-		"https://fedorapeople.org/groups/virt/virtio-win/direct-downloads/archive-virtio/virtio-win-0.1.271-1/virtio-win-0.1.271.iso",
-	}
-	virtioURL, totalSize, modTime, err := SelectFirstReachable(d, urls)
-	if err != nil {
-		return "", err
-	}
-
-	status = &downloader.DownloadStatus{
-		Url:        virtioURL,
-		TargetFile: filepath.Join(isoPath, path.Base(virtioURL)+".syn"),
-		TotalSize:  totalSize,
-		ModTime:    modTime,
-	}
-
-	realPath := strings.TrimSuffix(status.TargetFile, ".syn")
-	fmt.Println("downloading:", filepath.Base(realPath), "url=\n", status.Url)
-	return downloadAndMove(ctx, d, statusPath, status, realPath)
+	return candidates, 0, nil
 }
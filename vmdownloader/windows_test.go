@@ -0,0 +1,117 @@
+package vmdownloader
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestWindowsServerReleases(t *testing.T) {
+	tests := []struct {
+		version     int
+		id, os, rel string
+		ostype      string
+		tpm         bool
+	}{
+		{Win11, "11", "windows", "11", "win11", true},
+		{Win10, "10", "windows", "10", "win10", false},
+		{WinServer2025, "server2025", "windows-server", "2025", "win11", true},
+		{WinServer2019, "server2019", "windows-server", "2019", "win10", false},
+	}
+	for _, tt := range tests {
+		rel, err := WindowsRelease(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rel.ID != tt.id {
+			t.Fatalf("WindowsRelease(%d) = %s, want %s", tt.version, rel.ID, tt.id)
+		}
+		if v, ok := WindowsVersion(rel.ID); !ok || v != tt.version {
+			t.Fatalf("WindowsVersion(%s) = %d", rel.ID, v)
+		}
+		osName, release := windowsQuickgetTarget(tt.version)
+		if osName != tt.os || release != tt.rel {
+			t.Fatalf("windowsQuickgetTarget(%d) = %s %s", tt.version, osName, release)
+		}
+		hw := rel.HardwareProfile()
+		if hw.OSType != tt.ostype || hw.TPM != tt.tpm {
+			t.Fatalf("%s hardware = %+v", rel.ID, hw)
+		}
+	}
+	if ref, err := ghcrWindowsReference(WinServer2022, "Chinese (Simplified)"); err != nil || ref == "" {
+		t.Fatalf("ghcrWindowsReference(server2022) = %q, %v", ref, err)
+	}
+}
+
+func TestWindowsEditionRelease(t *testing.T) {
+	tests := []struct {
+		version       int
+		edition       string
+		release, lang string
+		ok            bool
+	}{
+		{Win11, "Chinese (Simplified)", "11", "Chinese (Simplified)", true},
+		{Win11, "LTSC English (United States)", "11-ltsc", "English (United States)", true},
+		{Win11, "IoT LTSC Chinese (Simplified)", "11-iot-ltsc", "Chinese (Simplified)", true},
+		{Win10, "LTSC Chinese (Simplified)", "10-ltsc", "Chinese (Simplified)", true},
+		{Win10, "IoT LTSC English (United States)", "10-iot-ltsc", "English (United States)", false},
+		{WinServer2022, "German", "2022", "German", true},
+	}
+	for _, tt := range tests {
+		release, lang, ok := windowsEditionRelease(tt.version, tt.edition)
+		if release != tt.release || lang != tt.lang || ok != tt.ok {
+			t.Fatalf("windowsEditionRelease(%d, %q) = %s, %s, %v", tt.version, tt.edition, release, lang, ok)
+		}
+	}
+	if ref, err := ghcrWindowsReference(Win10, "IoT LTSC English (United States)"); err != nil || ref == "" {
+		t.Fatalf("no GHCR reference for Win10 IoT LTSC: %v", err)
+	}
+}
+
+func TestGHCRWindowsEditions(t *testing.T) {
+	tests := []struct {
+		version int
+		edition string
+		want    string
+	}{
+		{Win11, "English (United States)", "ghcr.io/kspeeder/win11x64:en_us"},
+		{Win11, "chinese (traditional)", "ghcr.io/kspeeder/win11x64:cn_traditional"},
+		{Win10, "English (United States)", "ghcr.io/kspeeder/win10x64:en_us"},
+	}
+	for _, tt := range tests {
+		if ref, err := ghcrWindowsReference(tt.version, tt.edition); err != nil || ref != tt.want {
+			t.Fatalf("ghcrWindowsReference(%d, %s) = %q, %v", tt.version, tt.edition, ref, err)
+		}
+	}
+	if _, err := ghcrWindowsReference(Win11, "English International"); err == nil {
+		t.Fatal("expected an error for an edition without GHCR package")
+	}
+
+	defer SetGHCRNamespace("")
+	SetGHCRNamespace("harbor.example.com/isos/")
+	if got := ghcrNamespaced("ghcr.io/kspeeder/win11x64:en_us"); got != "harbor.example.com/isos/win11x64:en_us" {
+		t.Fatalf("ghcrNamespaced = %s", got)
+	}
+	if got := ghcrNamespaced("ghcr.io/other/pkg:1"); got != "ghcr.io/other/pkg:1" {
+		t.Fatalf("foreign reference rewritten to %s", got)
+	}
+}
+
+func TestWindowsEditions(t *testing.T) {
+	rel, _ := WindowsRelease(Win11)
+	editions, err := WindowsEditions(context.Background(), Win11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Catalog editions keep their menu positions; quickget adds the other languages.
+	if !slices.Equal(editions[:len(rel.Editions)], rel.Editions) || !slices.Contains(editions, "Japanese") {
+		t.Fatalf("WindowsEditions(11) = %v", editions)
+	}
+	if slices.Contains(editions[len(rel.Editions):], "Chinese (Simplified)") {
+		t.Fatalf("WindowsEditions(11) repeats catalog editions: %v", editions)
+	}
+	server, err := WindowsEditions(context.Background(), WinServer2022)
+	if err != nil || !slices.Contains(server, "Japanese") || slices.Contains(server, "Korean") {
+		t.Fatalf("WindowsEditions(server2022) = %v, %v", server, err)
+	}
+}